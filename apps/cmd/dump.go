@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Files hold one canonical Extended JSON document per line, so ObjectIDs and
+// dates survive the round trip
+const dumpExt = ".jsonl"
+
+const importBatch = 500
+
+// Collections import leaves alone unless asked by name. The migration
+// history must describe this database's indexes, not the source's, and the
+// audit log is append-only, so it is only ever added to.
+var (
+	neverImported = map[string]bool{"schema_migrations": true, "schema_migrations_lock": true}
+	appendOnly    = map[string]bool{"auditlog": true}
+)
+
+func runExport(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := flags.String("dir", "", "directory to write <collection>.jsonl files to (required)")
+	only := flags.String("collections", "", "comma separated collections to export; default all")
+	exclude := flags.String("exclude", "", "comma separated collections to skip")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "-dir is required")
+		return exitUsage
+	}
+	if err := os.MkdirAll(*dir, 0o750); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *dir, err)
+		return exitError
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx := context.Background()
+	names := splitList(*only)
+	if len(names) == 0 {
+		names, err = db.ListCollectionNames(ctx, bson.M{"name": bson.M{"$not": bson.M{"$regex": "^system\\."}}})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list collections: %v\n", err)
+			return exitError
+		}
+	}
+	skip := make(map[string]bool)
+	for _, name := range splitList(*exclude) {
+		skip[name] = true
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if skip[name] {
+			continue
+		}
+		n, err := exportCollection(ctx, db.Collection(name), filepath.Join(*dir, name+dumpExt))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export %s: %v\n", name, err)
+			return exitError
+		}
+		fmt.Printf("%-32s %d documents\n", name, n)
+	}
+	return exitOK
+}
+
+func exportCollection(ctx context.Context, coll *mongo.Collection, path string) (int, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	w := bufio.NewWriter(file)
+	n := 0
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return n, err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+		n++
+	}
+	if err := cursor.Err(); err != nil {
+		return n, err
+	}
+	if err := w.Flush(); err != nil {
+		return n, err
+	}
+	return n, file.Close()
+}
+
+func runImport(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dir := flags.String("dir", "", "directory with <collection>.jsonl files written by export (required)")
+	only := flags.String("collections", "", "comma separated collections to import; default every file in -dir except auditlog")
+	drop := flags.Bool("drop", false, "drop each collection before importing it and rebuild indexes afterwards; otherwise documents are upserted by _id")
+	dryRun := flags.Bool("dry-run", false, "parse the files and report counts without writing")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "-dir is required")
+		return exitUsage
+	}
+
+	names := splitList(*only)
+	for _, name := range names {
+		if neverImported[name] {
+			fmt.Fprintf(os.Stderr, "%s is never imported; migrations rebuild it\n", name)
+			return exitUsage
+		}
+		if appendOnly[name] && *drop {
+			fmt.Fprintf(os.Stderr, "%s is append-only and cannot be imported with -drop\n", name)
+			return exitUsage
+		}
+	}
+	if len(names) == 0 {
+		paths, err := filepath.Glob(filepath.Join(*dir, "*"+dumpExt))
+		if err != nil || len(paths) == 0 {
+			fmt.Fprintf(os.Stderr, "No %s files in %s\n", dumpExt, *dir)
+			return exitUsage
+		}
+		for _, p := range paths {
+			name := strings.TrimSuffix(filepath.Base(p), dumpExt)
+			if neverImported[name] || appendOnly[name] {
+				fmt.Printf("%-32s skipped\n", name)
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx := context.Background()
+	for _, name := range names {
+		start := time.Now()
+		n, err := importCollection(ctx, db.Collection(name), filepath.Join(*dir, name+dumpExt), *drop, appendOnly[name], *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to import %s after %d documents: %v\n", name, n, err)
+			return exitError
+		}
+		verb := "imported"
+		if *dryRun {
+			verb = "would import"
+		}
+		fmt.Printf("%-32s %s %d documents in %s\n", name, verb, n, time.Since(start).Round(time.Millisecond))
+	}
+
+	// Dropping a collection drops its indexes too
+	if *drop && !*dryRun {
+		if err := database.EnsureModelIndexes(db); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rebuild indexes: %v\n", err)
+			return exitError
+		}
+		ran, err := migrate.Reapply(ctx, db)
+		for _, m := range ran {
+			fmt.Printf("reapplied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rebuild indexes: %v\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// importCollection upserts the documents in path by _id. Into an append-only
+// collection it only inserts the documents that are not there yet.
+func importCollection(ctx context.Context, coll *mongo.Collection, path string, drop, insertOnly, dryRun bool) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if drop && !dryRun {
+		if err := coll.Drop(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	var batch []mongo.WriteModel
+	flush := func() error {
+		if len(batch) == 0 || dryRun {
+			batch = batch[:0]
+			return nil
+		}
+		_, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		batch = batch[:0]
+		if insertOnly && onlyDuplicates(err) {
+			return nil
+		}
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	// Documents can be up to 16MB
+	scanner.Buffer(make([]byte, 64*1024), 17*1024*1024)
+	n, line := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return n, fmt.Errorf("line %d: %v", line, err)
+		}
+		id, ok := doc.Map()["_id"]
+		if !ok {
+			return n, fmt.Errorf("line %d: document has no _id", line)
+		}
+		if insertOnly {
+			batch = append(batch, mongo.NewInsertOneModel().SetDocument(doc))
+		} else {
+			batch = append(batch, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": id}).
+				SetReplacement(doc).
+				SetUpsert(true))
+		}
+		n++
+		if len(batch) == importBatch {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// onlyDuplicates reports whether every write in a failed bulk write was
+// refused because the _id already exists
+func onlyDuplicates(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Code != duplicateKey {
+			return false
+		}
+	}
+	return true
+}
+
+const duplicateKey = 11000
+
+func splitList(s string) []string {
+	var list []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
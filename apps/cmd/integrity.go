@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/integrity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runCheckIntegrity(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("check-integrity", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	fix := flags.Bool("fix", false, "clear dangling optional references and backlinks, and rewrite sales order and sales invoice totals from line items")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	report, err := integrity.Scan(ctx, db, *fix, func(collection string, id primitive.ObjectID, before bson.M) {
+		audit.RecordCommand(db, "check-integrity", collection, id, audit.ActionUpdate, before, audit.Snapshot(ctx, db, collection, id))
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Integrity check failed: %v\n", err)
+		return exitError
+	}
+
+	if *asJSON {
+		out := json.NewEncoder(os.Stdout)
+		out.SetIndent("", "  ")
+		out.Encode(report)
+	} else {
+		for _, v := range report.References {
+			fmt.Println(v)
+		}
+		for _, m := range report.Totals {
+			fmt.Println(m)
+		}
+		fmt.Printf("%d reference and %d total violation(s), %d open\n",
+			len(report.References), len(report.Totals), report.Open())
+	}
+
+	if report.Open() > 0 {
+		return exitViolations
+	}
+	return exitOK
+}
@@ -2,48 +2,88 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"os"
+	"sort"
 
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/routes/auth"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
 )
 
+// Exit codes shared by every subcommand, so scripts and container jobs can
+// tell a usage mistake from a failed run
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitUsage      = 2
+	exitViolations = 3 // check-integrity found problems
+)
+
+type command struct {
+	summary string
+	run     func(cfg config.Config, args []string) int
+}
+
+var commands = map[string]command{
+	"serve":             {"run the API server", runServe},
+	"migrate":           {"apply, roll back or list schema migrations", runMigrate},
+	"seed":              {"create the default menus and the super admins from env.yaml", runSeed},
+	"create-superadmin": {"create a super admin account", runCreateSuperAdmin},
+	"reset-password":    {"set a user's password and sign them out everywhere", runResetPassword},
+	"export":            {"write collections to JSON files", runExport},
+	"import":            {"load collections from JSON files written by export", runImport},
+	"check-integrity":   {"report dangling references and wrong totals, optionally fixing the safe ones", runCheckIntegrity},
+	"purge-trash":       {"permanently delete trashed documents past the retention window", runPurgeTrash},
+}
+
 func main() {
-	dbConn, err := database.InitDB()
-	if err != nil {
-		fmt.Printf("Failed to initialize database: %v\n", err)
+	// A command on the command line wins; SERVICE_NAME is the default for
+	// containers started without arguments
+	var name string
+	args := os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	} else if name = os.Getenv("SERVICE_NAME"); name == "" {
+		usage()
+		os.Exit(exitUsage)
+	}
 
-		return
+	// "polaris" was the only service name before there were subcommands
+	if name == "polaris" {
+		name = "serve"
 	}
 
-	_ = dbConn
-	database.SeedMenus(dbConn)
-	if err := database.SeedSuperAdmin(dbConn); err != nil {
-		log.Printf("Super admin seeding failed or already exists: %v", err)
-	} else {
-		log.Println("Super admin seeded successfully")
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		os.Exit(exitOK)
 	}
-	var serviceName string
-
-	// Check if the SERVICE_NAME environment variable is set
-	if envServiceName := os.Getenv("SERVICE_NAME"); envServiceName != "" {
-		serviceName = envServiceName
-	} else {
-		// Check if a command-line argument is provided
-		if len(os.Args) < 2 {
-			fmt.Println("Service name not provided")
-			return
-		}
-		serviceName = os.Args[1]
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+	os.Exit(cmd.run(cfg, args))
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	switch serviceName {
-	case "polaris":
-		auth.Auth(dbConn)
-		// case "pharmacist":
-		// 	pharmacist.Pharmacist(dbConn)
-		// case "user":
-		// 	user.User(dbConn)
+	fmt.Fprintln(os.Stderr, "Usage: polaris <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", name, commands[name].summary)
 	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "polaris <command> -h" for a command's flags.`)
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/migrate"
+)
+
+const migrateUsage = `Usage: polaris migrate [up|down|status] [flags]
+
+  up       apply pending schema migrations (default)
+  down     roll back the most recently applied migrations
+  status   list every migration, whether it has been applied and any steps
+           it had to skip
+
+Flags:
+  -dry-run   list what up or down would do without changing anything
+  -steps N   number of migrations down rolls back (default 1)
+`
+
+// runMigrate handles "polaris migrate ..." and returns the process exit code
+func runMigrate(cfg config.Config, args []string) int {
+	action := "up"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list what would change without changing anything")
+	steps := flags.Int("steps", 1, "number of migrations to roll back")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if action != "up" && action != "down" && action != "status" {
+		flags.Usage()
+		return exitUsage
+	}
+	if action == "down" && *steps < 1 {
+		fmt.Fprintln(os.Stderr, "-steps must be at least 1")
+		return exitUsage
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if action == "status" {
+		statuses, err := migrate.List(ctx, db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list migrations: %v\n", err)
+			return exitError
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if len(s.Skipped) > 0 {
+				state += ", incomplete"
+			}
+			fmt.Printf("%4d  %-32s %s\n", s.Version, s.Name, state)
+			for _, step := range s.Skipped {
+				fmt.Printf("      skipped: %s\n", step)
+			}
+		}
+		return exitOK
+	}
+
+	if action == "down" {
+		reverted, err := migrate.Rollback(ctx, db, *steps, *dryRun)
+		for _, m := range reverted {
+			verb := "rolled back"
+			if *dryRun {
+				verb = "would roll back"
+			}
+			fmt.Printf("%s %d %s\n", verb, m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return exitError
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations to roll back")
+		}
+		return exitOK
+	}
+
+	ran, err := migrate.Run(ctx, db, *dryRun)
+	for _, m := range ran {
+		verb := "applied"
+		if *dryRun {
+			verb = "would apply"
+		}
+		fmt.Printf("%s %d %s\n", verb, m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+	if len(ran) == 0 {
+		fmt.Println("Schema is up to date")
+	}
+	return exitOK
+}
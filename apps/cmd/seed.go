@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/password"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/session"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runSeed(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	if err := seedAll(db, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Seeding failed: %v\n", err)
+		return exitError
+	}
+	fmt.Println("Seeded menus and super admins")
+	return exitOK
+}
+
+func seedAll(db *mongo.Database, cfg config.Config) error {
+	if err := database.SeedMenus(db); err != nil {
+		return fmt.Errorf("menus: %v", err)
+	}
+	if err := database.SeedSuperAdmin(db, cfg); err != nil {
+		return fmt.Errorf("super admins: %v", err)
+	}
+	return nil
+}
+
+func runCreateSuperAdmin(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("create-superadmin", flag.ContinueOnError)
+	email := flags.String("email", "", "email address to sign in with (required)")
+	fullName := flags.String("name", "", "full name shown on documents")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin instead of $POLARIS_PASSWORD")
+	promote := flags.Bool("promote", false, "make an existing user a super admin instead of failing")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "-email is required")
+		return exitUsage
+	}
+	addr := strings.ToLower(strings.TrimSpace(*email))
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	superRole, err := database.SuperAdminRole(ctx, db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	var existing models.User
+	err = db.Collection("user").FindOne(ctx, bson.M{"email": addr}).Decode(&existing)
+	switch {
+	case err == nil && !*promote:
+		fmt.Fprintf(os.Stderr, "User %s already exists; use -promote to make them a super admin\n", addr)
+		return exitError
+	case err == nil:
+		before := audit.Snapshot(ctx, db, "user", existing.ID)
+		_, err := db.Collection("user").UpdateByID(ctx, existing.ID, bson.M{
+			"$set":      bson.M{"isSuperAdmin": true, "status": "active"},
+			"$addToSet": bson.M{"roleIds": superRole.ID},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to promote %s: %v\n", addr, err)
+			return exitError
+		}
+		audit.RecordCommand(db, "create-superadmin", "user", existing.ID, audit.ActionUpdate, before, audit.Snapshot(ctx, db, "user", existing.ID))
+		fmt.Printf("Promoted %s to super admin\n", addr)
+		return exitOK
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		fmt.Fprintf(os.Stderr, "Failed to look up %s: %v\n", addr, err)
+		return exitError
+	}
+
+	pw, code := readPassword(cfg, *passwordStdin)
+	if code != exitOK {
+		return code
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to hash password: %v\n", err)
+		return exitError
+	}
+
+	now := time.Now()
+	user := models.User{
+		Email:             addr,
+		Password:          string(hash),
+		Roles:             superRole.ID,
+		IsSuperAdmin:      true,
+		Status:            "active",
+		PasswordChangedAt: &now,
+		FullName:          strings.TrimSpace(*fullName),
+	}
+	res, err := db.Collection("user").InsertOne(ctx, user)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", addr, err)
+		return exitError
+	}
+	id := res.InsertedID.(primitive.ObjectID)
+	audit.RecordCommand(db, "create-superadmin", "user", id, audit.ActionCreate, nil, audit.Snapshot(ctx, db, "user", id))
+
+	fmt.Printf("Created super admin %s (%s)\n", addr, id.Hex())
+	return exitOK
+}
+
+func runResetPassword(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the user (required)")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin instead of $POLARIS_PASSWORD")
+	keepSessions := flags.Bool("keep-sessions", false, "do not sign the user out of existing sessions")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *email == "" {
+		fmt.Fprintln(os.Stderr, "-email is required")
+		return exitUsage
+	}
+	addr := strings.ToLower(strings.TrimSpace(*email))
+
+	pw, code := readPassword(cfg, *passwordStdin)
+	if code != exitOK {
+		return code
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var user models.User
+	if err := db.Collection("user").FindOne(ctx, bson.M{"email": addr}).Decode(&user); err != nil {
+		fmt.Fprintf(os.Stderr, "User %s not found\n", addr)
+		return exitError
+	}
+	if user.IsServiceAccount {
+		fmt.Fprintln(os.Stderr, "Service accounts have no password; issue an API key instead")
+		return exitError
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to hash password: %v\n", err)
+		return exitError
+	}
+
+	before := audit.Snapshot(ctx, db, "user", user.ID)
+	_, err = db.Collection("user").UpdateByID(ctx, user.ID, bson.M{
+		"$set": bson.M{"password": string(hash), "passwordChangedAt": time.Now()},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reset password: %v\n", err)
+		return exitError
+	}
+	audit.RecordCommand(db, "reset-password", "user", user.ID, "reset_password", before, audit.Snapshot(ctx, db, "user", user.ID))
+
+	if !*keepSessions {
+		n, err := session.RevokeAllForUser(ctx, db, user.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Password reset, but failed to revoke sessions: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("Password reset for %s; %d session(s) revoked\n", addr, n)
+		return exitOK
+	}
+	fmt.Printf("Password reset for %s\n", addr)
+	return exitOK
+}
+
+// readPassword takes the password from $POLARIS_PASSWORD or stdin, never a
+// flag, so it does not end up in shell history or the process list. It is
+// checked against the password policy in env.yaml.
+func readPassword(cfg config.Config, fromStdin bool) (string, int) {
+	var pw string
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintf(os.Stderr, "Failed to read password from stdin: %v\n", err)
+			return "", exitError
+		}
+		pw = strings.TrimRight(line, "\r\n")
+	} else {
+		pw = os.Getenv("POLARIS_PASSWORD")
+	}
+	if pw == "" {
+		fmt.Fprintln(os.Stderr, "A password is required: set POLARIS_PASSWORD or pass -password-stdin")
+		return "", exitUsage
+	}
+
+	if err := password.Validate(cfg, pw); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", exitUsage
+	}
+	return pw, exitOK
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/health"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/routes/auth"
+	"github.com/sirupsen/logrus"
+)
+
+func runServe(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	seed := flags.Bool("seed", false, "create the default menus and env.yaml super admins before serving")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	// One JSON object per line, including lines written with the log package
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	log.SetFlags(0)
+	log.SetOutput(logrus.StandardLogger().Writer())
+
+	dbConn, err := database.InitDB(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return exitError
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := dbConn.Client().Disconnect(ctx); err != nil {
+			log.Printf("Failed to disconnect from MongoDB: %v", err)
+		}
+	}()
+
+	if *seed {
+		if err := seedAll(dbConn, cfg); err != nil {
+			log.Printf("Seeding failed: %v", err)
+		}
+	}
+
+	s := cfg.Server
+	port := s.Port
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           auth.Auth(cfg, dbConn),
+		ReadTimeout:       seconds(s.ReadTimeoutSeconds, 30),
+		ReadHeaderTimeout: seconds(s.ReadHeaderTimeoutSeconds, 10),
+		WriteTimeout:      seconds(s.WriteTimeoutSeconds, 120),
+		IdleTimeout:       seconds(s.IdleTimeoutSeconds, 120),
+	}
+
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Application started, Listening on Port %s", port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		fmt.Fprintf(os.Stderr, "Server failed: %v\n", err)
+		return exitError
+	case <-stop.Done():
+	}
+
+	// Fail readiness first and keep serving until the load balancer has seen
+	// it, then let in-flight requests such as report downloads finish
+	log.Println("Shutting down, draining in-flight requests")
+	health.SetDraining()
+	time.Sleep(seconds(s.DrainDelaySeconds, 5))
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), seconds(s.ShutdownTimeoutSeconds, 30))
+	defer cancelShutdown()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown did not finish cleanly: %v", err)
+		return exitError
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server failed: %v", err)
+		return exitError
+	}
+	log.Println("Server stopped")
+	return exitOK
+}
+
+// seconds turns a config value into a duration, using def when unset
+func seconds(value, def int) time.Duration {
+	if value <= 0 {
+		value = def
+	}
+	return time.Duration(value) * time.Second
+}
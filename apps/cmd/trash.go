@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runPurgeTrash(cfg config.Config, args []string) int {
+	flags := flag.NewFlagSet("purge-trash", flag.ContinueOnError)
+	days := flags.Int("days", cfg.Trash.RetentionDays, "purge documents trashed at least this many days ago")
+	dryRun := flags.Bool("dry-run", false, "count what would be purged without deleting")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *days < cfg.Trash.RetentionDays {
+		fmt.Fprintf(os.Stderr, "-days cannot be below the retention window of %d days\n", cfg.Trash.RetentionDays)
+		return exitUsage
+	}
+	retention := time.Duration(*days) * 24 * time.Hour
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return exitError
+	}
+	defer db.Client().Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	if *dryRun {
+		for _, name := range trash.Names() {
+			n, err := db.Collection(trash.Entities[name].Collection).CountDocuments(ctx, trash.Purgeable(retention))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				return exitError
+			}
+			fmt.Printf("%-18s %d\n", name, n)
+		}
+		return exitOK
+	}
+
+	counts, err := trash.Expire(ctx, db, retention, func(collection string, doc bson.M) {
+		id, _ := doc["_id"].(primitive.ObjectID)
+		audit.RecordCommand(db, "purge-trash", collection, id, audit.ActionPurge, doc, nil)
+	})
+	var total int64
+	for _, name := range trash.Names() {
+		fmt.Printf("%-18s %d\n", name, counts[name])
+		total += counts[name]
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Purge failed: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("%d document(s) purged\n", total)
+	return exitOK
+}
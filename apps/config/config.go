@@ -1,50 +1,269 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// Config is read from $ENV_PATH/env.yaml once at startup. Every key can be
+// overridden by an environment variable named POLARIS_ plus its path in upper
+// snake case, e.g. POLARIS_JWT_SECRET or POLARIS_MONGO_CONNECTION_STRING.
 type Config struct {
 	Env string `yaml:"env"`
 
+	Server struct {
+		// Port to listen on; default 10004. PORT is honoured as well.
+		Port string `yaml:"port"`
+		// First path segment of every API route; default v1. API_VERSION is
+		// honoured as well.
+		APIVersion string `yaml:"apiVersion"`
+		// HTTP timeouts in seconds; defaults read 30, header 10, write 120
+		// (report downloads are slow), idle 120
+		ReadTimeoutSeconds       int `yaml:"readTimeoutSeconds"`
+		ReadHeaderTimeoutSeconds int `yaml:"readHeaderTimeoutSeconds"`
+		WriteTimeoutSeconds      int `yaml:"writeTimeoutSeconds"`
+		IdleTimeoutSeconds       int `yaml:"idleTimeoutSeconds"`
+		// How long /readyz reports shutting down after SIGTERM before the
+		// listener closes, so the load balancer stops routing first; default 5
+		DrainDelaySeconds int `yaml:"drainDelaySeconds"`
+		// How long in-flight requests get to finish after SIGTERM; default 30
+		ShutdownTimeoutSeconds int `yaml:"shutdownTimeoutSeconds"`
+		// When set, /metrics requires "Authorization: Bearer <token>"
+		MetricsToken string `yaml:"metricsToken"`
+		// How long a create request's Idempotency-Key is remembered; default
+		// 24
+		IdempotencyTTLHours int `yaml:"idempotencyTTLHours"`
+	} `yaml:"server"`
 	Mongo struct {
 		ConnectionString string `yaml:"connectionString"`
 		Database         string `yaml:"database"`
+		// Apply pending schema migrations when the API starts; default true.
+		// Turn off to run them only with the migrate command.
+		AutoMigrate *bool `yaml:"autoMigrate"`
 	} `yaml:"mongo"`
 	JWT struct {
 		Secret string `yaml:"secret"`
+		// Lifetimes of access and refresh tokens; zero falls back to the
+		// defaults in jwthelper. Access tokens live 15 to 30 minutes.
+		AccessTokenMinutes int `yaml:"accessTokenMinutes"`
+		RefreshTokenDays   int `yaml:"refreshTokenDays"`
 	} `yaml:"jwt"`
+	Password struct {
+		// Policy enforced on sign up, change and reset; MinLength defaults to 8
+		MinLength     int  `yaml:"minLength"`
+		RequireUpper  bool `yaml:"requireUpper"`
+		RequireLower  bool `yaml:"requireLower"`
+		RequireDigit  bool `yaml:"requireDigit"`
+		RequireSymbol bool `yaml:"requireSymbol"`
+		// Frontend page that receives ?token=... from the reset email
+		ResetURL          string `yaml:"resetURL"`
+		ResetTokenMinutes int    `yaml:"resetTokenMinutes"`
+	} `yaml:"password"`
+	Invite struct {
+		// Frontend page that receives ?token=... from the invitation email
+		AcceptURL string `yaml:"acceptURL"`
+		// Invitation link lifetime; defaults to 72 hours
+		ExpiryHours int `yaml:"expiryHours"`
+	} `yaml:"invite"`
+	LoginGuard struct {
+		// Failed sign ins allowed per account / per IP before lockout starts;
+		// defaults 5 and 20
+		MaxAttempts   int `yaml:"maxAttempts"`
+		IPMaxAttempts int `yaml:"ipMaxAttempts"`
+		// First lockout length, doubled on every further failure up to the
+		// maximum; defaults 1 minute and 60 minutes
+		BaseLockoutSeconds int `yaml:"baseLockoutSeconds"`
+		MaxLockoutMinutes  int `yaml:"maxLockoutMinutes"`
+	} `yaml:"loginGuard"`
+	Mail struct {
+		Backend   string `yaml:"backend"` // smtp | file | memory
+		From      string `yaml:"from"`
+		OutboxDir string `yaml:"outboxDir"` // used by the file backend
+		SMTP      struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		} `yaml:"smtp"`
+	} `yaml:"mail"`
+	Storage struct {
+		// Directory for generated reports and PDFs before they are sent;
+		// defaults to the system temp directory
+		Dir string `yaml:"dir"`
+	} `yaml:"storage"`
+	Trash struct {
+		// Deleted business documents stay restorable for this many days
+		// before a super admin may purge them; default 30
+		RetentionDays int `yaml:"retentionDays"`
+		// Cascade says, per dependent collection, what deleting the
+		// document it points at does to it: "block" refuses the delete,
+		// "drafts" trashes it along with the parent while it is still a
+		// draft and blocks otherwise, "trash" always trashes it along.
+		// Collections not listed block. Default drafts for sales orders,
+		// supplier POs and delivery receipts.
+		Cascade map[string]string `yaml:"cascade"`
+	} `yaml:"trash"`
+	// Timezone is the IANA zone business dates are printed and numbered in,
+	// e.g. for the year in SO-2025-00001; default Asia/Manila
+	Timezone string `yaml:"timezone"`
+	// Company is printed in document and report headers
+	Company struct {
+		Name    string `yaml:"name"`
+		Address string `yaml:"address"`
+		TIN     string `yaml:"tin"`
+		Phone   string `yaml:"phone"`
+		Email   string `yaml:"email"`
+		Website string `yaml:"website"`
+	} `yaml:"company"`
 	Seed struct {
 		SuperAdmins []struct {
 			Email    string `yaml:"email"`
 			Password string `yaml:"password"`
 		} `yaml:"superAdmins"`
 	} `yaml:"seed"`
-	// Endpoint string `yaml:"endpoint"`
-	Endpoints []string `mapstructure:"endpoints"`
+	// Sequences overrides the document number format per document type
+	// (customer, project, salesorder, salesinvoice, deliveryreceipt,
+	// supplierpo); see the sequence package for the defaults
+	Sequences map[string]SequenceFormat `yaml:"sequences"`
+	// Endpoints are the browser origins allowed by CORS
+	Endpoints []string `yaml:"endpoints"`
 }
 
-func Env() (Config, error) {
-	var config Config
+// SequenceFormat renders numbers as PREFIX-BRANCH-YEAR-000001, leaving out
+// empty parts
+type SequenceFormat struct {
+	Prefix      string `yaml:"prefix"`
+	Branch      string `yaml:"branch"`
+	Padding     int    `yaml:"padding"`
+	IncludeYear *bool  `yaml:"includeYear"` // default true
+	ResetYearly *bool  `yaml:"resetYearly"` // default true; restart at 1 every January
+}
 
-	// Get user home dire
-	home := os.Getenv("ENV_PATH")
-	filePath := filepath.Join(home, "env.yaml")
+// Load reads env.yaml, applies environment overrides and defaults, and
+// checks that required values are present. The commands call it once and
+// pass the result down.
+func Load() (Config, error) {
+	var cfg Config
 
+	filePath := filepath.Join(os.Getenv("ENV_PATH"), "env.yaml")
 	envData, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return config, err
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(envData, &cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %v", filePath, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		// Containers may configure everything through the environment
+		logrus.Warnf("%s not found, using environment variables only", filePath)
+	default:
+		return cfg, err
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	cfg.setDefaults()
+	return cfg, cfg.validate()
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Server.Port == "" {
+		cfg.Server.Port = os.Getenv("PORT")
+	}
+	if cfg.Server.Port == "" {
+		cfg.Server.Port = "10004"
+	}
+	if cfg.Server.APIVersion == "" {
+		cfg.Server.APIVersion = os.Getenv("API_VERSION")
+	}
+	if cfg.Server.APIVersion == "" {
+		cfg.Server.APIVersion = "v1"
+	}
+	if cfg.Server.IdempotencyTTLHours <= 0 {
+		cfg.Server.IdempotencyTTLHours = 24
+	}
+	if cfg.Storage.Dir == "" {
+		cfg.Storage.Dir = os.TempDir()
+	}
+	if cfg.Trash.RetentionDays <= 0 {
+		cfg.Trash.RetentionDays = 30
+	}
+	if cfg.Trash.Cascade == nil {
+		cfg.Trash.Cascade = map[string]string{
+			"salesorder":               "drafts",
+			"supplier_purchase_orders": "drafts",
+			"delivery_receipts":        "drafts",
+		}
+	}
+	if cfg.Timezone == "" {
+		cfg.Timezone = "Asia/Manila"
+	}
+	if cfg.Company.Name == "" {
+		cfg.Company.Name = "Polaris Prime Air Tech Corp"
 	}
+}
+
+// validate reports every missing or malformed value at once
+func (cfg Config) validate() error {
+	var problems []string
+	require := func(value, key string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, key+" is required")
+		}
+	}
+
+	require(cfg.Mongo.ConnectionString, "mongo.connectionString")
+	require(cfg.Mongo.Database, "mongo.database")
+	require(cfg.JWT.Secret, "jwt.secret")
+	if cfg.JWT.Secret != "" && len(cfg.JWT.Secret) < 32 {
+		logrus.Warn("jwt.secret is shorter than 32 characters; use a longer random value")
+	}
+	if m := cfg.JWT.AccessTokenMinutes; m != 0 && (m < 15 || m > 30) {
+		problems = append(problems, fmt.Sprintf("jwt.accessTokenMinutes %d is not between 15 and 30", m))
+	}
+
+	switch cfg.Mail.Backend {
+	case "", "file", "memory":
+	case "smtp":
+		require(cfg.Mail.SMTP.Host, "mail.smtp.host")
+	default:
+		problems = append(problems, fmt.Sprintf("mail.backend %q is not one of smtp, file, memory", cfg.Mail.Backend))
+	}
+
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		problems = append(problems, fmt.Sprintf("timezone %q is not a known IANA zone", cfg.Timezone))
+	}
+	if info, err := os.Stat(cfg.Storage.Dir); err != nil || !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("storage.dir %q is not a directory", cfg.Storage.Dir))
+	}
+
+	for coll, mode := range cfg.Trash.Cascade {
+		switch mode {
+		case "block", "drafts", "trash":
+		default:
+			problems = append(problems, fmt.Sprintf("trash.cascade.%s %q is not one of block, drafts, trash", coll, mode))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
 
-	// Parse YAML data
-	err = yaml.Unmarshal(envData, &config)
+// Location is the configured business timezone
+func (cfg Config) Location() *time.Location {
+	loc, err := time.LoadLocation(cfg.Timezone)
 	if err != nil {
-		return config, err
+		return time.Local
 	}
-	// Return config
-	return config, nil
+	return loc
 }
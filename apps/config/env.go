@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const envPrefix = "POLARIS"
+
+// applyEnv overrides config values with POLARIS_* environment variables.
+// Scalars take the variable as is; lists of strings may be comma separated;
+// anything else (seed.superAdmins, sequences) is parsed as YAML or JSON.
+func applyEnv(cfg *Config) error {
+	return applyEnvTo(reflect.ValueOf(cfg).Elem(), envPrefix)
+}
+
+func applyEnvTo(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + envName(key)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			if err := applyEnvTo(value, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+		return nil
+	case reflect.Slice:
+		trimmed := strings.TrimSpace(raw)
+		if v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(trimmed, "[") {
+			var list []string
+			for _, part := range strings.Split(raw, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					list = append(list, part)
+				}
+			}
+			v.Set(reflect.ValueOf(list))
+			return nil
+		}
+	}
+
+	// Numbers, booleans, pointers, maps and structured lists
+	target := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(raw), target.Interface()); err != nil {
+		return err
+	}
+	v.Set(target.Elem())
+	return nil
+}
+
+// envName turns a yaml key into upper snake case: connectionString becomes
+// CONNECTION_STRING and resetURL becomes RESET_URL
+func envName(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
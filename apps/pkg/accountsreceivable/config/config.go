@@ -5,6 +5,7 @@ type CreateInvoicePayload struct {
 	CustomerID   string               `json:"customer_id" binding:"required"`
 	SalesOrderID string               `json:"sales_order_id" binding:"required"`
 	Items        []InvoiceItemPayload `json:"items" binding:"required,dive"`
+	Version      *int64               `json:"version,omitempty"` // required when updating
 }
 
 type InvoiceItemPayload struct {
@@ -20,5 +21,6 @@ type CreateDeliveryReceiptPayload struct {
 }
 
 type UpdateDeliveryReceiptPayload struct {
-	Status string `json:"status,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Version *int64 `json:"version"`
 }
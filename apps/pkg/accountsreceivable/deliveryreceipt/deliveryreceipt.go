@@ -3,31 +3,45 @@ package deliveryreceipt
 import (
 	"context"
 	"net/http"
-	"strconv"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/accountsreceivable/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	accountsreceivableconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/accountsreceivable/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/profile"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/reporthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CreateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
+func CreateDeliveryReceipt(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	// Authenticate user
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	authUser, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
-	var payload config.CreateDeliveryReceiptPayload
+	if !permission.Authorize(c, db, permission.ResourceDeliveryReceipt, permission.ActionCreate) {
+		return
+	}
+
+	var payload accountsreceivableconfig.CreateDeliveryReceiptPayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -41,7 +55,7 @@ func CreateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 	// Fetch invoice
 	var invoice models.SalesInvoice
 	err := db.Collection("sales_invoices").
-		FindOne(context.Background(), bson.M{"_id": invoiceID}).
+		FindOne(context.Background(), trash.Live(bson.M{"_id": invoiceID})).
 		Decode(&invoice)
 
 	if err != nil {
@@ -52,7 +66,7 @@ func CreateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 	// Fetch customer
 	var customer models.Customer
 	err = db.Collection("customer").
-		FindOne(context.Background(), bson.M{"_id": customerID}).
+		FindOne(context.Background(), trash.Live(bson.M{"_id": customerID})).
 		Decode(&customer)
 
 	if err != nil {
@@ -69,9 +83,15 @@ func CreateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 		})
 	}
 
+	drNumber, err := sequence.Next(c, db, cfg, sequence.DeliveryReceipt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate DR number"})
+		return
+	}
+
 	// Build DR object
 	dr := models.DeliveryReceipt{
-		DRNumber:         "DR-" + time.Now().Format("20060102150405"),
+		DRNumber:         drNumber,
 		ProjectID:        projectID,
 		CustomerID:       customerID,
 		SalesOrderID:     salesOrderID,
@@ -82,17 +102,31 @@ func CreateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 		CustomerLocation: customer.Address,
 		Items:            items,
 		Status:           "Ready",
+		PreparedBy:       &authUser.ID,
 		CreatedAt:        time.Now(),
 		UpdatedAt:        time.Now(),
 	}
 
-	_, err = db.Collection("delivery_receipts").
-		InsertOne(context.Background(), dr)
-
+	// The DR and the project's link to it are written together
+	dr.ID = primitive.NewObjectID()
+	err = database.WithTransaction(c, db, func(ctx context.Context) error {
+		if _, err := db.Collection("delivery_receipts").InsertOne(ctx, dr); err != nil {
+			return err
+		}
+		if projectID.IsZero() {
+			return nil
+		}
+		_, err := db.Collection("project").UpdateOne(ctx,
+			bson.M{"_id": projectID},
+			version.Bump(bson.M{"$set": bson.M{"sales_dr_id": dr.ID, "sales_invoice_id": invoiceID, "updated_at": time.Now()}}),
+		)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create DR"})
 		return
 	}
+	audit.Created(c, db, "delivery_receipts", dr.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Delivery receipt created successfully",
@@ -104,6 +138,7 @@ type DeliveryReceiptListResponse struct {
 	ID        primitive.ObjectID `bson:"_id" json:"id"`
 	DRNumber  string             `bson:"dr_number" json:"dr_number"`
 	Status    string             `bson:"status" json:"status"`
+	Version   int64              `bson:"version" json:"version"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
 	Project   struct {
@@ -127,6 +162,20 @@ type DeliveryReceiptListResponse struct {
 	} `bson:"customer" json:"customer"`
 }
 
+var deliveryReceiptList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"dr_number":     {Sort: true},
+		"status":        {Sort: true},
+		"project":       {Path: "project_id", Kind: listquery.ObjectID},
+		"customer":      {Path: "customer_id", Kind: listquery.ObjectID},
+		"sales_order":   {Path: "sales_order_id", Kind: listquery.ObjectID},
+		"sales_invoice": {Path: "sales_invoice_id", Kind: listquery.ObjectID},
+		"created_at":    {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"dr_number", "customer_name", "customer_org", "items.sku"},
+	Sort:   "-created_at",
+}
+
 func GetAllDeliveryReceipts(c *gin.Context, db *mongo.Database) {
 	// Auth
 	user, exists := c.Get("user")
@@ -139,31 +188,18 @@ func GetAllDeliveryReceipts(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Pagination
-	page := int64(1)
-	limit := int64(10)
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
+	if !permission.Authorize(c, db, permission.ResourceDeliveryReceipt, permission.ActionView) {
+		return
 	}
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
-			limit = v
-		}
+
+	query, ok := listquery.Parse(c, deliveryReceiptList)
+	if !ok {
+		return
 	}
-	skip := (page - 1) * limit
 
 	collection := db.Collection("delivery_receipts")
 
-	pipeline := mongo.Pipeline{
-		// Sort by latest
-		{{Key: "$sort", Value: bson.M{"created_at": -1}}},
-
-		// Pagination
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
-
+	shape := mongo.Pipeline{
 		// Lookup Project
 		{{
 			Key: "$lookup",
@@ -207,6 +243,7 @@ func GetAllDeliveryReceipts(c *gin.Context, db *mongo.Database) {
 				"_id":        1,
 				"dr_number":  1,
 				"status":     1,
+				"version":    1,
 				"created_at": 1,
 				"updated_at": 1,
 
@@ -233,27 +270,14 @@ func GetAllDeliveryReceipts(c *gin.Context, db *mongo.Database) {
 		}},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var receipts []DeliveryReceiptListResponse
+	page, err := query.Run(c, collection, &receipts, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch delivery receipts"})
 		return
 	}
-	defer cursor.Close(c)
-
-	var receipts []DeliveryReceiptListResponse
-	if err := cursor.All(c, &receipts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode delivery receipts"})
-		return
-	}
-
-	total, _ := collection.CountDocuments(c, bson.M{})
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  receipts,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(receipts, page))
 }
 
 func GetDeliveryReceiptByID(c *gin.Context, db *mongo.Database) {
@@ -267,6 +291,10 @@ func GetDeliveryReceiptByID(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceDeliveryReceipt, permission.ActionView) {
+		return
+	}
 	id := c.Param("id")
 	oid, err := primitive.ObjectIDFromHex(id)
 
@@ -277,7 +305,7 @@ func GetDeliveryReceiptByID(c *gin.Context, db *mongo.Database) {
 
 	var dr models.DeliveryReceipt
 	err = db.Collection("delivery_receipts").
-		FindOne(context.Background(), bson.M{"_id": oid}).
+		FindOne(context.Background(), trash.Live(bson.M{"_id": oid})).
 		Decode(&dr)
 
 	if err != nil {
@@ -285,6 +313,7 @@ func GetDeliveryReceiptByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	version.SetETag(c, dr.Version)
 	c.JSON(http.StatusOK, gin.H{"data": dr})
 }
 
@@ -294,11 +323,15 @@ func UpdateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	authUser, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceDeliveryReceipt, permission.ActionEdit) {
+		return
+	}
 	// Parse ID from URL
 	id := c.Param("id")
 	drID, err := primitive.ObjectIDFromHex(id)
@@ -308,43 +341,69 @@ func UpdateDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 	}
 
 	// Parse request body
-	var payload config.UpdateDeliveryReceiptPayload
+	var payload accountsreceivableconfig.UpdateDeliveryReceiptPayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	// Update in DB
 	update := bson.M{
 		"status":     payload.Status,
 		"updated_at": time.Now(),
 	}
 
-	_, err = db.Collection("delivery_receipts").UpdateOne(
+	// Whoever issues the DR signs it off as approver
+	if payload.Status == "Issued" {
+		var current models.DeliveryReceipt
+		err := db.Collection("delivery_receipts").FindOne(c, trash.Live(bson.M{"_id": drID})).Decode(&current)
+		if err == nil && current.Status != "Issued" {
+			update["approved_by"] = authUser.ID
+			update["approved_at"] = time.Now()
+		}
+	}
+
+	before := audit.Snapshot(c, db, "delivery_receipts", drID)
+	res, err := db.Collection("delivery_receipts").UpdateOne(
 		context.Background(),
-		bson.M{"_id": drID},
-		bson.M{"$set": update},
+		version.Filter(drID, expected),
+		version.Bump(bson.M{"$set": update}),
 	)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update delivery receipt"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		version.Conflict(c, db, "delivery_receipts", drID, "Delivery receipt not found")
+		return
+	}
+	audit.Updated(c, db, "delivery_receipts", drID, before)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Delivery receipt updated successfully"})
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery receipt updated successfully", "version": expected + 1})
 }
 
-func DeleteDeliveryReceipt(c *gin.Context, db *mongo.Database) {
+func DeleteDeliveryReceipt(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceDeliveryReceipt, permission.ActionDelete) {
+		return
+	}
 	// Parse ID from URL
 	id := c.Param("id")
 	drID, err := primitive.ObjectIDFromHex(id)
@@ -353,23 +412,73 @@ func DeleteDeliveryReceipt(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Perform delete
-	result, err := db.Collection("delivery_receipts").DeleteOne(
-		context.Background(),
-		bson.M{"_id": drID},
-	)
+	// Move to the trash
+	before := audit.Snapshot(c, db, "delivery_receipts", drID)
+	deleted, err := trash.Delete(c, db, cfg, "delivery_receipts", drID, userObj.ID)
+	if trash.Blocked(c, "Delivery receipt", err) {
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete delivery receipt"})
 		return
 	}
 
-	if result.DeletedCount == 0 {
+	if !deleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery receipt not found"})
 		return
 	}
 
+	audit.Changed(c, db, "delivery_receipts", drID, audit.ActionDelete, before)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Delivery receipt deleted successfully",
 	})
 }
+
+// DownloadDeliveryReceiptPDF renders the DR with the preparer and approver
+// names
+func DownloadDeliveryReceiptPDF(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	_, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	if !permission.Authorize(c, db, permission.ResourceDeliveryReceipt, permission.ActionView) {
+		return
+	}
+
+	oid, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid DR ID"})
+		return
+	}
+
+	var dr models.DeliveryReceipt
+	err = db.Collection("delivery_receipts").FindOne(c, trash.Live(bson.M{"_id": oid})).Decode(&dr)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery receipt not found"})
+		return
+	}
+
+	signatories := []reporthelper.Signatory{
+		profile.Signatory(c, db, "Prepared by", dr.PreparedBy, &dr.CreatedAt),
+		profile.Signatory(c, db, "Approved by", dr.ApprovedBy, dr.ApprovedAt),
+	}
+
+	filePath, err := reporthelper.GenerateDeliveryReceiptPDF(cfg, dr, signatories)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+		return
+	}
+	defer os.Remove(filePath)
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", "attachment; filename="+dr.DRNumber+".pdf")
+	c.File(filePath)
+}
@@ -3,12 +3,19 @@ package salesinvoice
 import (
 	"context"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/accountsreceivable/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	accountsreceivableconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/accountsreceivable/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -26,6 +33,10 @@ func GetCustomerByProjectID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionLookup) {
+		return
+	}
+
 	projectID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(projectID)
 	if err != nil {
@@ -35,7 +46,7 @@ func GetCustomerByProjectID(c *gin.Context, db *mongo.Database) {
 
 	var project models.Project
 	err = db.Collection("project").
-		FindOne(c, bson.M{"_id": objID}).
+		FindOne(c, trash.Live(bson.M{"_id": objID})).
 		Decode(&project)
 
 	if err != nil {
@@ -45,7 +56,7 @@ func GetCustomerByProjectID(c *gin.Context, db *mongo.Database) {
 
 	var customer models.Customer
 	err = db.Collection("customer").
-		FindOne(c, bson.M{"_id": project.CustomerID}).
+		FindOne(c, trash.Live(bson.M{"_id": project.CustomerID})).
 		Decode(&customer)
 
 	if err != nil {
@@ -70,6 +81,10 @@ func GetInvoiceDetailsByProjectID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSalesInvoice, permission.ActionView) {
+		return
+	}
+
 	projectID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(projectID)
 	if err != nil {
@@ -83,6 +98,7 @@ func GetInvoiceDetailsByProjectID(c *gin.Context, db *mongo.Database) {
 	collection := db.Collection("sales_invoices")
 
 	pipeline := mongo.Pipeline{
+		trash.MatchLive,
 
 		{{Key: "$match", Value: bson.M{
 			"project_id": objID,
@@ -149,7 +165,7 @@ func GetInvoiceDetailsByProjectID(c *gin.Context, db *mongo.Database) {
 
 }
 
-func CreateSalesInvoice(c *gin.Context, db *mongo.Database) {
+func CreateSalesInvoice(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
@@ -161,7 +177,11 @@ func CreateSalesInvoice(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.CreateInvoicePayload
+	if !permission.Authorize(c, db, permission.ResourceSalesInvoice, permission.ActionCreate) {
+		return
+	}
+
+	var payload accountsreceivableconfig.CreateInvoicePayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -192,7 +212,7 @@ func CreateSalesInvoice(c *gin.Context, db *mongo.Database) {
 
 	for _, pItem := range payload.Items {
 		var inv models.PolarisInventory
-		err := collectionInventory.FindOne(context.Background(), bson.M{"sku": pItem.SKU}).Decode(&inv)
+		err := collectionInventory.FindOne(context.Background(), trash.Live(bson.M{"sku": pItem.SKU})).Decode(&inv)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "SKU not found", "sku": pItem.SKU})
 			return
@@ -210,8 +230,14 @@ func CreateSalesInvoice(c *gin.Context, db *mongo.Database) {
 		total += amount
 	}
 
+	invoiceNumber, err := sequence.Next(c, db, cfg, sequence.SalesInvoice)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invoice number"})
+		return
+	}
+
 	invoice := models.SalesInvoice{
-		InvoiceID:    "INV-" + time.Now().Format("20060102150405"),
+		InvoiceID:    invoiceNumber,
 		ProjectID:    projectID,
 		CustomerID:   customerID,
 		SalesOrderID: salesOrderID,
@@ -222,11 +248,14 @@ func CreateSalesInvoice(c *gin.Context, db *mongo.Database) {
 	}
 
 	collectionInvoices := db.Collection("sales_invoices")
-	_, err = collectionInvoices.InsertOne(context.Background(), invoice)
+	res, err := collectionInvoices.InsertOne(context.Background(), invoice)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invoice"})
 		return
 	}
+	invoice.ID = res.InsertedID.(primitive.ObjectID)
+	audit.Created(c, db, "sales_invoices", invoice.ID)
+	metrics.InvoicesCreated.Inc("sales")
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Sales invoice created successfully",
@@ -239,6 +268,7 @@ type SalesInvoiceListResponse struct {
 	InvoiceID    string             `bson:"invoice_id" json:"invoice_id"`
 	SalesOrderID string             `bson:"sales_order_id,omitempty" json:"sales_order_id,omitempty"`
 	Total        float64            `bson:"total_amount" json:"total_amount"`
+	Version      int64              `bson:"version" json:"version"`
 	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
 
 	Project struct {
@@ -252,6 +282,19 @@ type SalesInvoiceListResponse struct {
 	} `bson:"customer" json:"customer"`
 }
 
+var salesInvoiceList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"invoice_id":   {Sort: true},
+		"project":      {Path: "project_id", Kind: listquery.ObjectID},
+		"customer":     {Path: "customer_id", Kind: listquery.ObjectID},
+		"sales_order":  {Path: "sales_order_id", Kind: listquery.ObjectID},
+		"total_amount": {Kind: listquery.Number, Sort: true},
+		"created_at":   {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"invoice_id", "items.sku"},
+	Sort:   "-created_at",
+}
+
 func GetAllSalesInvoices(c *gin.Context, db *mongo.Database) {
 
 	// Auth
@@ -265,35 +308,18 @@ func GetAllSalesInvoices(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Pagination
-	page := int64(1)
-	limit := int64(10)
-
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
+	if !permission.Authorize(c, db, permission.ResourceSalesInvoice, permission.ActionView) {
+		return
 	}
 
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
-			limit = v
-		}
+	query, ok := listquery.Parse(c, salesInvoiceList)
+	if !ok {
+		return
 	}
 
-	skip := (page - 1) * limit
-
 	collection := db.Collection("sales_invoices")
 
-	pipeline := mongo.Pipeline{
-
-		// Sort newest first
-		{{Key: "$sort", Value: bson.M{"created_at": -1}}},
-
-		// Pagination
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
-
+	shape := mongo.Pipeline{
 		// Lookup Project
 		{{
 			Key: "$lookup",
@@ -356,6 +382,7 @@ func GetAllSalesInvoices(c *gin.Context, db *mongo.Database) {
 				"invoice_id":     1,
 				"sales_order_id": "$salesOrder.salesOrderId",
 				"total_amount":   1,
+				"version":        1,
 				"created_at":     1,
 				"project": bson.M{
 					"id":   "$project._id",
@@ -369,27 +396,14 @@ func GetAllSalesInvoices(c *gin.Context, db *mongo.Database) {
 		}},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var invoices []SalesInvoiceListResponse
+	page, err := query.Run(c, collection, &invoices, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
 		return
 	}
-	defer cursor.Close(c)
 
-	var invoices []SalesInvoiceListResponse
-	if err := cursor.All(c, &invoices); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode invoices"})
-		return
-	}
-
-	total, _ := collection.CountDocuments(c, bson.M{})
-
-	c.JSON(http.StatusOK, gin.H{
-		"data":  invoices,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(invoices, page))
 }
 
 func GetSalesInvoiceByID(c *gin.Context, db *mongo.Database) {
@@ -404,6 +418,10 @@ func GetSalesInvoiceByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSalesInvoice, permission.ActionView) {
+		return
+	}
+
 	invoiceID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(invoiceID)
 	if err != nil {
@@ -413,7 +431,7 @@ func GetSalesInvoiceByID(c *gin.Context, db *mongo.Database) {
 
 	var invoice models.SalesInvoice
 	err = db.Collection("sales_invoices").
-		FindOne(context.Background(), bson.M{"_id": objID}).
+		FindOne(context.Background(), trash.Live(bson.M{"_id": objID})).
 		Decode(&invoice)
 
 	if err != nil {
@@ -421,6 +439,7 @@ func GetSalesInvoiceByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	version.SetETag(c, invoice.Version)
 	c.JSON(http.StatusOK, gin.H{"data": invoice})
 }
 
@@ -436,6 +455,10 @@ func UpdateSalesInvoice(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSalesInvoice, permission.ActionEdit) {
+		return
+	}
+
 	invoiceID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(invoiceID)
 	if err != nil {
@@ -443,12 +466,17 @@ func UpdateSalesInvoice(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.CreateInvoicePayload
+	var payload accountsreceivableconfig.CreateInvoicePayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	// Prepare recalculated items
 	items := []models.InvoiceItemSales{}
 	total := 0.0
@@ -457,7 +485,7 @@ func UpdateSalesInvoice(c *gin.Context, db *mongo.Database) {
 
 	for _, pItem := range payload.Items {
 		var inv models.PolarisInventory
-		err := collectionInventory.FindOne(context.Background(), bson.M{"sku": pItem.SKU}).Decode(&inv)
+		err := collectionInventory.FindOne(context.Background(), trash.Live(bson.M{"sku": pItem.SKU})).Decode(&inv)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "SKU not found", "sku": pItem.SKU})
 			return
@@ -483,29 +511,40 @@ func UpdateSalesInvoice(c *gin.Context, db *mongo.Database) {
 		},
 	}
 
-	_, err = db.Collection("sales_invoices").
-		UpdateOne(context.Background(), bson.M{"_id": objID}, update)
+	before := audit.Snapshot(c, db, "sales_invoices", objID)
+	res, err := db.Collection("sales_invoices").
+		UpdateOne(context.Background(), version.Filter(objID, expected), version.Bump(update))
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invoice"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		version.Conflict(c, db, "sales_invoices", objID, "Invoice not found")
+		return
+	}
+	audit.Updated(c, db, "sales_invoices", objID, before)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Invoice updated successfully"})
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Invoice updated successfully", "version": expected + 1})
 }
 
-func DeleteSalesInvoice(c *gin.Context, db *mongo.Database) {
+func DeleteSalesInvoice(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSalesInvoice, permission.ActionDelete) {
+		return
+	}
+
 	invoiceID := c.Param("id")
 	objID, err := primitive.ObjectIDFromHex(invoiceID)
 	if err != nil {
@@ -513,13 +552,17 @@ func DeleteSalesInvoice(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	_, err = db.Collection("sales_invoices").
-		DeleteOne(context.Background(), bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "sales_invoices", objID)
+	_, err = trash.Delete(c, db, cfg, "sales_invoices", objID, userObj.ID)
+	if trash.Blocked(c, "Invoice", err) {
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invoice"})
 		return
 	}
+	audit.Changed(c, db, "sales_invoices", objID, audit.ActionDelete, before)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Invoice deleted successfully"})
 }
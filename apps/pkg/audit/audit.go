@@ -0,0 +1,306 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+// Fields that must never be copied into the audit log
+var redacted = map[string]bool{
+	"password":          true,
+	"twoFactor":         true,
+	"refreshTokenHash":  true,
+	"previousTokenHash": true,
+	"tokenHash":         true,
+	"keyHash":           true,
+	"nonceHash":         true,
+	"signature":         true, // image data, too large to diff
+}
+
+// Snapshot loads the current state of a document so it can be diffed after
+// the write. It returns nil when the document does not exist.
+func Snapshot(ctx context.Context, db *mongo.Database, collection string, id primitive.ObjectID) bson.M {
+	var doc bson.M
+	if err := db.Collection(collection).FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+// Created records a new document, read back from the database
+func Created(c *gin.Context, db *mongo.Database, collection string, id primitive.ObjectID) {
+	metrics.DocumentsCreated.Inc(collection)
+	Record(c, db, collection, id, ActionCreate, nil, Snapshot(c, db, collection, id))
+}
+
+// Updated records the difference between before and the document as it is now
+func Updated(c *gin.Context, db *mongo.Database, collection string, id primitive.ObjectID, before bson.M) {
+	Changed(c, db, collection, id, ActionUpdate, before)
+}
+
+// Changed is Updated with a more specific action such as approve
+func Changed(c *gin.Context, db *mongo.Database, collection string, id primitive.ObjectID, action string, before bson.M) {
+	Record(c, db, collection, id, action, before, Snapshot(c, db, collection, id))
+}
+
+// Record appends an audit entry for any action. Failures are logged and never
+// fail the request that made the change.
+func Record(c *gin.Context, db *mongo.Database, collection string, id primitive.ObjectID, action string, before, after bson.M) {
+	// Nothing existed before or after, e.g. an update that matched nothing
+	if before == nil && after == nil {
+		return
+	}
+
+	entry := models.AuditLog{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		Entity:    collection,
+		EntityID:  id,
+		Action:    action,
+		Changes:   Diff(before, after),
+		At:        time.Now(),
+	}
+	if value, ok := c.Get("user"); ok {
+		if user, ok := value.(*models.User); ok {
+			actorID := user.ID
+			entry.ActorID = &actorID
+			entry.ActorEmail = user.Email
+			entry.ActorName = user.FullName
+		}
+	}
+
+	insert(db, entry)
+}
+
+// RecordCommand audits a change made by a CLI command, where there is no
+// request or signed in user. The command name is stored as the route.
+func RecordCommand(db *mongo.Database, command, collection string, id primitive.ObjectID, action string, before, after bson.M) {
+	if before == nil && after == nil {
+		return
+	}
+
+	host, _ := os.Hostname()
+	insert(db, models.AuditLog{
+		IP:       host,
+		Method:   "CLI",
+		Route:    command,
+		Entity:   collection,
+		EntityID: id,
+		Action:   action,
+		Changes:  Diff(before, after),
+		At:       time.Now(),
+	})
+}
+
+func insert(db *mongo.Database, entry models.AuditLog) {
+	if _, err := db.Collection("auditlog").InsertOne(context.Background(), entry); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"entity":   entry.Entity,
+			"entityId": entry.EntityID.Hex(),
+			"action":   entry.Action,
+		}).Error("Failed to write audit log")
+	}
+}
+
+// Diff flattens both documents and returns the fields whose values differ,
+// sorted by field path
+func Diff(before, after bson.M) []models.AuditChange {
+	b := map[string]interface{}{}
+	a := map[string]interface{}{}
+	flatten("", before, b)
+	flatten("", after, a)
+
+	fields := map[string]bool{}
+	for k := range b {
+		fields[k] = true
+	}
+	for k := range a {
+		fields[k] = true
+	}
+
+	changes := []models.AuditChange{}
+	for field := range fields {
+		if field == "_id" {
+			continue
+		}
+		bv, aok := b[field]
+		av, bok := a[field]
+		if aok && bok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		changes = append(changes, models.AuditChange{Field: field, Before: bv, After: av})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func flatten(prefix string, doc interface{}, out map[string]interface{}) {
+	var m map[string]interface{}
+	switch v := doc.(type) {
+	case nil:
+		return
+	case bson.M:
+		m = v
+	case bson.D:
+		m = v.Map()
+	default:
+		out[prefix] = doc
+		return
+	}
+
+	for k, v := range m {
+		if redacted[k] {
+			continue
+		}
+		key := k
+		if prefix != "" {
+			key = strings.Join([]string{prefix, k}, ".")
+		}
+		switch v.(type) {
+		case bson.M, bson.D:
+			flatten(key, v, out)
+		default:
+			out[key] = v
+		}
+	}
+}
+
+// GetAuditLogs lists audit entries for super admins, newest first. Filters:
+// entity, entity_id, action, user (id or email), from and to (RFC 3339 or
+// YYYY-MM-DD; "to" dates include the whole day).
+func GetAuditLogs(c *gin.Context, db *mongo.Database) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok || !currentUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	page := int64(1)
+	limit := int64(20)
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
+			page = v
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 && v <= 100 {
+			limit = v
+		}
+	}
+
+	filter := bson.M{}
+	if entity := c.Query("entity"); entity != "" {
+		filter["entity"] = entity
+	}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		oid, err := primitive.ObjectIDFromHex(entityID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity_id"})
+			return
+		}
+		filter["entityId"] = oid
+	}
+	if actor := c.Query("user"); actor != "" {
+		if oid, err := primitive.ObjectIDFromHex(actor); err == nil {
+			filter["actorId"] = oid
+		} else {
+			filter["actorEmail"] = actor
+		}
+	}
+
+	at := bson.M{}
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseDate(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		at["$gte"] = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseDate(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		at["$lt"] = t
+	}
+	if len(at) > 0 {
+		filter["at"] = at
+	}
+
+	collection := db.Collection("auditlog")
+	opts := options.Find().
+		SetSort(bson.D{{Key: "at", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(c, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+	defer cursor.Close(c)
+
+	logs := []models.AuditLog{}
+	if err := cursor.All(c, &logs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode audit logs"})
+		return
+	}
+
+	total, _ := collection.CountDocuments(c, filter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  logs,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func parseDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
+}
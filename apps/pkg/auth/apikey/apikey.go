@@ -0,0 +1,377 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Keys look like plr_<prefix>_<secret>. The prefix is stored in clear so a
+// key can be found and recognised; the whole key is stored only as a hash.
+const (
+	KeyPrefix = "plr_"
+
+	// Writing lastUsedAt on every request is wasteful; once a minute is enough
+	touchInterval = time.Minute
+)
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+// IsKey reports whether a bearer credential is an API key rather than a JWT
+func IsKey(raw string) bool {
+	return strings.HasPrefix(raw, KeyPrefix)
+}
+
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func generate() (raw, prefix string, err error) {
+	id := make([]byte, 4)
+	if _, err = rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	prefix = KeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + secret, prefix, nil
+}
+
+// Authenticate resolves a raw API key to its key record and service
+// account. Unknown, revoked and expired keys all return ErrInvalidKey.
+func Authenticate(ctx context.Context, db *mongo.Database, raw string) (*models.APIKey, *models.User, error) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0]+"_" != KeyPrefix {
+		return nil, nil, ErrInvalidKey
+	}
+	prefix := KeyPrefix + parts[1]
+
+	var key models.APIKey
+	err := db.Collection("apikey").FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashKey(raw)), []byte(key.KeyHash)) != 1 {
+		return nil, nil, ErrInvalidKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	var user models.User
+	err = db.Collection("user").FindOne(ctx, bson.M{"_id": key.UserID, "isServiceAccount": true}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > touchInterval {
+		if _, err := db.Collection("apikey").UpdateByID(ctx, key.ID, bson.M{"$set": bson.M{"lastUsedAt": now}}); err != nil {
+			logrus.WithError(err).WithField("prefix", key.Prefix).Warn("Failed to update API key last used time")
+		}
+		key.LastUsedAt = &now
+	}
+
+	return &key, &user, nil
+}
+
+func superAdmin(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok || !currentUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return currentUser, true
+}
+
+// CreateServiceAccount adds a machine user bound to a role. It has no
+// password and can only authenticate with API keys.
+func CreateServiceAccount(c *gin.Context, db *mongo.Database) {
+	currentUser, ok := superAdmin(c)
+	if !ok {
+		return
+	}
+
+	var payload authconfig.ServiceAccountRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(payload.Name))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(payload.RoleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+	if err := db.Collection("role").FindOne(c, bson.M{"_id": roleID}).Err(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+
+	// Service accounts share the user collection, so the name must not
+	// collide with a real user's email
+	count, err := db.Collection("user").CountDocuments(c, bson.M{"email": name})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing accounts"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this name already exists"})
+		return
+	}
+
+	account := models.User{
+		ID:               primitive.NewObjectID(),
+		Email:            name,
+		Roles:            roleID,
+		Status:           "approved",
+		IsServiceAccount: true,
+	}
+	if _, err := db.Collection("user").InsertOne(c, account); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	audit.Created(c, db, "user", account.ID)
+	logrus.WithFields(logrus.Fields{"name": name, "by": currentUser.Email}).Info("Service account created")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Service account created",
+		"id":      account.ID.Hex(),
+	})
+}
+
+// GetServiceAccounts lists service accounts with their active key count
+func GetServiceAccounts(c *gin.Context, db *mongo.Database) {
+	if _, ok := superAdmin(c); !ok {
+		return
+	}
+
+	cursor, err := db.Collection("user").Find(c, bson.M{"isServiceAccount": true},
+		options.Find().SetSort(bson.D{{Key: "email", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service accounts"})
+		return
+	}
+	defer cursor.Close(c)
+
+	var accounts []models.User
+	if err := cursor.All(c, &accounts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode service accounts"})
+		return
+	}
+
+	now := time.Now()
+	data := make([]gin.H, 0, len(accounts))
+	for _, a := range accounts {
+		active, err := db.Collection("apikey").CountDocuments(c, bson.M{
+			"userId":    a.ID,
+			"revokedAt": bson.M{"$exists": false},
+			"$or": []bson.M{
+				{"expiresAt": bson.M{"$exists": false}},
+				{"expiresAt": bson.M{"$gt": now}},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count API keys"})
+			return
+		}
+		data = append(data, gin.H{
+			"id":          a.ID.Hex(),
+			"name":        a.Email,
+			"role_id":     a.Roles.Hex(),
+			"role_ids":    a.RoleHexes(),
+			"status":      a.Status,
+			"active_keys": active,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// CreateAPIKey issues a key for a service account. The raw key is only ever
+// returned here; afterwards just its prefix is known.
+func CreateAPIKey(c *gin.Context, db *mongo.Database) {
+	currentUser, ok := superAdmin(c)
+	if !ok {
+		return
+	}
+
+	var payload authconfig.APIKeyRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	accountID, err := primitive.ObjectIDFromHex(payload.ServiceAccountID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+	if err := db.Collection("user").FindOne(c, bson.M{"_id": accountID, "isServiceAccount": true}).Err(); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+
+	if payload.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days cannot be negative"})
+		return
+	}
+
+	var scopes map[string][]string
+	if payload.Scopes != nil {
+		scopes, err = permission.ValidateMatrix(payload.Scopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	raw, prefix, err := generate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	now := time.Now()
+	key := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		Name:      strings.TrimSpace(payload.Name),
+		Prefix:    prefix,
+		KeyHash:   hashKey(raw),
+		UserID:    accountID,
+		Scopes:    scopes,
+		CreatedBy: currentUser.ID,
+		CreatedAt: now,
+	}
+	if payload.ExpiresInDays > 0 {
+		expires := now.AddDate(0, 0, payload.ExpiresInDays)
+		key.ExpiresAt = &expires
+	}
+
+	if _, err := db.Collection("apikey").InsertOne(c, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	audit.Created(c, db, "apikey", key.ID)
+	logrus.WithFields(logrus.Fields{"prefix": prefix, "by": currentUser.Email}).Info("API key created")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key created. Store it now, it will not be shown again.",
+		"key":     raw,
+		"data":    key,
+	})
+}
+
+// GetAPIKeys lists keys, optionally for one service account
+func GetAPIKeys(c *gin.Context, db *mongo.Database) {
+	if _, ok := superAdmin(c); !ok {
+		return
+	}
+
+	filter := bson.M{}
+	if id := c.Query("service_account_id"); id != "" {
+		accountID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+			return
+		}
+		filter["userId"] = accountID
+	}
+
+	cursor, err := db.Collection("apikey").Find(c, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer cursor.Close(c)
+
+	keys := []models.APIKey{}
+	if err := cursor.All(c, &keys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// RevokeAPIKey disables a key immediately. The record is kept for the
+// audit trail.
+func RevokeAPIKey(c *gin.Context, db *mongo.Database) {
+	currentUser, ok := superAdmin(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "apikey", keyID)
+	res, err := db.Collection("apikey").UpdateOne(c,
+		bson.M{"_id": keyID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+
+	audit.Changed(c, db, "apikey", keyID, audit.ActionDelete, before)
+	logrus.WithFields(logrus.Fields{"id": keyID.Hex(), "by": currentUser.Email}).Info("API key revoked")
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
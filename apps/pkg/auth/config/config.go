@@ -8,14 +8,81 @@ type SignupRequest struct {
 type ApprovePayload struct {
 	UserID string `json:"user_id"`
 	RoleID string `json:"role_id"`
-	Action string `json:"action,omitempty"` // "approve" | "reject" | "deactivate"
+	// RoleIDs grants several roles at once; replaces the user's extra roles
+	RoleIDs []string `json:"role_ids,omitempty"`
+	Action  string   `json:"action,omitempty"` // "approve" | "reject" | "deactivate"
 }
 
 type RoleData struct {
-	Name  string   `json:"name" binding:"required"`
-	Menus []string `json:"menus"`
+	Name             string              `json:"name" binding:"required"`
+	Menus            []string            `json:"menus"`
+	Permissions      map[string][]string `json:"permissions,omitempty"` // resource -> actions
+	RequireTwoFactor bool                `json:"require_two_factor,omitempty"`
 }
 
 type GetRolePayload struct {
 	RoleID string `json:"role_id" binding:"required"`
 }
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP or recovery code
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // TOTP or recovery code
+}
+
+type UnlockAccountRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ServiceAccountRequest struct {
+	Name   string `json:"name" binding:"required"`
+	RoleID string `json:"role_id" binding:"required"`
+}
+
+type APIKeyRequest struct {
+	ServiceAccountID string              `json:"service_account_id" binding:"required"`
+	Name             string              `json:"name" binding:"required"`
+	Scopes           map[string][]string `json:"scopes,omitempty"`          // omitted: everything the role allows
+	ExpiresInDays    int                 `json:"expires_in_days,omitempty"` // 0: never expires
+}
+
+type InviteRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	RoleID string `json:"role_id" binding:"required"`
+}
+
+type AcceptInviteRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// UpdateProfileRequest edits the signed in user's profile. Omitted fields are
+// kept; an empty string clears the field.
+type UpdateProfileRequest struct {
+	FullName  *string `json:"full_name,omitempty"`
+	Position  *string `json:"position,omitempty"`
+	Phone     *string `json:"phone,omitempty"`
+	Signature *string `json:"signature,omitempty"` // data:image/png;base64,... or image/jpeg
+}
@@ -0,0 +1,399 @@
+package invite
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/password"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/jwthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/mailer"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+
+	defaultExpiry = 72 * time.Hour
+)
+
+func expiry(cfg config.Config) time.Duration {
+	if cfg.Invite.ExpiryHours > 0 {
+		return time.Duration(cfg.Invite.ExpiryHours) * time.Hour
+	}
+	return defaultExpiry
+}
+
+func superAdmin(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok || !currentUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return currentUser, true
+}
+
+// InviteUser creates an invitation with a pre-assigned role and emails the
+// link. A still-valid invite for the same email must be resent instead.
+func InviteUser(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	currentUser, ok := superAdmin(c)
+	if !ok {
+		return
+	}
+
+	var payload authconfig.InviteRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(payload.Email))
+
+	roleID, err := primitive.ObjectIDFromHex(payload.RoleID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+	if err := db.Collection("role").FindOne(c, bson.M{"_id": roleID}).Err(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if db.Collection("user").FindOne(c, bson.M{"email": email}).Err() == nil ||
+		db.Collection("pendinguser").FindOne(c, bson.M{"email": email, "status": "pending"}).Err() == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered or pending approval"})
+		return
+	}
+
+	now := time.Now()
+	invites := db.Collection("invite")
+	err = invites.FindOne(c, bson.M{
+		"email":     email,
+		"status":    StatusPending,
+		"expiresAt": bson.M{"$gt": now},
+	}).Err()
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "An invitation is already pending for this email, resend it instead"})
+		return
+	}
+
+	// Older expired invites for this email are superseded
+	_, _ = invites.UpdateMany(c,
+		bson.M{"email": email, "status": StatusPending},
+		bson.M{"$set": bson.M{"status": StatusRevoked, "revokedAt": now}},
+	)
+
+	inv := models.Invite{
+		ID:        primitive.NewObjectID(),
+		Email:     email,
+		RoleID:    roleID,
+		Status:    StatusPending,
+		InvitedBy: currentUser.ID,
+		CreatedAt: now,
+	}
+	link, err := prepare(cfg, &inv, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	if _, err := invites.InsertOne(c, inv); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+	audit.Created(c, db, "invite", inv.ID)
+
+	if err := send(c, cfg, inv, link); err != nil {
+		logrus.WithError(err).WithField("email", email).Error("Failed to send invitation email")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invitation created but the email could not be sent, try resending it"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Invitation sent",
+		"id":         inv.ID.Hex(),
+		"expires_at": inv.ExpiresAt,
+	})
+}
+
+// ResendInvite issues a fresh link with a new expiry. Links sent earlier for
+// the same invite stop working.
+func ResendInvite(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	if _, ok := superAdmin(c); !ok {
+		return
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	var inv models.Invite
+	invites := db.Collection("invite")
+	if err := invites.FindOne(c, bson.M{"_id": inviteID, "status": StatusPending}).Decode(&inv); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or no longer pending"})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "invite", inviteID)
+	link, err := prepare(cfg, &inv, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation link"})
+		return
+	}
+
+	_, err = invites.UpdateOne(c,
+		bson.M{"_id": inviteID, "status": StatusPending},
+		bson.M{"$set": bson.M{
+			"nonceHash": inv.NonceHash,
+			"sentAt":    inv.SentAt,
+			"sendCount": inv.SendCount,
+			"expiresAt": inv.ExpiresAt,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invitation"})
+		return
+	}
+	audit.Changed(c, db, "invite", inviteID, "resend", before)
+
+	if err := send(c, cfg, inv, link); err != nil {
+		logrus.WithError(err).WithField("email", inv.Email).Error("Failed to send invitation email")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Invitation resent",
+		"expires_at": inv.ExpiresAt,
+	})
+}
+
+// RevokeInvite cancels a pending invitation
+func RevokeInvite(c *gin.Context, db *mongo.Database) {
+	if _, ok := superAdmin(c); !ok {
+		return
+	}
+
+	inviteID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "invite", inviteID)
+	res, err := db.Collection("invite").UpdateOne(c,
+		bson.M{"_id": inviteID, "status": StatusPending},
+		bson.M{"$set": bson.M{"status": StatusRevoked, "revokedAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found or no longer pending"})
+		return
+	}
+	audit.Changed(c, db, "invite", inviteID, "revoke", before)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// GetInvite lets the accept page show who is being invited before the
+// password is chosen
+func GetInvite(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	inv, ok := lookup(c, db, cfg, c.Query("token"))
+	if !ok {
+		return
+	}
+
+	roleName := ""
+	var role models.Role
+	if err := db.Collection("role").FindOne(c, bson.M{"_id": inv.RoleID}).Decode(&role); err == nil {
+		roleName = role.Name
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      inv.Email,
+		"role":       roleName,
+		"expires_at": inv.ExpiresAt,
+	})
+}
+
+// AcceptInvite sets the invitee's password and creates the active user with
+// the invited role. The invite can only be accepted once.
+func AcceptInvite(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var payload authconfig.AcceptInviteRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inv, ok := lookup(c, db, cfg, payload.Token)
+	if !ok {
+		return
+	}
+
+	if err := password.Validate(cfg, payload.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if db.Collection("user").FindOne(c, bson.M{"email": inv.Email}).Err() == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	// Claim the invite first so a double submit cannot create two users
+	now := time.Now()
+	before := audit.Snapshot(c, db, "invite", inv.ID)
+	res, err := db.Collection("invite").UpdateOne(c,
+		bson.M{"_id": inv.ID, "status": StatusPending, "nonceHash": inv.NonceHash},
+		bson.M{"$set": bson.M{"status": StatusAccepted, "acceptedAt": now}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if res.ModifiedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation link is invalid or has expired"})
+		return
+	}
+	audit.Changed(c, db, "invite", inv.ID, audit.ActionApprove, before)
+
+	newUser := models.User{
+		Email:             inv.Email,
+		Password:          string(hashed),
+		Roles:             inv.RoleID,
+		Status:            "active",
+		PasswordChangedAt: &now,
+	}
+	insert, err := db.Collection("user").InsertOne(c, newUser)
+	if err != nil {
+		// Give the invite back so the link can be used again
+		_, _ = db.Collection("invite").UpdateOne(c,
+			bson.M{"_id": inv.ID},
+			bson.M{"$set": bson.M{"status": StatusPending}, "$unset": bson.M{"acceptedAt": ""}},
+		)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+	audit.Created(c, db, "user", insert.InsertedID.(primitive.ObjectID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account created. Please sign in."})
+}
+
+// lookup resolves a link token to its pending invite, writing the error
+// response itself when the link is unusable
+func lookup(c *gin.Context, db *mongo.Database, cfg config.Config, token string) (*models.Invite, bool) {
+	const invalid = "Invitation link is invalid or has expired"
+
+	id, nonce, err := jwthelper.ParseInviteToken(cfg, token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid})
+		return nil, false
+	}
+	inviteID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid})
+		return nil, false
+	}
+
+	var inv models.Invite
+	err = db.Collection("invite").FindOne(c, bson.M{
+		"_id":       inviteID,
+		"status":    StatusPending,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&inv)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashNonce(nonce)), []byte(inv.NonceHash)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid})
+		return nil, false
+	}
+	return &inv, true
+}
+
+// prepare gives the invite a new nonce and expiry and returns the signed
+// link that carries them
+func prepare(cfg config.Config, inv *models.Invite, now time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	inv.NonceHash = hashNonce(nonce)
+	inv.ExpiresAt = now.Add(expiry(cfg))
+	inv.SentAt = now
+	inv.SendCount++
+
+	token, err := jwthelper.GenerateInviteToken(cfg, inv.ID.Hex(), nonce, inv.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+	return acceptLink(cfg, token), nil
+}
+
+func send(c *gin.Context, cfg config.Config, inv models.Invite, link string) error {
+	sender, err := mailer.New(cfg)
+	if err != nil {
+		return err
+	}
+	return sender.Send(c, mailer.Message{
+		To:      inv.Email,
+		Subject: "You're invited to Polaris",
+		Body: fmt.Sprintf("You have been invited to the Polaris Prime Air Tech portal.\n\n"+
+			"Open the link below to set your password and activate your account. "+
+			"It expires on %s.\n\n%s\n",
+			inv.ExpiresAt.Format("Jan 2, 2006 15:04 MST"), link),
+	})
+}
+
+func acceptLink(cfg config.Config, token string) string {
+	base := cfg.Invite.AcceptURL
+	if base == "" {
+		base = "http://localhost:3000/accept-invite"
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,335 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeLocked  = "locked"
+
+	// Failures older than this stop counting once any lockout has passed
+	window = 15 * time.Minute
+)
+
+type policy struct {
+	maxAttempts   int
+	ipMaxAttempts int
+	baseLockout   time.Duration
+	maxLockout    time.Duration
+}
+
+func loadPolicy(cfg config.Config) policy {
+	p := policy{
+		maxAttempts:   5,
+		ipMaxAttempts: 20,
+		baseLockout:   time.Minute,
+		maxLockout:    time.Hour,
+	}
+
+	if cfg.LoginGuard.MaxAttempts > 0 {
+		p.maxAttempts = cfg.LoginGuard.MaxAttempts
+	}
+	if cfg.LoginGuard.IPMaxAttempts > 0 {
+		p.ipMaxAttempts = cfg.LoginGuard.IPMaxAttempts
+	}
+	if cfg.LoginGuard.BaseLockoutSeconds > 0 {
+		p.baseLockout = time.Duration(cfg.LoginGuard.BaseLockoutSeconds) * time.Second
+	}
+	if cfg.LoginGuard.MaxLockoutMinutes > 0 {
+		p.maxLockout = time.Duration(cfg.LoginGuard.MaxLockoutMinutes) * time.Minute
+	}
+	return p
+}
+
+// lockout doubles for every failure past the limit
+func (p policy) lockout(failures, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	factor := math.Pow(2, float64(failures-limit))
+	d := time.Duration(float64(p.baseLockout) * factor)
+	if d <= 0 || d > p.maxLockout {
+		return p.maxLockout
+	}
+	return d
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the account or client must still wait. Zero means
+// the attempt may go ahead.
+func Check(ctx context.Context, db *mongo.Database, email, ip string) (time.Duration, error) {
+	now := time.Now()
+	cursor, err := db.Collection("loginthrottle").Find(ctx, bson.M{
+		"key":         bson.M{"$in": []string{emailKey(email), ipKey(ip)}},
+		"lockedUntil": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var throttles []models.LoginThrottle
+	if err := cursor.All(ctx, &throttles); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, t := range throttles {
+		if d := t.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed attempt against the account and the client
+// and returns the lockout it triggered, if any
+func RecordFailure(c *gin.Context, db *mongo.Database, cfg config.Config, email, reason string) (time.Duration, error) {
+	Record(c, db, email, OutcomeFailure, reason)
+
+	p := loadPolicy(cfg)
+	emailLock, err := registerFailure(c, db, p, emailKey(email), p.maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	ipLock, err := registerFailure(c, db, p, ipKey(c.ClientIP()), p.ipMaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	lock := emailLock
+	if ipLock > lock {
+		lock = ipLock
+	}
+	if lock > 0 {
+		logrus.WithFields(logrus.Fields{
+			"email":   email,
+			"ip":      c.ClientIP(),
+			"lockout": lock.String(),
+		}).Warn("Sign in locked after repeated failures")
+	}
+	return lock, nil
+}
+
+// RecordSuccess clears the account's failure count and logs the sign in
+func RecordSuccess(c *gin.Context, db *mongo.Database, email string) {
+	Record(c, db, email, OutcomeSuccess, "")
+	if _, err := db.Collection("loginthrottle").DeleteOne(c, bson.M{"key": emailKey(email)}); err != nil {
+		logrus.WithError(err).Error("Failed to reset login throttle")
+	}
+}
+
+// Record appends an entry to the login attempt log
+func Record(c *gin.Context, db *mongo.Database, email, outcome, reason string) {
+	_, err := db.Collection("loginattempt").InsertOne(c, models.LoginAttempt{
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Outcome:   outcome,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to record login attempt")
+	}
+}
+
+// Reject writes the 429 response for a locked account or client
+func Reject(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       fmt.Sprintf("Too many failed sign in attempts. Try again in %s.", humanize(wait)),
+		"retry_after": seconds,
+	})
+}
+
+func registerFailure(ctx context.Context, db *mongo.Database, p policy, key string, limit int) (time.Duration, error) {
+	collection := db.Collection("loginthrottle")
+	now := time.Now()
+
+	// Start over when the last failure is old and no lockout is running
+	_, err := collection.UpdateOne(ctx,
+		bson.M{
+			"key":           key,
+			"lastFailureAt": bson.M{"$lt": now.Add(-window)},
+			"$or": bson.A{
+				bson.M{"lockedUntil": bson.M{"$exists": false}},
+				bson.M{"lockedUntil": bson.M{"$lt": now}},
+			},
+		},
+		bson.M{"$set": bson.M{"failures": 0}, "$unset": bson.M{"lockedUntil": ""}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var throttle models.LoginThrottle
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"key": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"lastFailureAt": now, "expiresAt": now.Add(window + p.maxLockout)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&throttle)
+	if err != nil {
+		return 0, err
+	}
+
+	lock := p.lockout(throttle.Failures, limit)
+	if lock == 0 {
+		return 0, nil
+	}
+
+	until := now.Add(lock)
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"key": key},
+		bson.M{"$set": bson.M{"lockedUntil": until, "expiresAt": until.Add(window)}},
+	)
+	return lock, err
+}
+
+func humanize(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d seconds", int(math.Ceil(d.Seconds())))
+	}
+	minutes := int(math.Ceil(d.Minutes()))
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// UnlockAccount lets a super admin clear an account's lockout
+func UnlockAccount(c *gin.Context, db *mongo.Database) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok || !currentUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	var payload authconfig.UnlockAccountRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Collection("loginthrottle").DeleteOne(c, bson.M{"key": emailKey(payload.Email)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"email": payload.Email,
+		"by":    currentUser.Email,
+	}).Info("Account unlocked")
+
+	var target models.User
+	if err := db.Collection("user").FindOne(c, bson.M{"email": payload.Email}).Decode(&target); err == nil {
+		audit.Record(c, db, "user", target.ID, "unlock", nil, bson.M{"email": target.Email})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Account unlocked",
+		"was_locked": res.DeletedCount > 0,
+	})
+}
+
+// GetLoginAttempts lists the login attempt log for super admins, newest
+// first, filtered by email, ip or outcome
+func GetLoginAttempts(c *gin.Context, db *mongo.Database) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok || !currentUser.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	page := int64(1)
+	limit := int64(20)
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
+			page = v
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 && v <= 100 {
+			limit = v
+		}
+	}
+
+	filter := bson.M{}
+	if email := c.Query("email"); email != "" {
+		filter["email"] = strings.ToLower(strings.TrimSpace(email))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		filter["ip"] = ip
+	}
+	if outcome := c.Query("outcome"); outcome != "" {
+		filter["outcome"] = outcome
+	}
+
+	collection := db.Collection("loginattempt")
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(c, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login attempts"})
+		return
+	}
+	defer cursor.Close(c)
+
+	attempts := []models.LoginAttempt{}
+	if err := cursor.All(c, &attempts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode login attempts"})
+		return
+	}
+
+	total, _ := collection.CountDocuments(c, filter)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  attempts,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
@@ -0,0 +1,242 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/session"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/mailer"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultResetTokenTTL = 30 * time.Minute
+
+// ChangePassword lets a signed-in user replace their password. Every other
+// session of the user is signed out.
+func ChangePassword(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	userObj, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	var payload authconfig.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(userObj.Password), []byte(payload.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if payload.CurrentPassword == payload.NewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different from the current one"})
+		return
+	}
+
+	if err := Validate(cfg, payload.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "user", userObj.ID)
+	if err := setPassword(c, db, userObj.ID, payload.NewPassword); err != nil {
+		logrus.WithError(err).Error("Failed to change password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+	audit.Changed(c, db, "user", userObj.ID, "change_password", before)
+
+	if sessionID, ok := c.Get("sessionID"); ok {
+		if err := session.RevokeOthers(c, db, userObj.ID, sessionID.(primitive.ObjectID)); err != nil {
+			logrus.WithError(err).Error("Failed to revoke other sessions after password change")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ForgotPassword emails a single-use reset link. The response is the same
+// whether or not the email exists, so it cannot be used to probe accounts.
+func ForgotPassword(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var payload authconfig.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	const message = "If the email is registered, a reset link has been sent."
+
+	var user models.User
+	err := db.Collection("user").FindOne(c, bson.M{"email": payload.Email}).Decode(&user)
+	if err != nil || user.Status == "suspended" {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	sender, err := mailer.New(cfg)
+	if err != nil {
+		logrus.WithError(err).Error("Mail sender is not configured")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset email"})
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	ttl := defaultResetTokenTTL
+	if cfg.Password.ResetTokenMinutes > 0 {
+		ttl = time.Duration(cfg.Password.ResetTokenMinutes) * time.Minute
+	}
+
+	resets := db.Collection("passwordreset")
+	now := time.Now()
+
+	// Only the newest link works
+	_, _ = resets.UpdateMany(c,
+		bson.M{"userId": user.ID, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	)
+
+	_, err = resets.InsertOne(c, models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	err = sender.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Polaris password",
+		Body: fmt.Sprintf("A password reset was requested for your account.\n\n"+
+			"Open the link below within %d minutes to choose a new password:\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n",
+			int(ttl.Minutes()), resetLink(cfg, token)),
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("email", user.Email).Error("Failed to send reset email")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// ResetPassword consumes a reset token and sets the new password. All of the
+// user's sessions are revoked.
+func ResetPassword(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var payload authconfig.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := Validate(cfg, payload.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Mark the token used in the same step that finds it, so it works once
+	now := time.Now()
+	var reset models.PasswordReset
+	err := db.Collection("passwordreset").FindOneAndUpdate(c,
+		bson.M{
+			"tokenHash": hashToken(payload.Token),
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&reset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset link is invalid or has expired"})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "user", reset.UserID)
+	if err := setPassword(c, db, reset.UserID, payload.NewPassword); err != nil {
+		logrus.WithError(err).Error("Failed to reset password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	audit.Changed(c, db, "user", reset.UserID, "reset_password", before)
+
+	if _, err := session.RevokeAllForUser(c, db, reset.UserID); err != nil {
+		logrus.WithError(err).Error("Failed to revoke sessions after password reset")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. Please sign in."})
+}
+
+func setPassword(c *gin.Context, db *mongo.Database, userID primitive.ObjectID, pw string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	res, err := db.Collection("user").UpdateOne(c,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"password": string(hashed), "passwordChangedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func resetLink(cfg config.Config, token string) string {
+	base := cfg.Password.ResetURL
+	if base == "" {
+		base = "http://localhost:3000/reset-password"
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
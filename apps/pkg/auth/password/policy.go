@@ -0,0 +1,62 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+)
+
+const defaultMinLength = 8
+
+// Validate checks a new password against the policy in env.yaml and returns
+// a message suitable for the client when it does not comply
+func Validate(cfg config.Config, pw string) error {
+	policy := cfg.Password
+
+	minLength := policy.MinLength
+	if minLength <= 0 {
+		minLength = defaultMinLength
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if policy.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+
+	if len([]rune(pw)) < minLength {
+		return fmt.Errorf("password must be at least %d characters", minLength)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("password must contain %s", strings.Join(missing, ", "))
+	}
+	// bcrypt ignores everything past 72 bytes
+	if len(pw) > 72 {
+		return fmt.Errorf("password must be at most 72 bytes")
+	}
+	return nil
+}
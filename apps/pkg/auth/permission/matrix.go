@@ -0,0 +1,299 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Actions a role can be granted on a resource.
+const (
+	ActionView    = "view"
+	ActionCreate  = "create"
+	ActionEdit    = "edit"
+	ActionApprove = "approve"
+	ActionDelete  = "delete"
+	// ActionLookup reads the list that feeds a dropdown on another screen
+	ActionLookup = "lookup"
+)
+
+// Resources covered by the role permission matrix.
+const (
+	ResourceDashboard       = "dashboard"
+	ResourceCustomer        = "customer"
+	ResourceProject         = "project"
+	ResourceSalesOrder      = "salesorder"
+	ResourceSupplierPO      = "supplierpo"
+	ResourceSupplier        = "supplier"
+	ResourceInventory       = "inventory"
+	ResourceSupplierDR      = "supplierdr"
+	ResourceSupplierInvoice = "supplierinvoice"
+	ResourceReceivingReport = "receivingreport"
+	ResourceSalesInvoice    = "salesinvoice"
+	ResourceDeliveryReceipt = "deliveryreceipt"
+	ResourceReport          = "report"
+)
+
+// Resource describes one row of the permission matrix.
+type Resource struct {
+	Name    string   `json:"name"`
+	Menu    string   `json:"menu"`
+	Actions []string `json:"actions"`
+}
+
+var crud = []string{ActionView, ActionCreate, ActionEdit, ActionDelete}
+var crudLookup = []string{ActionView, ActionCreate, ActionEdit, ActionDelete, ActionLookup}
+var crudApproveLookup = []string{ActionView, ActionCreate, ActionEdit, ActionApprove, ActionDelete, ActionLookup}
+
+// Catalog lists every resource, the menu it lives under and the actions that
+// can be granted on it.
+var Catalog = []Resource{
+	{Name: ResourceDashboard, Menu: Dashboard, Actions: []string{ActionView}},
+	{Name: ResourceCustomer, Menu: Customers, Actions: crudLookup},
+	{Name: ResourceProject, Menu: Projects, Actions: crudLookup},
+	{Name: ResourceSalesOrder, Menu: SalesOrders, Actions: crudApproveLookup},
+	{Name: ResourceSupplierPO, Menu: PurchaseOrders, Actions: crudApproveLookup},
+	{Name: ResourceSupplier, Menu: Warehousing, Actions: crudLookup},
+	{Name: ResourceInventory, Menu: Warehousing, Actions: crudLookup},
+	{Name: ResourceSupplierDR, Menu: Warehousing, Actions: crud},
+	{Name: ResourceSupplierInvoice, Menu: Warehousing, Actions: crud},
+	{Name: ResourceReceivingReport, Menu: Warehousing, Actions: crud},
+	{Name: ResourceSalesInvoice, Menu: AccountsReceivable, Actions: crud},
+	{Name: ResourceDeliveryReceipt, Menu: AccountsReceivable, Actions: crud},
+	{Name: ResourceReport, Menu: GenerateReports, Actions: []string{ActionView}},
+}
+
+// Lookups lists, for each resource offered in dropdowns, the menus of the
+// screens that show those dropdowns. Viewing the resource itself, or any
+// resource under one of these menus, implies the lookup action on it.
+var Lookups = map[string][]string{
+	ResourceCustomer:   {Customers, Projects, SalesOrders, AccountsReceivable},
+	ResourceProject:    {Projects, SalesOrders, PurchaseOrders, Warehousing, AccountsReceivable},
+	ResourceSalesOrder: {SalesOrders, PurchaseOrders, Warehousing, AccountsReceivable},
+	ResourceSupplierPO: {PurchaseOrders, Warehousing},
+	ResourceSupplier:   {Warehousing, PurchaseOrders},
+	ResourceInventory:  {Warehousing, AccountsReceivable},
+}
+
+// impliesLookup reports whether matrix allows looking up resource, either
+// directly or through view on the resource or on a screen that picks it
+func impliesLookup(matrix map[string][]string, resource string) bool {
+	if contains(matrix[resource], ActionLookup) || contains(matrix[resource], ActionView) {
+		return true
+	}
+	for _, r := range Catalog {
+		if contains(Lookups[resource], r.Menu) && contains(matrix[r.Name], ActionView) {
+			return true
+		}
+	}
+	return false
+}
+
+func lookup(resource string) (Resource, bool) {
+	for _, r := range Catalog {
+		if r.Name == resource {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// ValidateMatrix checks that every resource and action in the matrix exists in
+// the catalog and returns a copy without duplicate actions.
+func ValidateMatrix(matrix map[string][]string) (map[string][]string, error) {
+	clean := make(map[string][]string, len(matrix))
+	for resource, actions := range matrix {
+		r, ok := lookup(resource)
+		if !ok {
+			return nil, fmt.Errorf("unknown resource %q", resource)
+		}
+
+		seen := make(map[string]bool)
+		granted := []string{}
+		for _, action := range actions {
+			if !contains(r.Actions, action) {
+				return nil, fmt.Errorf("action %q is not available on %q", action, resource)
+			}
+			if !seen[action] {
+				seen[action] = true
+				granted = append(granted, action)
+			}
+		}
+		clean[resource] = granted
+	}
+	return clean, nil
+}
+
+// Can reports whether the user may perform action on resource. Super admins can
+// do everything. Roles without a permission matrix fall back to their menus,
+// where a granted menu allows every action on the resources behind it.
+func Can(ctx context.Context, db *mongo.Database, user *models.User, resource, action string) (bool, error) {
+	if user.IsSuperAdmin {
+		return true, nil
+	}
+
+	r, ok := lookup(resource)
+	if !ok || !contains(r.Actions, action) {
+		return false, nil
+	}
+
+	matrix, err := EffectiveMatrix(ctx, db, user)
+	if err != nil {
+		return false, err
+	}
+	return contains(matrix[resource], action), nil
+}
+
+// EffectiveMatrix returns the actions the user holds on every resource across
+// all of their roles, in the same shape as models.Role.Permissions.
+func EffectiveMatrix(ctx context.Context, db *mongo.Database, user *models.User) (map[string][]string, error) {
+	matrix := make(map[string][]string)
+
+	if user.IsSuperAdmin {
+		for _, r := range Catalog {
+			matrix[r.Name] = r.Actions
+		}
+		return matrix, nil
+	}
+	roles, err := UserRoles(ctx, db, user)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make(map[string]map[string]bool)
+	grant := func(resource, action string) {
+		if granted[resource] == nil {
+			granted[resource] = make(map[string]bool)
+		}
+		granted[resource][action] = true
+	}
+
+	// Legacy roles without a matrix grant every action under their menus
+	var legacyMenus []primitive.ObjectID
+	for _, role := range roles {
+		if role.Permissions == nil {
+			legacyMenus = append(legacyMenus, role.Menus...)
+			continue
+		}
+		for resource, actions := range role.Permissions {
+			for _, action := range actions {
+				grant(resource, action)
+			}
+		}
+	}
+	menus, err := menuHrefs(ctx, db, legacyMenus)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the catalog so the result keeps its order and only valid actions
+	for _, r := range Catalog {
+		for _, action := range r.Actions {
+			if menus[r.Menu] || granted[r.Name][action] {
+				matrix[r.Name] = append(matrix[r.Name], action)
+			}
+		}
+	}
+	for resource := range Lookups {
+		if !contains(matrix[resource], ActionLookup) && impliesLookup(matrix, resource) {
+			matrix[resource] = append(matrix[resource], ActionLookup)
+		}
+	}
+	return matrix, nil
+}
+
+func menuHrefs(ctx context.Context, db *mongo.Database, ids []primitive.ObjectID) (map[string]bool, error) {
+	hrefs := make(map[string]bool)
+	if len(ids) == 0 {
+		return hrefs, nil
+	}
+
+	cursor, err := db.Collection("menu").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var menus []models.Menu
+	if err := cursor.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+	for _, m := range menus {
+		hrefs[m.Href] = true
+	}
+	return hrefs, nil
+}
+
+// ScopesKey is the gin context key holding the scope matrix of the API key
+// that authenticated the request, if any
+const ScopesKey = "apiKeyScopes"
+
+// Authorize checks the authenticated user from the gin context against the
+// permission matrix. On denial it writes a 403 response, logs the attempt and
+// returns false, so handlers can simply return.
+func Authorize(c *gin.Context, db *mongo.Database, resource, action string) bool {
+	value, _ := c.Get("user")
+	user, ok := value.(*models.User)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return false
+	}
+
+	allowed, err := Allowed(c, db, user, resource, action)
+	if err != nil {
+		logrus.WithError(err).WithField("email", user.Email).Error("Failed to resolve role permissions")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+
+	if !allowed {
+		logrus.WithFields(logrus.Fields{
+			"email":    user.Email,
+			"roles":    user.RoleHexes(),
+			"method":   c.Request.Method,
+			"route":    c.FullPath(),
+			"resource": resource,
+			"action":   action,
+		}).Warn("Permission denied")
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("You do not have permission to %s %s", action, resource),
+		})
+		return false
+	}
+
+	return true
+}
+
+// Allowed is the check Authorize makes, without answering the request. It
+// also applies the scopes of the API key that authenticated it, if any.
+func Allowed(c *gin.Context, db *mongo.Database, user *models.User, resource, action string) (bool, error) {
+	allowed, err := Can(c, db, user, resource, action)
+	if err != nil || !allowed {
+		return false, err
+	}
+
+	// API keys may be scoped below their service account's role
+	if scopes, ok := c.Get(ScopesKey); ok {
+		matrix, _ := scopes.(map[string][]string)
+		if matrix != nil && !contains(matrix[resource], action) && !(action == ActionLookup && impliesLookup(matrix, resource)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
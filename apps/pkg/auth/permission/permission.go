@@ -0,0 +1,105 @@
+package permission
+
+import (
+	"context"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Menu hrefs seeded by database.SeedMenus. The API routes behind a screen are
+// guarded by its menu: open to anyone holding an action on a resource under
+// it in the permission matrix.
+const (
+	Dashboard          = "/dashboard"
+	Customers          = "/customers"
+	Projects           = "/projects"
+	SalesOrders        = "/sales-orders"
+	PurchaseOrders     = "/purchase-orders"
+	Warehousing        = "/warehousing"
+	AccountsReceivable = "/accounts-receivable"
+	GenerateReports    = "/generate-reports"
+	Settings           = "/settings"
+)
+
+// UserRoles loads every role assigned to the user. Roles that no longer
+// exist are skipped.
+func UserRoles(ctx context.Context, db *mongo.Database, user *models.User) ([]models.Role, error) {
+	ids := user.AllRoleIDs()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.Collection("role").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var roles []models.Role
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// HasAnyMenu reports whether the user may reach the screen of at least one
+// of the given menus: their effective matrix holds some action on a resource
+// under it. Menus with no resources in the catalog, like settings, are
+// granted by the role's menus. Super admins are granted every menu.
+func HasAnyMenu(ctx context.Context, db *mongo.Database, user *models.User, menus ...string) (bool, error) {
+	if user.IsSuperAdmin {
+		return true, nil
+	}
+	if len(menus) == 0 {
+		return false, nil
+	}
+
+	matrix, err := EffectiveMatrix(ctx, db, user)
+	if err != nil {
+		return false, err
+	}
+	var outside []string
+	for _, menu := range menus {
+		covered := false
+		for _, r := range Catalog {
+			if r.Menu != menu {
+				continue
+			}
+			covered = true
+			if len(matrix[r.Name]) > 0 {
+				return true, nil
+			}
+		}
+		if !covered {
+			outside = append(outside, menu)
+		}
+	}
+	if len(outside) == 0 {
+		return false, nil
+	}
+
+	roles, err := UserRoles(ctx, db, user)
+	if err != nil {
+		return false, err
+	}
+	var menuIDs []primitive.ObjectID
+	for _, role := range roles {
+		menuIDs = append(menuIDs, role.Menus...)
+	}
+	if len(menuIDs) == 0 {
+		return false, nil
+	}
+
+	count, err := db.Collection("menu").CountDocuments(ctx, bson.M{
+		"_id":  bson.M{"$in": menuIDs},
+		"href": bson.M{"$in": outside},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
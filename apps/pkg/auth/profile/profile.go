@@ -0,0 +1,200 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/reporthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxNameLength = 100
+	// Signatures are small scans; anything bigger would bloat every user read
+	maxSignatureBytes = 200 * 1024
+)
+
+// GetMyProfile returns the signed in user's profile with their role names
+func GetMyProfile(c *gin.Context, db *mongo.Database) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	roles, err := permission.UserRoles(c, db, currentUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		return
+	}
+	roleNames := make([]string, 0, len(roles))
+	for _, r := range roles {
+		roleNames = append(roleNames, r.Name)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"id":               currentUser.ID.Hex(),
+		"email":            currentUser.Email,
+		"fullName":         currentUser.FullName,
+		"position":         currentUser.Position,
+		"phone":            currentUser.Phone,
+		"signature":        currentUser.Signature,
+		"roles":            roleNames,
+		"isSuperAdmin":     currentUser.IsSuperAdmin,
+		"twoFactorEnabled": currentUser.TwoFactor.Enabled,
+	}})
+}
+
+// UpdateMyProfile edits the signed in user's own profile fields
+func UpdateMyProfile(c *gin.Context, db *mongo.Database) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	currentUser, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	var payload authconfig.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	text := map[string]*string{
+		"fullName": payload.FullName,
+		"position": payload.Position,
+		"phone":    payload.Phone,
+	}
+	for field, value := range text {
+		if value == nil {
+			continue
+		}
+		v := strings.TrimSpace(*value)
+		if len(v) > maxNameLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": field + " is too long"})
+			return
+		}
+		if v == "" {
+			unset[field] = ""
+		} else {
+			set[field] = v
+		}
+	}
+
+	if payload.Signature != nil {
+		if *payload.Signature == "" {
+			unset["signature"] = ""
+		} else {
+			if err := ValidateSignature(*payload.Signature); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			set["signature"] = *payload.Signature
+		}
+	}
+
+	if len(set) == 0 && len(unset) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	before := audit.Snapshot(c, db, "user", currentUser.ID)
+	if _, err := db.Collection("user").UpdateByID(c, currentUser.ID, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	audit.Updated(c, db, "user", currentUser.ID, before)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
+}
+
+// ValidateSignature accepts a PNG or JPEG data URL within the size limit
+func ValidateSignature(dataURL string) error {
+	_, data, err := DecodeSignature(dataURL)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxSignatureBytes {
+		return errors.New("signature image must be 200KB or smaller")
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return errors.New("signature is not a valid PNG or JPEG image")
+	}
+	return nil
+}
+
+// DecodeSignature splits a signature data URL into its image type ("PNG" or
+// "JPG", as gofpdf names them) and raw bytes
+func DecodeSignature(dataURL string) (string, []byte, error) {
+	var imageType string
+	switch {
+	case strings.HasPrefix(dataURL, "data:image/png;base64,"):
+		imageType = "PNG"
+	case strings.HasPrefix(dataURL, "data:image/jpeg;base64,"), strings.HasPrefix(dataURL, "data:image/jpg;base64,"):
+		imageType = "JPG"
+	default:
+		return "", nil, errors.New("signature must be a PNG or JPEG data URL")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(dataURL[strings.Index(dataURL, ",")+1:])
+	if err != nil {
+		return "", nil, errors.New("signature is not valid base64")
+	}
+	return imageType, data, nil
+}
+
+// Signatory looks up a user for a document sign-off block. A missing user
+// still prints the label, with a blank name.
+func Signatory(ctx context.Context, db *mongo.Database, label string, userID *primitive.ObjectID, at *time.Time) reporthelper.Signatory {
+	s := reporthelper.Signatory{Label: label, Date: at}
+	if userID == nil || userID.IsZero() {
+		return s
+	}
+
+	var user models.User
+	if err := db.Collection("user").FindOne(ctx, bson.M{"_id": *userID}).Decode(&user); err != nil {
+		return s
+	}
+	s.Name = user.DisplayName()
+	s.Position = user.Position
+	if user.Signature != "" {
+		if imageType, data, err := DecodeSignature(user.Signature); err == nil {
+			s.ImageType = imageType
+			s.Signature = data
+		}
+	}
+	return s
+}
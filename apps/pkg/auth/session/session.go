@@ -0,0 +1,253 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/jwthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+	ErrUserInactive        = errors.New("user is deactivated")
+)
+
+// Tokens is what the client receives on sign in and on every refresh
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Issue starts a new session for the user and returns its first token pair
+func Issue(c *gin.Context, db *mongo.Database, cfg config.Config, user *models.User) (Tokens, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := time.Now()
+	sess := models.Session{
+		ID:               primitive.NewObjectID(),
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        c.Request.UserAgent(),
+		IP:               c.ClientIP(),
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(jwthelper.RefreshTokenTTL(cfg)),
+	}
+	if _, err := db.Collection("session").InsertOne(c, sess); err != nil {
+		return Tokens{}, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	return tokensFor(cfg, user, sess.ID, refreshToken)
+}
+
+// Rotate exchanges a refresh token for a new token pair. The presented token is
+// invalidated; presenting it again revokes the whole session.
+func Rotate(c *gin.Context, db *mongo.Database, cfg config.Config, refreshToken string) (Tokens, error) {
+	next, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	collection := db.Collection("session")
+	hash := hashToken(refreshToken)
+	now := time.Now()
+
+	var sess models.Session
+	err = collection.FindOneAndUpdate(c,
+		bson.M{
+			"refreshTokenHash": hash,
+			"revokedAt":        bson.M{"$exists": false},
+			"expiresAt":        bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{
+			"refreshTokenHash":  hashToken(next),
+			"previousTokenHash": hash,
+			"lastUsedAt":        now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&sess)
+	if err == mongo.ErrNoDocuments {
+		// A rotated-out token coming back means it was copied; kill the session
+		res, rerr := collection.UpdateOne(c,
+			bson.M{"previousTokenHash": hash, "revokedAt": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"revokedAt": now}},
+		)
+		if rerr == nil && res.ModifiedCount > 0 {
+			return Tokens{}, ErrRefreshTokenReused
+		}
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	var user models.User
+	if err := db.Collection("user").FindOne(c, bson.M{"_id": sess.UserID}).Decode(&user); err != nil || user.Status == "suspended" {
+		_ = Revoke(c, db, sess.ID)
+		return Tokens{}, ErrUserInactive
+	}
+
+	return tokensFor(cfg, &user, sess.ID, next)
+}
+
+// IsActive reports whether the session exists, is not revoked and not expired
+func IsActive(ctx context.Context, db *mongo.Database, sessionID primitive.ObjectID) (bool, error) {
+	count, err := db.Collection("session").CountDocuments(ctx, bson.M{
+		"_id":       sessionID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Revoke ends a single session
+func Revoke(ctx context.Context, db *mongo.Database, sessionID primitive.ObjectID) error {
+	_, err := db.Collection("session").UpdateOne(ctx,
+		bson.M{"_id": sessionID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
+
+// RevokeAllForUser ends every open session of the user and returns how many
+// were revoked
+func RevokeAllForUser(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) (int64, error) {
+	res, err := db.Collection("session").UpdateMany(ctx,
+		bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// RevokeOthers ends every session of the user except keep, e.g. after the
+// user changed their password on this device
+func RevokeOthers(ctx context.Context, db *mongo.Database, userID, keep primitive.ObjectID) error {
+	_, err := db.Collection("session").UpdateMany(ctx,
+		bson.M{"userId": userID, "_id": bson.M{"$ne": keep}, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	return err
+}
+
+// Refresh handles POST /auth/refresh
+func Refresh(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var payload RefreshPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	tokens, err := Rotate(c, db, cfg, payload.RefreshToken)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, tokens)
+	case errors.Is(err, ErrRefreshTokenReused):
+		logrus.WithField("ip", c.ClientIP()).Warn("Refresh token reuse detected, session revoked")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please sign in again"})
+	case errors.Is(err, ErrInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please sign in again"})
+	case errors.Is(err, ErrUserInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Your account is deactivated. Please contact admin."})
+	default:
+		logrus.WithError(err).Error("Failed to refresh session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+	}
+}
+
+// Logout revokes the session behind the current access token
+func Logout(c *gin.Context, db *mongo.Database) {
+	sessionID, ok := c.Get("sessionID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := Revoke(c, db, sessionID.(primitive.ObjectID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every session of the current user, on all devices
+func LogoutAll(c *gin.Context, db *mongo.Database) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	userObj, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	revoked, err := RevokeAllForUser(c, db, userObj.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out of all sessions",
+		"revoked": revoked,
+	})
+}
+
+func tokensFor(cfg config.Config, user *models.User, sessionID primitive.ObjectID, refreshToken string) (Tokens, error) {
+	accessToken, err := jwthelper.GenerateJWTToken(cfg, user.Email, sessionID.Hex())
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(jwthelper.AccessTokenTTL(cfg).Seconds()),
+	}, nil
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Only the hash is stored so a database leak does not hand out sessions
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,8 +4,13 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/loginguard"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/session"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/signup"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/twofactor"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/jwthelper"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
 	"github.com/sirupsen/logrus"
@@ -14,44 +19,188 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func SignIn(c *gin.Context, db *mongo.Database) {
-	var loginData config.SignupRequest
+func SignIn(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var loginData authconfig.SignupRequest
 	if err := c.ShouldBindJSON(&loginData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !checkLockout(c, db, loginData.Email) {
+		return
+	}
+
 	collection := db.Collection("user")
 
 	var user models.User
 	err := collection.FindOne(c, bson.M{"email": loginData.Email}).Decode(&user)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		rejectCredentials(c, db, cfg, loginData.Email, "unknown_email")
+		return
+	}
+
+	// Service accounts only authenticate with API keys
+	if user.IsServiceAccount {
+		rejectCredentials(c, db, cfg, user.Email, "service_account")
 		return
 	}
 
 	if user.Status == "suspended" {
+		loginguard.Record(c, db, user.Email, loginguard.OutcomeFailure, "suspended")
 		c.JSON(http.StatusForbidden, gin.H{"error": "Your account is deactivated. Please contact admin."})
 		return
 	}
 
 	// Compare password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginData.Password)); err != nil {
+		rejectCredentials(c, db, cfg, user.Email, "bad_password")
+		return
+	}
+
+	// Second step: TOTP for users who enabled it or whose role requires it
+	required, err := twofactor.Required(c, db, &user)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load 2FA settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	if user.TwoFactor.Enabled || required {
+		challenge, err := jwthelper.GenerateChallengeToken(cfg, user.Email, twofactor.ChallengePurpose)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to generate 2FA challenge")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+			return
+		}
+
+		response := gin.H{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		}
+
+		// Mandatory but not enrolled yet: enroll as part of this sign in
+		if !user.TwoFactor.Enabled {
+			secret, uri, err := twofactor.BeginEnrollment(c, db, &user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start 2FA enrollment"})
+				return
+			}
+			response["two_factor_setup"] = true
+			response["secret"] = secret
+			response["otpauth_url"] = uri
+		}
+
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	completeSignIn(c, db, cfg, &user, nil)
+}
+
+// VerifyTwoFactor finishes a sign in that returned a challenge token. During
+// mandatory enrollment the first valid code also turns 2FA on and the
+// response carries the recovery codes.
+func VerifyTwoFactor(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var payload authconfig.TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email, err := jwthelper.ParseChallengeToken(cfg, payload.ChallengeToken, twofactor.ChallengePurpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign in again to get a new code prompt"})
+		return
+	}
+
+	if !checkLockout(c, db, email) {
+		return
+	}
+
+	var user models.User
+	if err := db.Collection("user").FindOne(c, bson.M{"email": email}).Decode(&user); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
+	if user.Status == "suspended" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account is deactivated. Please contact admin."})
+		return
+	}
+
+	extra := gin.H{}
+	if user.TwoFactor.Enabled {
+		valid, err := twofactor.VerifyCode(c, db, &user, payload.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+			return
+		}
+		if !valid {
+			_, _ = loginguard.RecordFailure(c, db, cfg, user.Email, "bad_2fa_code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": twofactor.ErrInvalidCode.Error()})
+			return
+		}
+	} else {
+		codes, err := twofactor.ConfirmEnrollment(c, db, &user, payload.Code)
+		if err != nil {
+			_, _ = loginguard.RecordFailure(c, db, cfg, user.Email, "bad_2fa_code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		extra["recovery_codes"] = codes
+	}
 
-	// Generate JWT
-	token, err := jwthelper.GenerateJWTToken(user.Email)
+	completeSignIn(c, db, cfg, &user, extra)
+}
+
+// checkLockout answers 429 and returns false while the account or the
+// client address is locked out
+func checkLockout(c *gin.Context, db *mongo.Database, email string) bool {
+	wait, err := loginguard.Check(c, db, email, c.ClientIP())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to check login lockout")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return false
+	}
+	if wait > 0 {
+		loginguard.Record(c, db, email, loginguard.OutcomeLocked, "")
+		loginguard.Reject(c, wait)
+		return false
+	}
+	return true
+}
+
+// rejectCredentials counts the failure and answers with the same message
+// for unknown emails and wrong passwords
+func rejectCredentials(c *gin.Context, db *mongo.Database, cfg config.Config, email, reason string) {
+	if _, err := loginguard.RecordFailure(c, db, cfg, email, reason); err != nil {
+		logrus.WithError(err).Error("Failed to record failed sign in")
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+}
+
+// completeSignIn starts the session and writes the login response
+func completeSignIn(c *gin.Context, db *mongo.Database, cfg config.Config, user *models.User, extra gin.H) {
+	// Start a session and issue the access/refresh token pair
+	tokens, err := session.Issue(c, db, cfg, user)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to generate JWT token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
-	menus, _ := signup.GetUserMenus(user, db)
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
-		"menus":   menus,
-	})
+	loginguard.RecordSuccess(c, db, user.Email)
+
+	menus, _ := signup.GetUserMenus(*user, db)
+	permissions, _ := permission.EffectiveMatrix(c, db, user)
+	response := gin.H{
+		"message":       "Login successful",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"menus":         menus,
+		"permissions":   permissions,
+	}
+	for k, v := range extra {
+		response[k] = v
+	}
+	c.JSON(http.StatusOK, response)
 }
@@ -2,11 +2,19 @@ package signup
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	authconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/password"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/session"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,8 +23,10 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func SignUp(c *gin.Context, db *mongo.Database) {
-	var signUpData config.SignupRequest
+var errAlreadyApproved = errors.New("pending user already approved")
+
+func SignUp(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	var signUpData authconfig.SignupRequest
 	if err := c.ShouldBindJSON(&signUpData); err != nil {
 		logrus.WithError(err).Error("Failed to bind signup data")
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -38,6 +48,22 @@ func SignUp(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	// Invited users must use the link from their invitation
+	err := db.Collection("invite").FindOne(c, bson.M{
+		"email":     strings.ToLower(strings.TrimSpace(signUpData.Email)),
+		"status":    "pending",
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Err()
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This email has a pending invitation, please use the link in the invitation email"})
+		return
+	}
+
+	if err := password.Validate(cfg, signUpData.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(signUpData.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -54,11 +80,12 @@ func SignUp(c *gin.Context, db *mongo.Database) {
 		Status:      "pending",
 	}
 
-	_, err = collection.InsertOne(c, newPendingUser)
+	res, err := collection.InsertOne(c, newPendingUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pending signup request"})
 		return
 	}
+	audit.Created(c, db, "pendinguser", res.InsertedID.(primitive.ObjectID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Signup request submitted. Waiting for admin approval.",
@@ -124,11 +151,37 @@ func GetAllUsers(c *gin.Context, db *mongo.Database) {
 		for _, u := range users {
 			delete(u, "password") // Remove password for security
 
+			// Only expose whether 2FA is on, never the secret or recovery codes
+			twoFactorEnabled := false
+			switch tf := u["twoFactor"].(type) {
+			case bson.M:
+				twoFactorEnabled, _ = tf["enabled"].(bool)
+			case bson.D:
+				twoFactorEnabled, _ = tf.Map()["enabled"].(bool)
+			}
+			u["twoFactorEnabled"] = twoFactorEnabled
+			delete(u, "twoFactor")
+
 			// Replace role ObjectID with role name
 			roleName := getRoleName(u["roles"])
 			u["role"] = roleName
 			delete(u, "roles")
 
+			// Primary role first, then any extra roles
+			roleNames := []string{}
+			if roleName != "N/A" {
+				roleNames = append(roleNames, roleName)
+			}
+			if extra, ok := u["roleIds"].(bson.A); ok {
+				for _, id := range extra {
+					if name := getRoleName(id); name != "N/A" && name != roleName {
+						roleNames = append(roleNames, name)
+					}
+				}
+			}
+			u["roleNames"] = roleNames
+			delete(u, "signature")
+
 			allUsers = append(allUsers, u)
 		}
 	}
@@ -153,6 +206,32 @@ func GetAllUsers(c *gin.Context, db *mongo.Database) {
 		}
 	}
 
+	// Outstanding invitations, flagged expired once the link has lapsed
+	inviteCursor, err := db.Collection("invite").Find(c, bson.M{"status": "pending"})
+	if err == nil {
+		defer inviteCursor.Close(c)
+		var invites []models.Invite
+		if err := inviteCursor.All(c, &invites); err == nil {
+			now := time.Now()
+			for _, inv := range invites {
+				status := "invited"
+				if now.After(inv.ExpiresAt) {
+					status = "invite_expired"
+				}
+				allUsers = append(allUsers, bson.M{
+					"_id":       inv.ID,
+					"email":     inv.Email,
+					"role":      getRoleName(inv.RoleID),
+					"status":    status,
+					"isInvite":  true,
+					"invitedAt": inv.CreatedAt,
+					"sentAt":    inv.SentAt,
+					"expiresAt": inv.ExpiresAt,
+				})
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"users": allUsers})
 }
 
@@ -174,7 +253,7 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.ApprovePayload
+	var payload authconfig.ApprovePayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -183,6 +262,21 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 	objID, _ := primitive.ObjectIDFromHex(payload.UserID)
 	roleID, _ := primitive.ObjectIDFromHex(payload.RoleID)
 
+	// Extra roles; the primary role defaults to the first one
+	var extraRoles []primitive.ObjectID
+	for _, id := range payload.RoleIDs {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+			return
+		}
+		if roleID.IsZero() {
+			roleID = oid
+		} else if oid != roleID {
+			extraRoles = append(extraRoles, oid)
+		}
+	}
+
 	// Prevent self-update
 	if currentUser.ID == objID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot modify your own account"})
@@ -195,6 +289,7 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 	var existingUser models.User
 	err := userCol.FindOne(c, bson.M{"_id": objID}).Decode(&existingUser)
 	if err == nil {
+		before := audit.Snapshot(c, db, "user", objID)
 		if payload.Action == "deactivate" {
 			_, err = userCol.UpdateOne(c,
 				bson.M{"_id": objID},
@@ -204,18 +299,25 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
 				return
 			}
+			audit.Changed(c, db, "user", objID, "deactivate", before)
+			// Sign the user out everywhere right away
+			if _, err := session.RevokeAllForUser(c, db, objID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "User deactivated but failed to revoke sessions"})
+				return
+			}
 			c.JSON(http.StatusOK, gin.H{"message": "User account deactivated"})
 			return
 		}
 
 		_, err = userCol.UpdateOne(c,
 			bson.M{"_id": objID},
-			bson.M{"$set": bson.M{"roles": roleID, "status": "active"}},
+			bson.M{"$set": bson.M{"roles": roleID, "roleIds": extraRoles, "status": "active"}},
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
 			return
 		}
+		audit.Updated(c, db, "user", objID, before)
 		c.JSON(http.StatusOK, gin.H{"message": "User role updated successfully"})
 		return
 	}
@@ -227,6 +329,7 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	pendingBefore := audit.Snapshot(c, db, "pendinguser", objID)
 	if payload.Action == "reject" {
 		_, err = pendingCol.UpdateOne(c,
 			bson.M{"_id": objID},
@@ -235,6 +338,7 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject user"})
 			return
 		}
+		audit.Changed(c, db, "pendinguser", objID, audit.ActionReject, pendingBefore)
 		c.JSON(http.StatusOK, gin.H{"message": "User rejected successfully"})
 		return
 	}
@@ -243,18 +347,37 @@ func ApproveOrUpdateUser(c *gin.Context, db *mongo.Database) {
 		Email:        pendingUser.Email,
 		Password:     pendingUser.Password,
 		Roles:        roleID,
+		RoleIDs:      extraRoles,
 		IsSuperAdmin: false,
 		Status:       "active",
 	}
-	_, err = userCol.InsertOne(c, newUser)
+	newUser.ID = primitive.NewObjectID()
+
+	// Creating the account and closing the request happen together, so a
+	// failure cannot leave an active user with a request still pending
+	err = database.WithTransaction(c, db, func(ctx context.Context) error {
+		res, err := pendingCol.UpdateOne(ctx,
+			bson.M{"_id": objID, "status": bson.M{"$ne": "approved"}},
+			bson.M{"$set": bson.M{"status": "approved", "processedAt": time.Now()}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errAlreadyApproved
+		}
+		_, err = userCol.InsertOne(ctx, newUser)
+		return err
+	})
+	if errors.Is(err, errAlreadyApproved) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has already been approved"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve user"})
 		return
 	}
-
-	_, _ = pendingCol.UpdateOne(c,
-		bson.M{"_id": objID},
-		bson.M{"$set": bson.M{"status": "approved", "processedAt": time.Now()}})
+	audit.Created(c, db, "user", newUser.ID)
+	audit.Changed(c, db, "pendinguser", objID, audit.ActionApprove, pendingBefore)
 
 	c.JSON(http.StatusOK, gin.H{"message": "User approved successfully"})
 }
@@ -271,7 +394,7 @@ func CreateRole(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.RoleData
+	var payload authconfig.RoleData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -285,27 +408,42 @@ func CreateRole(c *gin.Context, db *mongo.Database) {
 		}
 	}
 
+	var permissions map[string][]string
+	if payload.Permissions != nil {
+		var err error
+		permissions, err = permission.ValidateMatrix(payload.Permissions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	col := db.Collection("role")
 	err := col.FindOne(c, bson.M{"name": payload.Name}).Err()
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
 		return
 	}
-	_, err = col.InsertOne(c, models.Role{
-		Name:  payload.Name,
-		Menus: menuIDs,
+	res, err := col.InsertOne(c, models.Role{
+		Name:             payload.Name,
+		Menus:            menuIDs,
+		Permissions:      permissions,
+		RequireTwoFactor: payload.RequireTwoFactor,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
 		return
 	}
+	audit.Created(c, db, "role", res.InsertedID.(primitive.ObjectID))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Role created successfully"})
 }
 
 type RoleUpdatePayload struct {
-	RoleID string   `json:"role_id" binding:"required"`
-	Menus  []string `json:"menus"`
+	RoleID           string              `json:"role_id" binding:"required"`
+	Menus            []string            `json:"menus"`
+	Permissions      map[string][]string `json:"permissions,omitempty"` // omitted keeps the current matrix
+	RequireTwoFactor *bool               `json:"require_two_factor,omitempty"`
 }
 
 func UpdateRoleMenus(c *gin.Context, db *mongo.Database) {
@@ -340,16 +478,35 @@ func UpdateRoleMenus(c *gin.Context, db *mongo.Database) {
 		}
 	}
 
+	set := bson.M{"menus": menuIDs}
+	if payload.Permissions != nil {
+		permissions, err := permission.ValidateMatrix(payload.Permissions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		set["permissions"] = permissions
+	}
+	if payload.RequireTwoFactor != nil {
+		set["requireTwoFactor"] = *payload.RequireTwoFactor
+	}
+
 	roleCol := db.Collection("role")
-	_, err = roleCol.UpdateOne(c,
+	before := audit.Snapshot(c, db, "role", roleID)
+	res, err := roleCol.UpdateOne(c,
 		bson.M{"_id": roleID},
-		bson.M{"$set": bson.M{"menus": menuIDs}},
+		bson.M{"$set": set},
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role menus"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
 
+	audit.Updated(c, db, "role", roleID, before)
 	c.JSON(http.StatusOK, gin.H{"message": "Role menus updated successfully"})
 }
 
@@ -398,7 +555,7 @@ func GetRoleWithMenus(c *gin.Context, db *mongo.Database) {
 	}
 
 	// Payload
-	var payload config.GetRolePayload
+	var payload authconfig.GetRolePayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -438,12 +595,19 @@ func GetRoleWithMenus(c *gin.Context, db *mongo.Database) {
 
 	// Response
 	c.JSON(http.StatusOK, gin.H{
-		"role_id": role.ID,
-		"name":    role.Name,
-		"menus":   menus,
+		"role_id":          role.ID,
+		"name":             role.Name,
+		"menus":            menus,
+		"permissions":      role.Permissions,
+		"requireTwoFactor": role.RequireTwoFactor,
 	})
 }
 
+// GetPermissionCatalog lists the resources and actions a role matrix can grant.
+func GetPermissionCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"resources": permission.Catalog})
+}
+
 func GetAllMenus(c *gin.Context, db *mongo.Database) {
 	menuCol := db.Collection("menu")
 
@@ -465,7 +629,6 @@ func GetAllMenus(c *gin.Context, db *mongo.Database) {
 
 func GetUserMenus(user models.User, db *mongo.Database) ([]models.Menu, error) {
 	menuCol := db.Collection("menu")
-	roleCol := db.Collection("role")
 
 	if user.IsSuperAdmin {
 		// Super admin sees ALL menus automatically
@@ -482,14 +645,20 @@ func GetUserMenus(user models.User, db *mongo.Database) ([]models.Menu, error) {
 		return menus, nil
 	}
 
-	// Normal user: get menus from role
-	var role models.Role
-	err := roleCol.FindOne(context.TODO(), bson.M{"_id": user.Roles}).Decode(&role)
+	// Normal user: menus from all of their roles
+	roles, err := permission.UserRoles(context.TODO(), db, &user)
 	if err != nil {
 		return nil, err
 	}
+	var menuIDs []primitive.ObjectID
+	for _, role := range roles {
+		menuIDs = append(menuIDs, role.Menus...)
+	}
+	if len(menuIDs) == 0 {
+		return []models.Menu{}, nil
+	}
 
-	cursor, err := menuCol.Find(context.TODO(), bson.M{"_id": bson.M{"$in": role.Menus}})
+	cursor, err := menuCol.Find(context.TODO(), bson.M{"_id": bson.M{"$in": menuIDs}})
 	if err != nil {
 		return nil, err
 	}
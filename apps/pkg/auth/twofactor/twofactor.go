@@ -0,0 +1,355 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Issuer = "Polaris Prime AirTech"
+
+	// ChallengePurpose marks the sign in challenge token exchanged at /auth/2fa/verify
+	ChallengePurpose = "2fa"
+
+	recoveryCodeCount = 10
+)
+
+var ErrInvalidCode = errors.New("invalid authentication code")
+
+// Required reports whether the user must use 2FA: always for super admins,
+// otherwise when any of their roles demands it
+func Required(ctx context.Context, db *mongo.Database, user *models.User) (bool, error) {
+	if user.IsSuperAdmin {
+		return true, nil
+	}
+
+	roles, err := permission.UserRoles(ctx, db, user)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if role.RequireTwoFactor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BeginEnrollment stores a fresh pending secret and returns it with its
+// provisioning URI. 2FA stays off until ConfirmEnrollment sees a valid code.
+func BeginEnrollment(ctx context.Context, db *mongo.Database, user *models.User) (string, string, error) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = db.Collection("user").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"twoFactor.pendingSecret": secret}},
+	)
+	if err != nil {
+		return "", "", err
+	}
+	user.TwoFactor.PendingSecret = secret
+
+	return secret, ProvisioningURI(Issuer, user.Email, secret), nil
+}
+
+// ConfirmEnrollment turns 2FA on once the user proves their app produces
+// codes for the pending secret. It returns the plain recovery codes, which
+// are shown to the user only this once.
+func ConfirmEnrollment(ctx context.Context, db *mongo.Database, user *models.User, code string) ([]string, error) {
+	if user.TwoFactor.PendingSecret == "" {
+		return nil, errors.New("no 2FA enrollment in progress")
+	}
+
+	step, ok := Validate(user.TwoFactor.PendingSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = db.Collection("user").UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{
+			"$set": bson.M{
+				"twoFactor.enabled":       true,
+				"twoFactor.secret":        user.TwoFactor.PendingSecret,
+				"twoFactor.recoveryCodes": hashes,
+				"twoFactor.lastUsedStep":  step,
+				"twoFactor.enabledAt":     now,
+			},
+			"$unset": bson.M{"twoFactor.pendingSecret": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyCode accepts either a TOTP code or an unused recovery code. Both are
+// consumed atomically, so the same code never works twice.
+func VerifyCode(ctx context.Context, db *mongo.Database, user *models.User, code string) (bool, error) {
+	if !user.TwoFactor.Enabled {
+		return false, nil
+	}
+	users := db.Collection("user")
+
+	if step, ok := Validate(user.TwoFactor.Secret, code, time.Now(), user.TwoFactor.LastUsedStep); ok {
+		res, err := users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "$or": bson.A{
+				bson.M{"twoFactor.lastUsedStep": bson.M{"$lt": step}},
+				bson.M{"twoFactor.lastUsedStep": bson.M{"$exists": false}},
+			}},
+			bson.M{"$set": bson.M{"twoFactor.lastUsedStep": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return res.ModifiedCount == 1, nil
+	}
+
+	hash := hashRecoveryCode(code)
+	res, err := users.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "twoFactor.recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"twoFactor.recoveryCodes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount == 1 {
+		logrus.WithField("email", user.Email).Warn("2FA recovery code used")
+		return true, nil
+	}
+	return false, nil
+}
+
+// Status handles GET /auth/2fa/status
+func Status(c *gin.Context, db *mongo.Database) {
+	userObj, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	required, err := Required(c, db, userObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load 2FA settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  userObj.TwoFactor.Enabled,
+		"required":                 required,
+		"recovery_codes_remaining": len(userObj.TwoFactor.RecoveryCodes),
+	})
+}
+
+// Setup handles POST /auth/2fa/setup and starts enrollment for a signed-in user
+func Setup(c *gin.Context, db *mongo.Database) {
+	userObj, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if userObj.TwoFactor.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, uri, err := BeginEnrollment(c, db, userObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start 2FA enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": uri,
+	})
+}
+
+// Enable handles POST /auth/2fa/enable with the first code from the app
+func Enable(c *gin.Context, db *mongo.Database) {
+	userObj, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var payload config.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "user", userObj.ID)
+	codes, err := ConfirmEnrollment(c, db, userObj, payload.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Changed(c, db, "user", userObj.ID, "enable_2fa", before)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable handles POST /auth/2fa/disable. Users whose role requires 2FA
+// cannot turn it off.
+func Disable(c *gin.Context, db *mongo.Database) {
+	userObj, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var payload config.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	required, err := Required(c, db, userObj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load 2FA settings"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for your account"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(userObj.Password), []byte(payload.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+	valid, err := VerifyCode(c, db, userObj, payload.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidCode.Error()})
+		return
+	}
+
+	before := audit.Snapshot(c, db, "user", userObj.ID)
+	_, err = db.Collection("user").UpdateOne(c,
+		bson.M{"_id": userObj.ID},
+		bson.M{"$unset": bson.M{"twoFactor": ""}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable 2FA"})
+		return
+	}
+	audit.Changed(c, db, "user", userObj.ID, "disable_2fa", before)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes handles POST /auth/2fa/recovery-codes and replaces
+// all recovery codes after a valid TOTP code
+func RegenerateRecoveryCodes(c *gin.Context, db *mongo.Database) {
+	userObj, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var payload config.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	valid, err := VerifyCode(c, db, userObj, payload.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidCode.Error()})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	_, err = db.Collection("user").UpdateOne(c,
+		bson.M{"_id": userObj.ID},
+		bson.M{"$set": bson.M{"twoFactor.recoveryCodes": hashes}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func currentUser(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	userObj, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return nil, false
+	}
+	return userObj, true
+}
+
+// Recovery codes look like "k3m9q-x2v7p" and are stored as sha256 hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var b strings.Builder
+		for j, v := range buf {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(alphabet[int(v)%len(alphabet)])
+		}
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
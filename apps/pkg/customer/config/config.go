@@ -7,6 +7,7 @@ type CustomerData struct {
 	Address      string `json:"address"`
 	City         string `json:"city"`
 	TINNumber    string `json:"tinnumber"`
+	Version      *int64 `json:"version,omitempty"` // required when updating
 }
 
 type DeleteCustomer struct {
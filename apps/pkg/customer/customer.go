@@ -1,36 +1,45 @@
 package customer
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/customer/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	customerconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/customer/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GenerateCustomerID(count int64) string {
-	year := time.Now().Year()
-	return fmt.Sprintf("CUST-%d-%05d", year, count+1)
-}
-
-func AddCustomer(c *gin.Context, db *mongo.Database) {
+func AddCustomer(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	_, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	var payload config.CustomerData
+	var payload customerconfig.CustomerData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
+	action := permission.ActionCreate
+	if payload.ID != "" {
+		action = permission.ActionEdit
+	}
+	if !permission.Authorize(c, db, permission.ResourceCustomer, action) {
+		return
+	}
+
 	collection := db.Collection("customer")
 
 	// ===================== UPDATE =====================
@@ -41,6 +50,11 @@ func AddCustomer(c *gin.Context, db *mongo.Database) {
 			return
 		}
 
+		expected, ok := version.Expected(c, payload.Version)
+		if !ok {
+			return
+		}
+
 		update := bson.M{
 			"$set": bson.M{
 				"customername": payload.CustomerName,
@@ -51,10 +65,11 @@ func AddCustomer(c *gin.Context, db *mongo.Database) {
 			},
 		}
 
+		before := audit.Snapshot(c, db, "customer", objID)
 		res, err := collection.UpdateOne(
 			c,
-			bson.M{"_id": objID},
-			update,
+			version.Filter(objID, expected),
+			version.Bump(update),
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer"})
@@ -62,16 +77,18 @@ func AddCustomer(c *gin.Context, db *mongo.Database) {
 		}
 
 		if res.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			version.Conflict(c, db, "customer", objID, "Customer not found")
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Customer updated successfully"})
+		audit.Updated(c, db, "customer", objID, before)
+		version.SetETag(c, expected+1)
+		c.JSON(http.StatusOK, gin.H{"message": "Customer updated successfully", "version": expected + 1})
 		return
 	}
 
 	// ===================== CREATE =====================
-	count, err := collection.CountDocuments(c, bson.M{})
+	customerID, err := sequence.Next(c, db, cfg, sequence.Customer)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate customer ID"})
 		return
@@ -79,7 +96,7 @@ func AddCustomer(c *gin.Context, db *mongo.Database) {
 
 	customer := models.Customer{
 		ID:           primitive.NewObjectID(),
-		CustomerID:   GenerateCustomerID(count),
+		CustomerID:   customerID,
 		CustomerName: payload.CustomerName,
 		CustomerOrg:  payload.CustomerOrg,
 		Address:      payload.Address,
@@ -93,6 +110,7 @@ func AddCustomer(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer"})
 		return
 	}
+	audit.Created(c, db, "customer", customer.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Customer created successfully",
@@ -100,6 +118,23 @@ func AddCustomer(c *gin.Context, db *mongo.Database) {
 	})
 }
 
+// customerList is how customers can be listed. Pages default to the
+// maximum because forms load the whole list for their pickers, following
+// nextCursor until the last page.
+var customerList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"customerid":   {Sort: true},
+		"customername": {Sort: true},
+		"customerorg":  {Sort: true},
+		"city":         {},
+		"tinnumber":    {},
+		"created_at":   {Path: "createdat", Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"customerid", "customername", "customerorg", "city"},
+	Sort:   "-created_at",
+	Limit:  listquery.MaxLimit,
+}
+
 func GetAllCustomers(c *gin.Context, db *mongo.Database) {
 	// Get authenticated user from context
 	user, exists := c.Get("user")
@@ -113,39 +148,45 @@ func GetAllCustomers(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("customer")
+	if !permission.Authorize(c, db, permission.ResourceCustomer, permission.ActionLookup) {
+		return
+	}
 
-	// Query all customers
-	cursor, err := collection.Find(c, bson.M{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers", "details": err.Error()})
+	query, ok := listquery.Parse(c, customerList)
+	if !ok {
 		return
 	}
-	defer cursor.Close(c)
 
 	var customers []models.Customer
-	if err := cursor.All(c, &customers); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode customers", "details": err.Error()})
+	page, err := query.Run(c, db.Collection("customer"), &customers)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers", "details": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"customers": customers})
+	body := listquery.Envelope(customers, page)
+	body["customers"] = body["data"] // older clients read this key
+	c.JSON(http.StatusOK, body)
 }
 
-func DeleteCustomer(c *gin.Context, db *mongo.Database) {
+func DeleteCustomer(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceCustomer, permission.ActionDelete) {
+		return
+	}
+
 	// Bind JSON payload
-	var payload config.DeleteCustomer
+	var payload customerconfig.DeleteCustomer
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
 		return
@@ -163,17 +204,21 @@ func DeleteCustomer(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("customer")
-	res, err := collection.DeleteOne(c, bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "customer", objID)
+	deleted, err := trash.Delete(c, db, cfg, "customer", objID, userObj.ID)
+	if trash.Blocked(c, "Customer", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer", "details": err.Error()})
 		return
 	}
 
-	if res.DeletedCount == 0 {
+	if !deleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 		return
 	}
 
+	audit.Changed(c, db, "customer", objID, audit.ActionDelete, before)
 	c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully", "deletedId": payload.ID})
 }
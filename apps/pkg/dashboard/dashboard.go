@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -45,12 +47,16 @@ type DashboardResponse struct {
 }
 
 func GetDashboard(c *gin.Context, db *mongo.Database) {
+	if !permission.Authorize(c, db, permission.ResourceDashboard, permission.ActionView) {
+		return
+	}
 
 	ctx := context.Background()
 
 	invCollection := db.Collection("polaris_inventory")
 
 	invPipeline := mongo.Pipeline{
+		trash.MatchLive,
 		{{Key: "$group", Value: bson.M{
 			"_id":   nil,
 			"total": bson.M{"$sum": "$quantity"},
@@ -83,7 +89,7 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 
 	soCollection := db.Collection("salesorder")
 
-	openSalesOrders, err := soCollection.CountDocuments(ctx, bson.M{})
+	openSalesOrders, err := soCollection.CountDocuments(ctx, trash.Live(nil))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count sales orders"})
 		return
@@ -95,12 +101,12 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 	startOfWeek := time.Date(now.Year(), now.Month(), now.Day()-int(now.Weekday()), 0, 0, 0, 0, now.Location())
 	endOfWeek := startOfWeek.AddDate(0, 0, 7)
 
-	receivingThisWeek, err := drCollection.CountDocuments(ctx, bson.M{
+	receivingThisWeek, err := drCollection.CountDocuments(ctx, trash.Live(bson.M{
 		"dispatch_date": bson.M{
 			"$gte": startOfWeek,
 			"$lt":  endOfWeek,
 		},
-	})
+	}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count receiving"})
 		return
@@ -108,7 +114,7 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 
 	projectCollection := db.Collection("project")
 
-	totalDeliveries, err := projectCollection.CountDocuments(ctx, bson.M{})
+	totalDeliveries, err := projectCollection.CountDocuments(ctx, trash.Live(nil))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count projects"})
 		return
@@ -119,6 +125,7 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 	endYear := startYear.AddDate(1, 0, 0)
 
 	monthlyPipeline := mongo.Pipeline{
+		trash.MatchLive,
 		{{Key: "$match", Value: bson.M{
 			"createdAt": bson.M{
 				"$gte": startYear,
@@ -172,6 +179,7 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 	customerCollection := db.Collection("customer")
 
 	cityPipeline := mongo.Pipeline{
+		trash.MatchLive,
 		{{Key: "$group", Value: bson.M{
 			"_id":   "$city",
 			"count": bson.M{"$sum": 1},
@@ -211,9 +219,9 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 
 	sevenDaysAgo := time.Now().AddDate(0, 0, -7)
 
-	salesOrdersCount, err := soCollection.CountDocuments(ctx, bson.M{
+	salesOrdersCount, err := soCollection.CountDocuments(ctx, trash.Live(bson.M{
 		"createdAt": bson.M{"$gte": sevenDaysAgo},
-	})
+	}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count sales orders"})
 		return
@@ -221,10 +229,10 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 
 	drCollection = db.Collection("delivery_receipts")
 
-	awaitingShipmentCount, err := drCollection.CountDocuments(ctx, bson.M{
+	awaitingShipmentCount, err := drCollection.CountDocuments(ctx, trash.Live(bson.M{
 		"status":     "Ready",
 		"created_at": bson.M{"$gte": sevenDaysAgo},
-	})
+	}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count awaiting shipment"})
 		return
@@ -244,6 +252,7 @@ func GetDashboard(c *gin.Context, db *mongo.Database) {
 	}
 
 	invPositionPipeline := mongo.Pipeline{
+		trash.MatchLive,
 		{{Key: "$group", Value: bson.M{
 			"_id":   "$type_of_aircon",
 			"units": bson.M{"$sum": "$quantity"},
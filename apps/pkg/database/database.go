@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/migrate"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,9 +20,13 @@ import (
 
 var db *mongo.Database // Declare db at the package level
 
-// CheckMongoDBConnection checks if the MongoDB database is connected or not
-func CheckMongoDBConnection(client *mongo.Client) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// startupPingTimeout is how long startup waits for the first ping
+const startupPingTimeout = 10 * time.Second
+
+// CheckMongoDBConnection checks if the MongoDB database is connected or not,
+// giving up after timeout
+func CheckMongoDBConnection(ctx context.Context, client *mongo.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	err := client.Ping(ctx, nil)
@@ -30,18 +37,12 @@ func CheckMongoDBConnection(client *mongo.Client) error {
 	return nil
 }
 
-// InitDB initializes the MongoDB database connection
-func InitDB() (*mongo.Database, error) {
-	var err error
-
-	// Open database connection
-	cfg, err := config.Env()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to load config: %v", err)
-	}
-
+// Connect opens the MongoDB connection without touching the schema
+func Connect(cfg config.Config) (*mongo.Database, error) {
 	// Set up MongoDB connection options
-	clientOptions := options.Client().ApplyURI(cfg.Mongo.ConnectionString)
+	clientOptions := options.Client().
+		ApplyURI(cfg.Mongo.ConnectionString).
+		SetMonitor(metrics.MongoMonitor())
 	client, err := mongo.NewClient(clientOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MongoDB client: %v", err)
@@ -56,27 +57,61 @@ func InitDB() (*mongo.Database, error) {
 	}
 
 	// Check the connection
-	err = CheckMongoDBConnection(client)
+	err = CheckMongoDBConnection(context.Background(), client, startupPingTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check MongoDB connection: %v", err)
 	}
 
 	// Get a handle to your MongoDB database
 	db = client.Database(cfg.Mongo.Database)
+	return db, nil
+}
+
+// InitDB initializes the MongoDB database connection, creates the models'
+// indexes and applies pending schema migrations unless autoMigrate is off
+func InitDB(cfg config.Config) (*mongo.Database, error) {
+	if _, err := Connect(cfg); err != nil {
+		return nil, err
+	}
 
-	// Perform automatic schema migration for each model
-	modelsToMigrate := []interface{}{}
+	if err := EnsureModelIndexes(db); err != nil {
+		return nil, err
+	}
+
+	if cfg.Mongo.AutoMigrate == nil || *cfg.Mongo.AutoMigrate {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if _, err := migrate.Run(ctx, db, false); err != nil {
+			return nil, fmt.Errorf("failed to apply schema migrations: %v", err)
+		}
+	}
+
+	return db, nil
+}
+
+// EnsureModelIndexes creates the indexes the models declare. It is safe to
+// run at any time and is also used after an import dropped collections.
+func EnsureModelIndexes(db *mongo.Database) error {
+	modelsToMigrate := []interface{}{
+		models.Session{},
+		models.PasswordReset{},
+		models.LoginAttempt{},
+		models.LoginThrottle{},
+		models.AuditLog{},
+		models.APIKey{},
+		models.Invite{},
+		models.IdempotencyKey{},
+	}
 
 	for _, model := range modelsToMigrate {
 		if migrator, ok := model.(models.Migrator); ok {
 			err := migrator.Migrate(db)
 			if err != nil {
-				return nil, fmt.Errorf("failed to migrate model %T: %v", model, err)
+				return fmt.Errorf("failed to migrate model %T: %v", model, err)
 			}
 		}
 	}
-
-	return db, nil
+	return nil
 }
 
 // GetDB returns the initialized MongoDB database
@@ -90,15 +125,15 @@ func SeedMenus(db *mongo.Database) error {
 	menuCol := db.Collection("menu")
 
 	menus := []models.Menu{
-		{Label: "Dashboard", Href: "/dashboard"},
-		{Label: "Customers", Href: "/customers"},
-		{Label: "Projects", Href: "/projects"},
-		{Label: "Sales Order", Href: "/sales-orders"},
-		{Label: "Purchase Order", Href: "/purchase-orders"},
-		{Label: "Warehousing", Href: "/warehousing"},
-		{Label: "Accounts Receivable", Href: "/accounts-receivable"},
-		{Label: "Generate Reports", Href: "/generate-reports"},
-		{Label: "Settings", Href: "/settings"},
+		{Label: "Dashboard", Href: permission.Dashboard},
+		{Label: "Customers", Href: permission.Customers},
+		{Label: "Projects", Href: permission.Projects},
+		{Label: "Sales Order", Href: permission.SalesOrders},
+		{Label: "Purchase Order", Href: permission.PurchaseOrders},
+		{Label: "Warehousing", Href: permission.Warehousing},
+		{Label: "Accounts Receivable", Href: permission.AccountsReceivable},
+		{Label: "Generate Reports", Href: permission.GenerateReports},
+		{Label: "Settings", Href: permission.Settings},
 	}
 
 	for _, menu := range menus {
@@ -114,30 +149,39 @@ func SeedMenus(db *mongo.Database) error {
 	return nil
 }
 
-func SeedSuperAdmin(db *mongo.Database) error {
+// SuperAdminRole returns the "superadmin" role, creating it if needed
+func SuperAdminRole(ctx context.Context, db *mongo.Database) (models.Role, error) {
+	rolesCol := db.Collection("role")
+
+	var superRole models.Role
+	err := rolesCol.FindOne(ctx, bson.M{"name": "superadmin"}).Decode(&superRole)
+	if err == nil {
+		return superRole, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return superRole, fmt.Errorf("failed to load superadmin role: %v", err)
+	}
+
+	superRole = models.Role{Name: "superadmin"}
+	insertResult, err := rolesCol.InsertOne(ctx, superRole)
+	if err != nil {
+		return superRole, fmt.Errorf("failed to create superadmin role: %v", err)
+	}
+	superRole.ID = insertResult.InsertedID.(primitive.ObjectID)
+	return superRole, nil
+}
+
+func SeedSuperAdmin(db *mongo.Database, cfg config.Config) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	usersCol := db.Collection("user")
-	rolesCol := db.Collection("role")
 
-	cfg, err := config.Env()
+	superRole, err := SuperAdminRole(ctx, db)
 	if err != nil {
 		return err
 	}
 
-	// Ensure "superadmin" role exists
-	var superRole models.Role
-	err = rolesCol.FindOne(ctx, bson.M{"name": "superadmin"}).Decode(&superRole)
-	if err != nil {
-		superRole = models.Role{Name: "superadmin"}
-		insertResult, err := rolesCol.InsertOne(ctx, superRole)
-		if err != nil {
-			return fmt.Errorf("failed to create superadmin role: %v", err)
-		}
-		superRole.ID = insertResult.InsertedID.(primitive.ObjectID)
-	}
-
 	// Loop through all seed super admins
 	for _, admin := range cfg.Seed.SuperAdmins {
 		if admin.Email == "" || admin.Password == "" {
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	txSupport sync.Map // *mongo.Client -> bool
+)
+
+// WithTransaction runs fn as one unit of work: every write made through the
+// context it receives commits together or not at all. Transient errors are
+// retried by the driver, so fn may run more than once and should only write
+// to Mongo; audit entries and responses belong after it returns.
+//
+// A standalone mongod has no transactions. There fn runs once without one and
+// a warning is logged, so local setups keep working.
+func WithTransaction(ctx context.Context, db *mongo.Database, fn func(ctx context.Context) error) error {
+	client := db.Client()
+	if !supportsTransactions(ctx, db) {
+		return fn(ctx)
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// supportsTransactions asks the server once per client whether it is part of
+// a replica set or a sharded cluster
+func supportsTransactions(ctx context.Context, db *mongo.Database) bool {
+	client := db.Client()
+	if v, ok := txSupport.Load(client); ok {
+		return v.(bool)
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		// Unknown for now; try again on the next call
+		logrus.WithError(err).Warn("Could not check transaction support, running without a transaction")
+		return false
+	}
+
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	if _, loaded := txSupport.LoadOrStore(client, supported); !loaded && !supported {
+		logrus.Warn("MongoDB is a standalone server without transactions; multi-document writes are not atomic")
+	}
+	return supported
+}
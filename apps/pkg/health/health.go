@@ -0,0 +1,43 @@
+package health
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pingTimeout stays under the usual one second readiness probe timeout, so a
+// slow Mongo fails the probe with a 503 rather than a probe timeout
+const pingTimeout = 800 * time.Millisecond
+
+var draining atomic.Bool
+
+// SetDraining makes the readiness probe fail so the load balancer stops
+// sending new requests while in-flight ones finish
+func SetDraining() {
+	draining.Store(true)
+}
+
+// Liveness reports that the process is up and serving HTTP. It never touches
+// the database, so a Mongo outage does not get the pod restarted.
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether this instance can serve traffic: it is not
+// shutting down and Mongo answers a ping
+func Readiness(c *gin.Context, db *mongo.Database) {
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+	if err := database.CheckMongoDBConnection(c.Request.Context(), db.Client(), pingTimeout); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database unreachable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -24,18 +24,11 @@
 package cors
 
 import (
-	"log"
-
 	"github.com/gin-gonic/gin"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
 )
 
-func CORSMiddleware() gin.HandlerFunc {
-	cfg, err := config.Env()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
-
+func CORSMiddleware(cfg config.Config) gin.HandlerFunc {
 	allowedOrigins := make(map[string]bool)
 	for _, o := range cfg.Endpoints {
 		allowedOrigins[o] = true
@@ -50,7 +43,8 @@ func CORSMiddleware() gin.HandlerFunc {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Request-ID, Idempotency-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
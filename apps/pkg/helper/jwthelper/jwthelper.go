@@ -1,30 +1,50 @@
 package jwthelper
 
 import (
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
 )
 
-// GenerateJWTToken generates a JWT token with the provided user ID
-func GenerateJWTToken(email string) (string, error) {
-	// Load environment config
-	cfg, err := config.Env()
-	if err != nil {
-		return "", fmt.Errorf("failed to load config: %v", err)
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	ChallengeTokenTTL      = 5 * time.Minute
+)
+
+// AccessTokenTTL returns the configured access token lifetime
+func AccessTokenTTL(cfg config.Config) time.Duration {
+	if cfg.JWT.AccessTokenMinutes > 0 {
+		return time.Duration(cfg.JWT.AccessTokenMinutes) * time.Minute
+	}
+	return DefaultAccessTokenTTL
+}
+
+// RefreshTokenTTL returns the configured refresh token lifetime
+func RefreshTokenTTL(cfg config.Config) time.Duration {
+	if cfg.JWT.RefreshTokenDays > 0 {
+		return time.Duration(cfg.JWT.RefreshTokenDays) * 24 * time.Hour
 	}
+	return DefaultRefreshTokenTTL
+}
 
+// GenerateJWTToken generates a short-lived access token for the user, bound to
+// the session (sid) that issued it so the token dies with the session
+func GenerateJWTToken(cfg config.Config, email, sessionID string) (string, error) {
 	var jwtSecret = []byte(cfg.JWT.Secret)
 
 	// Create a new token
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	// Set token claims
+	now := time.Now()
 	claims := token.Claims.(jwt.MapClaims)
 	claims["email"] = email
-	claims["exp"] = time.Now().Add(360 * 24 * time.Hour).Unix() // Token expiration time
+	claims["sid"] = sessionID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(AccessTokenTTL(cfg)).Unix() // Token expiration time
 
 	// Sign the token
 	tokenString, err := token.SignedString(jwtSecret)
@@ -34,3 +54,77 @@ func GenerateJWTToken(email string) (string, error) {
 
 	return tokenString, nil
 }
+
+// GenerateChallengeToken issues a short-lived token for an intermediate sign
+// in step such as 2FA. It has no session, so the API middleware rejects it.
+func GenerateChallengeToken(cfg config.Config, email, purpose string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["email"] = email
+	claims["purpose"] = purpose
+	claims["exp"] = time.Now().Add(ChallengeTokenTTL).Unix()
+
+	return token.SignedString([]byte(cfg.JWT.Secret))
+}
+
+// ParseChallengeToken validates a challenge token for the given purpose and
+// returns the email it was issued to
+func ParseChallengeToken(cfg config.Config, tokenString, purpose string) (string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return []byte(cfg.JWT.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return "", errors.New("invalid or expired challenge")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return "", errors.New("invalid challenge")
+	}
+	email, ok := claims["email"].(string)
+	if !ok {
+		return "", errors.New("invalid challenge")
+	}
+	return email, nil
+}
+
+// GenerateInviteToken signs an invitation link. The nonce is also stored on
+// the invite, so resending (new nonce) or revoking kills older links.
+func GenerateInviteToken(cfg config.Config, inviteID, nonce string, expiresAt time.Time) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["inv"] = inviteID
+	claims["nonce"] = nonce
+	claims["purpose"] = "invite"
+	claims["exp"] = expiresAt.Unix()
+
+	return token.SignedString([]byte(cfg.JWT.Secret))
+}
+
+// ParseInviteToken validates an invitation token and returns the invite ID
+// and nonce it carries
+func ParseInviteToken(cfg config.Config, tokenString string) (string, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return []byte(cfg.JWT.Secret), nil
+	})
+	if err != nil || !token.Valid {
+		return "", "", errors.New("invalid or expired invitation")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "invite" {
+		return "", "", errors.New("invalid invitation")
+	}
+	inviteID, _ := claims["inv"].(string)
+	nonce, _ := claims["nonce"].(string)
+	if inviteID == "" || nonce == "" {
+		return "", "", errors.New("invalid invitation")
+	}
+	return inviteID, nonce, nil
+}
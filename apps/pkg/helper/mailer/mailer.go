@@ -0,0 +1,139 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages. Pick a backend with the mail.backend setting.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Outbox collects messages in memory, for local runs and checks
+var Outbox = &MemoryOutbox{}
+
+// New returns the sender configured in env.yaml. Without a backend, mail is
+// written to files under mail.outboxDir (default "outbox").
+func New(cfg config.Config) (Sender, error) {
+	from := cfg.Mail.From
+	if from == "" {
+		from = "no-reply@polarisprimeairtech.com"
+	}
+
+	switch cfg.Mail.Backend {
+	case "smtp":
+		if cfg.Mail.SMTP.Host == "" {
+			return nil, fmt.Errorf("mail.smtp.host is required for the smtp backend")
+		}
+		port := cfg.Mail.SMTP.Port
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPSender{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Mail.SMTP.Host, port),
+			Host:     cfg.Mail.SMTP.Host,
+			Username: cfg.Mail.SMTP.Username,
+			Password: cfg.Mail.SMTP.Password,
+			From:     from,
+		}, nil
+	case "memory":
+		return Outbox, nil
+	case "", "file":
+		dir := cfg.Mail.OutboxDir
+		if dir == "" {
+			dir = "outbox"
+		}
+		return &FileOutbox{Dir: dir, From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.Mail.Backend)
+	}
+}
+
+// SMTPSender sends through an SMTP relay with PLAIN auth
+type SMTPSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, render(s.From, msg))
+}
+
+// FileOutbox writes each message as an .eml file
+type FileOutbox struct {
+	Dir  string
+	From string
+}
+
+func (f *FileOutbox) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create outbox: %v", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102150405.000000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), render(f.From, msg), 0o600)
+}
+
+// MemoryOutbox keeps sent messages in memory
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *MemoryOutbox) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far
+func (m *MemoryOutbox) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,9 @@
+package pipelinehelper
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// First is the first value of a looked-up field, or "" when the lookup
+// found nothing
+func First(path string) bson.M {
+	return bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{path, 0}}, ""}}
+}
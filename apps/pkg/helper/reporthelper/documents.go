@@ -0,0 +1,209 @@
+package reporthelper
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Signatory is a person printed in the sign-off block of a document, e.g.
+// "Prepared by" or "Approved by"
+type Signatory struct {
+	Label     string
+	Name      string
+	Position  string
+	ImageType string // "PNG" or "JPG"; empty when there is no signature
+	Signature []byte
+	Date      *time.Time
+}
+
+func newDocumentPDF(cfg config.Config, title string) *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(title, false)
+	pdf.AliasNbPages("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Arial", "I", 9)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	company := cfg.Company
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 18)
+	pdf.CellFormat(0, 10, strings.ToUpper(company.Name), "", 1, "C", false, 0, "")
+	pdf.SetFont("Arial", "", 9)
+	for _, line := range []string{company.Address, contactLine(company.Phone, company.Email, company.Website)} {
+		if line != "" {
+			pdf.CellFormat(0, 5, line, "", 1, "C", false, 0, "")
+		}
+	}
+	if company.TIN != "" {
+		pdf.CellFormat(0, 5, "TIN: "+company.TIN, "", 1, "C", false, 0, "")
+	}
+	pdf.Ln(2)
+	pdf.SetFont("Arial", "B", 14)
+	pdf.CellFormat(0, 8, title, "", 1, "C", false, 0, "")
+	pdf.Ln(4)
+	return pdf
+}
+
+func contactLine(parts ...string) string {
+	var filled []string
+	for _, p := range parts {
+		if p != "" {
+			filled = append(filled, p)
+		}
+	}
+	return strings.Join(filled, " | ")
+}
+
+// formatDate prints a date in the configured business timezone
+func formatDate(cfg config.Config, t time.Time) string {
+	return t.In(cfg.Location()).Format("02 Jan 2006")
+}
+
+func detailRow(pdf *gofpdf.Fpdf, label, value string) {
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(40, 6, label, "", 0, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	pdf.MultiCell(0, 6, value, "", "L", false)
+}
+
+// drawSignatories prints the sign-off blocks side by side at the bottom of
+// the content, with the signature image above the name when there is one
+func drawSignatories(cfg config.Config, pdf *gofpdf.Fpdf, signatories []Signatory) {
+	if len(signatories) == 0 {
+		return
+	}
+
+	const blockHeight = 42.0
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+blockHeight > pageHeight-bottom-15 {
+		pdf.AddPage()
+	}
+
+	pdf.Ln(10)
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	width := (pageWidth - left - right) / float64(len(signatories))
+	top := pdf.GetY()
+
+	for i, s := range signatories {
+		x := left + float64(i)*width
+
+		pdf.SetXY(x, top)
+		pdf.SetFont("Arial", "", 10)
+		pdf.CellFormat(width, 6, s.Label+":", "", 0, "L", false, 0, "")
+
+		if len(s.Signature) > 0 && s.ImageType != "" {
+			name := fmt.Sprintf("signature-%d", i)
+			opts := gofpdf.ImageOptions{ImageType: s.ImageType}
+			pdf.RegisterImageOptionsReader(name, opts, bytes.NewReader(s.Signature))
+			if pdf.Ok() {
+				pdf.ImageOptions(name, x+5, top+7, 0, 14, false, opts, 0, "")
+			} else {
+				// A broken image must not stop the document from printing
+				pdf.ClearError()
+			}
+		}
+
+		pdf.Line(x+5, top+24, x+width-5, top+24)
+
+		name := s.Name
+		if name == "" {
+			name = "-"
+		}
+		pdf.SetXY(x, top+25)
+		pdf.SetFont("Arial", "B", 10)
+		pdf.CellFormat(width, 5, name, "", 0, "C", false, 0, "")
+		pdf.SetXY(x, top+30)
+		pdf.SetFont("Arial", "", 9)
+		pdf.CellFormat(width, 5, s.Position, "", 0, "C", false, 0, "")
+		if s.Date != nil {
+			pdf.SetXY(x, top+35)
+			pdf.CellFormat(width, 5, formatDate(cfg, *s.Date), "", 0, "C", false, 0, "")
+		}
+	}
+	pdf.SetXY(left, top+blockHeight)
+}
+
+// GenerateDeliveryReceiptPDF renders a delivery receipt with its sign-off block
+func GenerateDeliveryReceiptPDF(cfg config.Config, dr models.DeliveryReceipt, signatories []Signatory) (string, error) {
+	pdf := newDocumentPDF(cfg, "DELIVERY RECEIPT")
+
+	detailRow(pdf, "DR Number:", dr.DRNumber)
+	detailRow(pdf, "Date:", formatDate(cfg, dr.CreatedAt))
+	detailRow(pdf, "Status:", dr.Status)
+	detailRow(pdf, "Customer:", dr.CustomerName)
+	detailRow(pdf, "Organization:", dr.CustomerOrg)
+	detailRow(pdf, "TIN:", dr.CustomerTIN)
+	detailRow(pdf, "Location:", dr.CustomerLocation)
+	pdf.Ln(5)
+
+	widths := []float64{20, 120, 50}
+	pdf.SetFont("Arial", "B", 11)
+	pdf.SetFillColor(230, 230, 230)
+	for i, h := range []string{"#", "SKU", "Quantity"} {
+		pdf.CellFormat(widths[i], 8, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Arial", "", 10)
+	for i, item := range dr.Items {
+		MultiCellRow(pdf, []string{
+			fmt.Sprintf("%d", i+1),
+			item.SKU,
+			fmt.Sprintf("%d", item.Quantity),
+		}, widths, 6)
+	}
+
+	drawSignatories(cfg, pdf, signatories)
+
+	file := OutputPath(cfg, fmt.Sprintf("delivery_receipt_%s_%d.pdf", dr.ID.Hex(), time.Now().Unix()))
+	err := pdf.OutputFileAndClose(file)
+	return file, err
+}
+
+// GenerateSupplierPOPDF renders a supplier purchase order with its sign-off
+// block
+func GenerateSupplierPOPDF(cfg config.Config, po models.SupplierPO, supplierName, projectName string, signatories []Signatory) (string, error) {
+	pdf := newDocumentPDF(cfg, "PURCHASE ORDER")
+
+	detailRow(pdf, "PO Number:", po.POID)
+	detailRow(pdf, "Date:", formatDate(cfg, po.CreatedAt))
+	detailRow(pdf, "Status:", po.Status)
+	detailRow(pdf, "Supplier:", supplierName)
+	detailRow(pdf, "Project:", projectName)
+	pdf.Ln(5)
+
+	widths := []float64{15, 115, 30, 30}
+	pdf.SetFont("Arial", "B", 11)
+	pdf.SetFillColor(230, 230, 230)
+	for i, h := range []string{"#", "Description", "Quantity", "UOM"} {
+		pdf.CellFormat(widths[i], 8, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Arial", "", 10)
+	for i, item := range po.Items {
+		MultiCellRow(pdf, []string{
+			fmt.Sprintf("%d", i+1),
+			item.Description,
+			fmt.Sprintf("%d", item.Quantity),
+			item.UOM,
+		}, widths, 6)
+	}
+
+	drawSignatories(cfg, pdf, signatories)
+
+	file := OutputPath(cfg, fmt.Sprintf("supplier_po_%s_%d.pdf", po.ID.Hex(), time.Now().Unix()))
+	err := pdf.OutputFileAndClose(file)
+	return file, err
+}
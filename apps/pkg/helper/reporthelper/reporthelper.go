@@ -4,15 +4,23 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
 	"github.com/jung-kurt/gofpdf"
 	"github.com/xuri/excelize/v2"
 )
 
-func GenerateCustomerCSV(data []models.Customer) (string, error) {
-	filePath := "/tmp/customer_report.csv"
+// OutputPath is where a generated file with this name is written, under the
+// configured storage directory
+func OutputPath(cfg config.Config, name string) string {
+	return filepath.Join(cfg.Storage.Dir, name)
+}
+
+func GenerateCustomerCSV(cfg config.Config, data []models.Customer) (string, error) {
+	filePath := OutputPath(cfg, "customer_report.csv")
 	file, err := os.Create(filePath)
 	if err != nil {
 		return "", err
@@ -38,7 +46,7 @@ func GenerateCustomerCSV(data []models.Customer) (string, error) {
 	return filePath, nil
 }
 
-func GenerateCustomerPDF(customers []models.Customer, start, end time.Time) (string, error) {
+func GenerateCustomerPDF(cfg config.Config, customers []models.Customer, start, end time.Time) (string, error) {
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.SetTitle("Customer Report", false)
 	pdf.AliasNbPages("")
@@ -85,12 +93,12 @@ func GenerateCustomerPDF(customers []models.Customer, start, end time.Time) (str
 		}
 		MultiCellRow(pdf, cols, widths, 6)
 	}
-	file := fmt.Sprintf("/tmp/customer_report_%d.pdf", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("customer_report_%d.pdf", time.Now().Unix()))
 	err := pdf.OutputFileAndClose(file)
 	return file, err
 }
 
-func GenerateCustomerExcel(customers []models.Customer) (string, error) {
+func GenerateCustomerExcel(cfg config.Config, customers []models.Customer) (string, error) {
 	f := excelize.NewFile()
 	sheet := "Report"
 
@@ -122,13 +130,13 @@ func GenerateCustomerExcel(customers []models.Customer) (string, error) {
 		f.SetColWidth(sheet, col, col, 22)
 	}
 
-	file := fmt.Sprintf("/tmp/customer_report_%d.xlsx", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("customer_report_%d.xlsx", time.Now().Unix()))
 	err := f.SaveAs(file)
 	return file, err
 }
 
-func GenerateInventoryCSV(data []models.PolarisInventory) (string, error) {
-	filePath := fmt.Sprintf("/tmp/inventory_report_%d.csv", time.Now().Unix())
+func GenerateInventoryCSV(cfg config.Config, data []models.PolarisInventory) (string, error) {
+	filePath := OutputPath(cfg, fmt.Sprintf("inventory_report_%d.csv", time.Now().Unix()))
 	file, err := os.Create(filePath)
 	if err != nil {
 		return "", err
@@ -160,7 +168,7 @@ func GenerateInventoryCSV(data []models.PolarisInventory) (string, error) {
 	return filePath, nil
 }
 
-func GenerateInventoryExcel(items []models.PolarisInventory) (string, error) {
+func GenerateInventoryExcel(cfg config.Config, items []models.PolarisInventory) (string, error) {
 	f := excelize.NewFile()
 	sheet := "Inventory"
 
@@ -190,12 +198,12 @@ func GenerateInventoryExcel(items []models.PolarisInventory) (string, error) {
 		row++
 	}
 
-	filePath := fmt.Sprintf("/tmp/inventory_report_%d.xlsx", time.Now().Unix())
+	filePath := OutputPath(cfg, fmt.Sprintf("inventory_report_%d.xlsx", time.Now().Unix()))
 	err := f.SaveAs(filePath)
 	return filePath, err
 }
 
-func GenerateInventoryPDF(items []models.PolarisInventory, start, end time.Time) (string, error) {
+func GenerateInventoryPDF(cfg config.Config, items []models.PolarisInventory, start, end time.Time) (string, error) {
 
 	pdf := gofpdf.New("L", "mm", "A4", "")
 	pdf.SetTitle("Inventory Report", false)
@@ -258,7 +266,7 @@ func GenerateInventoryPDF(items []models.PolarisInventory, start, end time.Time)
 		}
 		MultiCellRow(pdf, cols, widths, 6)
 	}
-	file := fmt.Sprintf("/tmp/inventory_report_%d.pdf", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("inventory_report_%d.pdf", time.Now().Unix()))
 	err := pdf.OutputFileAndClose(file)
 	return file, err
 }
@@ -289,9 +297,9 @@ func MultiCellRow(pdf *gofpdf.Fpdf, cols []string, widths []float64, lineHeight
 	pdf.Ln(rowHeight)
 }
 
-func GenerateSupplierCSV(data []models.Supplier) (string, error) {
+func GenerateSupplierCSV(cfg config.Config, data []models.Supplier) (string, error) {
 
-	filePath := fmt.Sprintf("/tmp/supplier_report_%d.csv", time.Now().Unix())
+	filePath := OutputPath(cfg, fmt.Sprintf("supplier_report_%d.csv", time.Now().Unix()))
 	file, err := os.Create(filePath)
 	if err != nil {
 		return "", err
@@ -320,7 +328,7 @@ func GenerateSupplierCSV(data []models.Supplier) (string, error) {
 	return filePath, nil
 }
 
-func GenerateSupplierExcel(suppliers []models.Supplier) (string, error) {
+func GenerateSupplierExcel(cfg config.Config, suppliers []models.Supplier) (string, error) {
 
 	f := excelize.NewFile()
 	sheet := "Suppliers"
@@ -353,12 +361,12 @@ func GenerateSupplierExcel(suppliers []models.Supplier) (string, error) {
 		f.SetColWidth(sheet, col, col, 22)
 	}
 
-	file := fmt.Sprintf("/tmp/supplier_report_%d.xlsx", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("supplier_report_%d.xlsx", time.Now().Unix()))
 	err := f.SaveAs(file)
 	return file, err
 }
 
-func GenerateSupplierPDF(suppliers []models.Supplier, start, end time.Time) (string, error) {
+func GenerateSupplierPDF(cfg config.Config, suppliers []models.Supplier, start, end time.Time) (string, error) {
 
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.SetTitle("Supplier Report", false)
@@ -417,23 +425,23 @@ func GenerateSupplierPDF(suppliers []models.Supplier, start, end time.Time) (str
 		MultiCellRow(pdf, cols, widths, 6)
 	}
 
-	file := fmt.Sprintf("/tmp/supplier_report_%d.pdf", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("supplier_report_%d.pdf", time.Now().Unix()))
 	err := pdf.OutputFileAndClose(file)
 
 	return file, err
 }
 
 type SalesInvoiceReportRow struct {
-	InvoiceID    string
-	ProjectName  string
-	CustomerName string
-	TotalAmount  float64
-	CreatedAt    time.Time
+	InvoiceID    string    `bson:"invoice_id"`
+	ProjectName  string    `bson:"project_name"`
+	CustomerName string    `bson:"customer_name"`
+	TotalAmount  float64   `bson:"total_amount"`
+	CreatedAt    time.Time `bson:"created_at"`
 }
 
-func GenerateSalesInvoiceCSV(data []SalesInvoiceReportRow) (string, error) {
+func GenerateSalesInvoiceCSV(cfg config.Config, data []SalesInvoiceReportRow) (string, error) {
 
-	filePath := fmt.Sprintf("/tmp/sales_invoice_report_%d.csv", time.Now().Unix())
+	filePath := OutputPath(cfg, fmt.Sprintf("sales_invoice_report_%d.csv", time.Now().Unix()))
 	file, err := os.Create(filePath)
 	if err != nil {
 		return "", err
@@ -460,7 +468,7 @@ func GenerateSalesInvoiceCSV(data []SalesInvoiceReportRow) (string, error) {
 	return filePath, nil
 }
 
-func GenerateSalesInvoiceExcel(data []SalesInvoiceReportRow) (string, error) {
+func GenerateSalesInvoiceExcel(cfg config.Config, data []SalesInvoiceReportRow) (string, error) {
 
 	f := excelize.NewFile()
 	sheet := "Sales Invoice"
@@ -490,12 +498,12 @@ func GenerateSalesInvoiceExcel(data []SalesInvoiceReportRow) (string, error) {
 		f.SetColWidth(sheet, col, col, 22)
 	}
 
-	file := fmt.Sprintf("/tmp/sales_invoice_report_%d.xlsx", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("sales_invoice_report_%d.xlsx", time.Now().Unix()))
 	err := f.SaveAs(file)
 	return file, err
 }
 
-func GenerateSalesInvoicePDF(data []SalesInvoiceReportRow, start, end time.Time) (string, error) {
+func GenerateSalesInvoicePDF(cfg config.Config, data []SalesInvoiceReportRow, start, end time.Time) (string, error) {
 
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.SetTitle("Sales Invoice Report", false)
@@ -551,22 +559,22 @@ func GenerateSalesInvoicePDF(data []SalesInvoiceReportRow, start, end time.Time)
 		MultiCellRow(pdf, row, widths, 6)
 	}
 
-	file := fmt.Sprintf("/tmp/sales_invoice_report_%d.pdf", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("sales_invoice_report_%d.pdf", time.Now().Unix()))
 	err := pdf.OutputFileAndClose(file)
 	return file, err
 }
 
 type FinancialReportRow struct {
-	Category    string // Supplier / Sales
-	InvoiceNo   string
-	ProjectName string
-	EntityName  string // Supplier or Customer
-	Amount      float64
-	Date        time.Time
+	Category    string    `bson:"category"` // Supplier / Sales
+	InvoiceNo   string    `bson:"invoice_no"`
+	ProjectName string    `bson:"project_name"`
+	EntityName  string    `bson:"entity_name"` // Supplier or Customer
+	Amount      float64   `bson:"amount"`
+	Date        time.Time `bson:"date"`
 }
 
-func GenerateFinancialCSV(data []FinancialReportRow) (string, error) {
-	filePath := fmt.Sprintf("/tmp/financial_report_%d.csv", time.Now().Unix())
+func GenerateFinancialCSV(cfg config.Config, data []FinancialReportRow) (string, error) {
+	filePath := OutputPath(cfg, fmt.Sprintf("financial_report_%d.csv", time.Now().Unix()))
 	f, err := os.Create(filePath)
 	if err != nil {
 		return "", err
@@ -594,7 +602,7 @@ func GenerateFinancialCSV(data []FinancialReportRow) (string, error) {
 	return filePath, nil
 }
 
-func GenerateFinancialExcel(rows []FinancialReportRow) (string, error) {
+func GenerateFinancialExcel(cfg config.Config, rows []FinancialReportRow) (string, error) {
 
 	f := excelize.NewFile()
 	sheet := "Financial"
@@ -618,12 +626,12 @@ func GenerateFinancialExcel(rows []FinancialReportRow) (string, error) {
 		row++
 	}
 
-	filePath := fmt.Sprintf("/tmp/financial_report_%d.xlsx", time.Now().Unix())
+	filePath := OutputPath(cfg, fmt.Sprintf("financial_report_%d.xlsx", time.Now().Unix()))
 	err := f.SaveAs(filePath)
 	return filePath, err
 }
 
-func GenerateFinancialPDF(rows []FinancialReportRow, start, end time.Time) (string, error) {
+func GenerateFinancialPDF(cfg config.Config, rows []FinancialReportRow, start, end time.Time) (string, error) {
 
 	pdf := gofpdf.New("L", "mm", "A4", "")
 	pdf.AddPage()
@@ -661,7 +669,7 @@ func GenerateFinancialPDF(rows []FinancialReportRow, start, end time.Time) (stri
 		MultiCellRow(pdf, cols, widths, 6)
 	}
 
-	file := fmt.Sprintf("/tmp/financial_report_%d.pdf", time.Now().Unix())
+	file := OutputPath(cfg, fmt.Sprintf("financial_report_%d.pdf", time.Now().Unix()))
 	err := pdf.OutputFileAndClose(file)
 	return file, err
 }
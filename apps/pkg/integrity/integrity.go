@@ -0,0 +1,255 @@
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reference is a field holding the _id of a document in another collection
+type Reference struct {
+	Collection string
+	Field      string
+	Target     string
+	Many       bool // the field is an array of IDs
+	// Backlink marks a parent pointing at one of its children. It must
+	// resolve like any reference but does not keep the child from being
+	// deleted.
+	Backlink bool
+	// Optional references may be cleared when their target is gone
+	Optional bool
+}
+
+// References lists every ObjectID reference between business documents
+var References = []Reference{
+	{Collection: "user", Field: "roles", Target: "role"},
+	{Collection: "user", Field: "roleIds", Target: "role", Many: true},
+	{Collection: "role", Field: "menus", Target: "menu", Many: true},
+
+	{Collection: "project", Field: "customer_id", Target: "customer"},
+	{Collection: "project", Field: "sales_order_id", Target: "salesorder", Backlink: true},
+	{Collection: "project", Field: "supplier_po_ids", Target: "supplier_purchase_orders", Many: true, Backlink: true},
+	{Collection: "project", Field: "supplier_receipt_id", Target: "supplierdeliveryreceipt", Backlink: true},
+	{Collection: "project", Field: "supplier_invoice_id", Target: "supplierinvoice", Backlink: true},
+	{Collection: "project", Field: "supplier_ids", Target: "supplier", Many: true, Backlink: true},
+	{Collection: "project", Field: "sales_invoice_id", Target: "sales_invoices", Backlink: true},
+	{Collection: "project", Field: "sales_dr_id", Target: "delivery_receipts", Backlink: true},
+
+	{Collection: "salesorder", Field: "projectId", Target: "project"},
+	{Collection: "salesorder", Field: "customerId", Target: "customer"},
+	{Collection: "salesorder", Field: "items.airconId", Target: "aircon", Many: true},
+
+	{Collection: "supplier_purchase_orders", Field: "projectId", Target: "project"},
+	{Collection: "supplier_purchase_orders", Field: "supplierId", Target: "supplier"},
+	{Collection: "supplier_purchase_orders", Field: "soId", Target: "salesorder", Optional: true},
+
+	{Collection: "supplierdeliveryreceipt", Field: "project_id", Target: "project"},
+	{Collection: "supplierdeliveryreceipt", Field: "supplier_id", Target: "supplier"},
+	{Collection: "supplierinvoice", Field: "project_id", Target: "project"},
+	{Collection: "supplierinvoice", Field: "supplier_id", Target: "supplier"},
+
+	{Collection: "polaris_receiving_reports", Field: "supplier_dr_id", Target: "supplierdeliveryreceipt", Optional: true},
+	{Collection: "polaris_receiving_reports", Field: "supplier_invoice_id", Target: "supplierinvoice", Optional: true},
+	{Collection: "polaris_receiving_reports", Field: "purchase_order_id", Target: "supplier_purchase_orders", Optional: true},
+	{Collection: "polaris_receiving_reports", Field: "sales_order_id", Target: "salesorder", Optional: true},
+
+	{Collection: "sales_invoices", Field: "project_id", Target: "project"},
+	{Collection: "sales_invoices", Field: "customer_id", Target: "customer"},
+	{Collection: "sales_invoices", Field: "sales_order_id", Target: "salesorder"},
+
+	{Collection: "delivery_receipts", Field: "project_id", Target: "project"},
+	{Collection: "delivery_receipts", Field: "customer_id", Target: "customer"},
+	{Collection: "delivery_receipts", Field: "sales_order_id", Target: "salesorder"},
+	{Collection: "delivery_receipts", Field: "sales_invoice_id", Target: "sales_invoices"},
+
+	{Collection: "session", Field: "userId", Target: "user"},
+	{Collection: "passwordreset", Field: "userId", Target: "user"},
+	{Collection: "invite", Field: "roleId", Target: "role"},
+	{Collection: "invite", Field: "invitedBy", Target: "user"},
+	{Collection: "apikey", Field: "userId", Target: "user"},
+	{Collection: "apikey", Field: "createdBy", Target: "user"},
+
+	{Collection: "salesorder", Field: "createdBy", Target: "user"},
+	{Collection: "supplier_purchase_orders", Field: "createdBy", Target: "user"},
+	{Collection: "supplier_purchase_orders", Field: "approvedBy", Target: "user"},
+	{Collection: "supplierdeliveryreceipt", Field: "received_by", Target: "user"},
+	{Collection: "supplierinvoice", Field: "created_by", Target: "user"},
+	{Collection: "supplier", Field: "created_by", Target: "user"},
+	{Collection: "polaris_inventory", Field: "created_by", Target: "user"},
+	{Collection: "polaris_receiving_reports", Field: "created_by", Target: "user"},
+	{Collection: "delivery_receipts", Field: "prepared_by", Target: "user"},
+	{Collection: "delivery_receipts", Field: "approved_by", Target: "user"},
+}
+
+// Kinds of broken reference
+const (
+	KindMissing = "missing"
+	// KindTrashed is a live document pointing at one in the trash
+	KindTrashed = "trashed"
+)
+
+// Violation is one document pointing at a document that does not exist or
+// is in the trash
+type Violation struct {
+	Collection string             `json:"collection"`
+	ID         primitive.ObjectID `json:"id"`
+	Field      string             `json:"field"`
+	Target     string             `json:"target"`
+	MissingID  primitive.ObjectID `json:"missingId"`
+	Kind       string             `json:"kind"`
+	// Fixable references can be cleared: backlinks and optional fields whose
+	// target is gone for good
+	Fixable bool `json:"fixable"`
+	Fixed   bool `json:"fixed"`
+}
+
+func (v Violation) String() string {
+	s := fmt.Sprintf("%s %s: %s points at %s %s %s",
+		v.Collection, v.ID.Hex(), v.Field, v.Kind, v.Target, v.MissingID.Hex())
+	if v.Fixed {
+		s += " (fixed)"
+	}
+	return s
+}
+
+// CheckReferences reports every reference whose target document is missing,
+// or is in the trash while the referencing document is live. Empty and zero
+// IDs are not references and are skipped.
+func CheckReferences(ctx context.Context, db *mongo.Database) ([]Violation, error) {
+	var violations []Violation
+	for _, ref := range References {
+		found, err := dangling(ctx, db, ref)
+		if err != nil {
+			return violations, fmt.Errorf("%s.%s: %w", ref.Collection, ref.Field, err)
+		}
+		violations = append(violations, found...)
+	}
+	return violations, nil
+}
+
+func dangling(ctx context.Context, db *mongo.Database, ref Reference) ([]Violation, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{"ref": "$" + ref.Field, "deleted_at": 1}}},
+	}
+	if ref.Many {
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$ref"}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$match", Value: bson.M{"ref": bson.M{"$type": "objectId", "$ne": primitive.NilObjectID}}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         ref.Target,
+			"localField":   "ref",
+			"foreignField": "_id",
+			"as":           "target",
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"target": bson.M{"$size": 0}},
+			bson.M{"deleted_at": nil, "target.deleted_at": bson.M{"$ne": nil}},
+		}}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"ref":     1,
+			"missing": bson.M{"$eq": bson.A{bson.M{"$size": "$target"}, 0}},
+		}}},
+	)
+
+	cursor, err := db.Collection(ref.Collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID      primitive.ObjectID `bson:"_id"`
+		Ref     primitive.ObjectID `bson:"ref"`
+		Missing bool               `bson:"missing"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	violations := make([]Violation, 0, len(rows))
+	for _, r := range rows {
+		v := Violation{
+			Collection: ref.Collection,
+			ID:         r.ID,
+			Field:      ref.Field,
+			Target:     ref.Target,
+			MissingID:  r.Ref,
+			Kind:       KindTrashed,
+		}
+		if r.Missing {
+			v.Kind = KindMissing
+			// Nested array fields cannot be cleared by one simple update
+			v.Fixable = (ref.Backlink || ref.Optional) && !strings.Contains(ref.Field, ".")
+		}
+		violations = append(violations, v)
+	}
+	return violations, nil
+}
+
+// Dependent is a live document holding a reference to another one
+type Dependent struct {
+	Collection string             `json:"collection"`
+	ID         primitive.ObjectID `json:"id"`
+	Field      string             `json:"field"`
+	Number     string             `json:"number,omitempty"`
+	Status     string             `json:"status,omitempty"`
+}
+
+// Number fields of documents without a sequence
+var numberFields = map[string]string{
+	"supplierdeliveryreceipt": "supplier_dr_no",
+	"supplierinvoice":         "invoice_no",
+}
+
+func numberField(collection string) string {
+	for _, doc := range sequence.Documents {
+		if doc.Collection == collection {
+			return doc.Field
+		}
+	}
+	return numberFields[collection]
+}
+
+// Dependents lists the live documents that reference id in collection.
+// Backlinks and documents in the trash do not count.
+func Dependents(ctx context.Context, db *mongo.Database, collection string, id primitive.ObjectID) ([]Dependent, error) {
+	var dependents []Dependent
+	for _, ref := range References {
+		if ref.Target != collection || ref.Backlink {
+			continue
+		}
+
+		number := numberField(ref.Collection)
+		projection := bson.M{"status": 1}
+		if number != "" {
+			projection[number] = 1
+		}
+		cursor, err := db.Collection(ref.Collection).Find(ctx,
+			bson.M{ref.Field: id, "deleted_at": nil},
+			options.Find().SetProjection(projection),
+		)
+		if err != nil {
+			return dependents, fmt.Errorf("%s.%s: %w", ref.Collection, ref.Field, err)
+		}
+		var docs []bson.M
+		if err := cursor.All(ctx, &docs); err != nil {
+			return dependents, fmt.Errorf("%s.%s: %w", ref.Collection, ref.Field, err)
+		}
+
+		for _, doc := range docs {
+			d := Dependent{Collection: ref.Collection, Field: ref.Field}
+			d.ID, _ = doc["_id"].(primitive.ObjectID)
+			d.Number, _ = doc[number].(string)
+			d.Status, _ = doc["status"].(string)
+			dependents = append(dependents, d)
+		}
+	}
+	return dependents, nil
+}
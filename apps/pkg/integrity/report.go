@@ -0,0 +1,172 @@
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Report is the result of a full scan
+type Report struct {
+	References []Violation `json:"references"`
+	Totals     []Mismatch  `json:"totals"`
+}
+
+// Open counts the problems that are not fixed
+func (r Report) Open() int {
+	n := 0
+	for _, v := range r.References {
+		if !v.Fixed {
+			n++
+		}
+	}
+	for _, m := range r.Totals {
+		if !m.Fixed {
+			n++
+		}
+	}
+	return n
+}
+
+// Scan checks every reference and every derived total. With fix it also
+// repairs the safe cases, calling changed for each document it updates.
+func Scan(ctx context.Context, db *mongo.Database, fix bool, changed func(collection string, id primitive.ObjectID, before bson.M)) (Report, error) {
+	report := Report{References: []Violation{}, Totals: []Mismatch{}}
+
+	violations, err := CheckReferences(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	if violations != nil {
+		report.References = violations
+	}
+	mismatches, err := CheckTotals(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	if mismatches != nil {
+		report.Totals = mismatches
+	}
+
+	if !fix {
+		return report, nil
+	}
+	if err := FixReferences(ctx, db, report.References, changed); err != nil {
+		return report, err
+	}
+	if err := FixTotals(ctx, db, report.Totals, changed); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// FixReferences clears the fixable references in violations, marks them
+// fixed and calls changed for each document updated. Array fields lose the
+// one ID; other fields are removed.
+func FixReferences(ctx context.Context, db *mongo.Database, violations []Violation, changed func(collection string, id primitive.ObjectID, before bson.M)) error {
+	for i := range violations {
+		v := &violations[i]
+		if !v.Fixable {
+			continue
+		}
+		ref, ok := reference(v.Collection, v.Field)
+		if !ok {
+			continue
+		}
+
+		// The target may have come back since the check
+		n, err := db.Collection(v.Target).CountDocuments(ctx, bson.M{"_id": v.MissingID})
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", v.Target, v.MissingID.Hex(), err)
+		}
+		if n > 0 {
+			continue
+		}
+
+		var before bson.M
+		err = db.Collection(v.Collection).FindOne(ctx, bson.M{"_id": v.ID}).Decode(&before)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", v.Collection, v.ID.Hex(), err)
+		}
+
+		update := bson.M{"$unset": bson.M{v.Field: ""}}
+		if ref.Many {
+			update = bson.M{"$pull": bson.M{v.Field: v.MissingID}}
+		}
+		res, err := db.Collection(v.Collection).UpdateOne(ctx,
+			bson.M{"_id": v.ID, v.Field: v.MissingID},
+			version.Bump(update),
+		)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", v.Collection, v.ID.Hex(), err)
+		}
+		if res.ModifiedCount > 0 {
+			v.Fixed = true
+			if changed != nil {
+				changed(v.Collection, v.ID, before)
+			}
+		}
+	}
+	return nil
+}
+
+func reference(collection, field string) (Reference, bool) {
+	for _, ref := range References {
+		if ref.Collection == collection && ref.Field == field {
+			return ref, true
+		}
+	}
+	return Reference{}, false
+}
+
+// GetIntegrityReport scans the database and returns the problems found
+func GetIntegrityReport(c *gin.Context, db *mongo.Database) {
+	if _, exists := c.Get("user"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	report, err := Scan(c, db, false, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Integrity check failed", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report, "open": report.Open()})
+}
+
+// FixIntegrity scans the database and repairs the safe cases: references
+// that are optional or point from a parent to a child that is gone, and
+// server-computed totals that disagree with their line items. Super admins
+// only.
+func FixIntegrity(c *gin.Context, db *mongo.Database) {
+	value, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	user, ok := value.(*models.User)
+	if !ok || !user.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	report, err := Scan(c, db, true, func(collection string, id primitive.ObjectID, before bson.M) {
+		audit.Changed(c, db, collection, id, audit.ActionUpdate, before)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Integrity fix failed", "details": err.Error(), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"report": report, "open": report.Open()})
+}
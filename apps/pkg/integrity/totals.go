@@ -0,0 +1,197 @@
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Totals is how a document's amounts derive from its line items: each item's
+// amount is quantity times price, the total is the sum of the amounts and,
+// where there is a grand total, it is the total plus tax.
+type Totals struct {
+	Collection string
+	Items      string
+	Qty        string
+	Price      string
+	Amount     string
+	Total      string
+	Tax        string
+	Grand      string
+	// Fixable amounts are computed by the server, so the line items are the
+	// truth. Amounts copied from a paper document are only reported.
+	Fixable bool
+}
+
+// TotalRules lists every document with derived amounts
+var TotalRules = []Totals{
+	{Collection: "salesorder", Items: "items", Qty: "qty", Price: "price", Amount: "subtotal", Total: "totalAmount", Fixable: true},
+	{Collection: "sales_invoices", Items: "items", Qty: "quantity", Price: "unit_price", Amount: "amount", Total: "total_amount", Fixable: true},
+	// Supplier invoices hold what the supplier's invoice says, even when the
+	// supplier added it up wrong
+	{Collection: "supplierinvoice", Items: "items", Qty: "qty", Price: "unit_price", Amount: "amount", Total: "total_sales", Tax: "vat", Grand: "grand_total"},
+}
+
+// Amounts closer than half a centavo are equal
+const tolerance = 0.005
+
+// Mismatch is one stored amount that differs from the one recomputed from
+// the line items
+type Mismatch struct {
+	Collection string             `json:"collection"`
+	ID         primitive.ObjectID `json:"id"`
+	Field      string             `json:"field"`
+	Stored     float64            `json:"stored"`
+	Computed   float64            `json:"computed"`
+	Fixable    bool               `json:"fixable"`
+	Fixed      bool               `json:"fixed"`
+}
+
+func (m Mismatch) String() string {
+	s := fmt.Sprintf("%s %s: %s is %.2f, items give %.2f",
+		m.Collection, m.ID.Hex(), m.Field, m.Stored, m.Computed)
+	if m.Fixed {
+		s += " (fixed)"
+	}
+	return s
+}
+
+// CheckTotals recomputes the derived amounts of every live document and
+// reports the ones that differ
+func CheckTotals(ctx context.Context, db *mongo.Database) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	for _, rule := range TotalRules {
+		err := eachLive(ctx, db, rule.Collection, func(doc bson.M) error {
+			found, _ := rule.recompute(doc)
+			mismatches = append(mismatches, found...)
+			return nil
+		})
+		if err != nil {
+			return mismatches, fmt.Errorf("%s: %w", rule.Collection, err)
+		}
+	}
+	return mismatches, nil
+}
+
+// recompute reports the mismatches in doc and returns the $set that
+// corrects them
+func (t Totals) recompute(doc bson.M) ([]Mismatch, bson.M) {
+	id, _ := doc["_id"].(primitive.ObjectID)
+	var found []Mismatch
+	set := bson.M{}
+	check := func(field string, stored, computed float64) {
+		if math.Abs(stored-computed) > tolerance {
+			found = append(found, Mismatch{Collection: t.Collection, ID: id, Field: field, Stored: stored, Computed: computed, Fixable: t.Fixable})
+			set[field] = computed
+		}
+	}
+
+	items, _ := doc[t.Items].(primitive.A)
+	var total float64
+	for i, raw := range items {
+		item, ok := raw.(bson.M)
+		if !ok {
+			continue
+		}
+		amount := number(item[t.Qty]) * number(item[t.Price])
+		check(fmt.Sprintf("%s.%d.%s", t.Items, i, t.Amount), number(item[t.Amount]), amount)
+		total += amount
+	}
+	check(t.Total, number(doc[t.Total]), total)
+	if t.Grand != "" {
+		check(t.Grand, number(doc[t.Grand]), total+number(doc[t.Tax]))
+	}
+	return found, set
+}
+
+// FixTotals writes the recomputed amounts of the fixable documents in
+// mismatches, marks them fixed and calls changed for each document updated.
+// A document edited since the check is left for the next run.
+func FixTotals(ctx context.Context, db *mongo.Database, mismatches []Mismatch, changed func(collection string, id primitive.ObjectID, before bson.M)) error {
+	rules := make(map[string]Totals, len(TotalRules))
+	for _, rule := range TotalRules {
+		rules[rule.Collection] = rule
+	}
+
+	done := map[primitive.ObjectID]bool{}
+	for i, m := range mismatches {
+		if !m.Fixable || done[m.ID] {
+			continue
+		}
+		done[m.ID] = true
+
+		var doc bson.M
+		err := db.Collection(m.Collection).FindOne(ctx, bson.M{"_id": m.ID, "deleted_at": nil}).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", m.Collection, m.ID.Hex(), err)
+		}
+
+		_, set := rules[m.Collection].recompute(doc)
+		if len(set) == 0 {
+			continue
+		}
+		res, err := db.Collection(m.Collection).UpdateOne(ctx,
+			version.Filter(m.ID, version.Of(doc)),
+			version.Bump(bson.M{"$set": set}),
+		)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", m.Collection, m.ID.Hex(), err)
+		}
+		if res.MatchedCount == 0 {
+			continue
+		}
+
+		for j := i; j < len(mismatches); j++ {
+			if mismatches[j].ID == m.ID {
+				if _, ok := set[mismatches[j].Field]; ok {
+					mismatches[j].Fixed = true
+				}
+			}
+		}
+		if changed != nil {
+			changed(m.Collection, m.ID, doc)
+		}
+	}
+	return nil
+}
+
+// eachLive calls fn for every document of collection not in the trash
+func eachLive(ctx context.Context, db *mongo.Database, collection string, fn func(doc bson.M) error) error {
+	cursor, err := db.Collection(collection).Find(ctx, bson.M{"deleted_at": nil})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// number reads any numeric BSON value; missing and other types are 0
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,506 @@
+package listquery
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Every list endpoint reads the same query string:
+//
+//	filter[status]=approved            equals
+//	filter[created_at][gte]=2024-01-01 ranges: eq ne gt gte lt lte, and in
+//	filter[status][in]=draft,approved  with a comma separated list
+//	sort=-created_at,po_id             fields the resource allows; - is descending
+//	q=acme                             case-insensitive search
+//	limit=20&offset=40                 or page=3 as before
+//	cursor=...                         nextCursor from the previous page
+//
+// and answers with the same envelope. Each resource declares a Spec naming
+// what may be filtered, sorted and searched; anything else is a 400.
+
+const (
+	DefaultLimit = 10
+	MaxLimit     = 100
+	maxSearch    = 100
+)
+
+// Kind is how a filter value is parsed
+type Kind int
+
+const (
+	String Kind = iota
+	ObjectID
+	Date
+	Number
+)
+
+// Field is a filterable field of a resource
+type Field struct {
+	// Path is the document field; it defaults to the name used in the query
+	Path string
+	Kind Kind
+	// Sort allows the field in sort=
+	Sort bool
+}
+
+// Spec declares how a resource can be listed
+type Spec struct {
+	Fields map[string]Field
+	// Search are the document fields q= looks in
+	Search []string
+	// Sort is the default sort, in sort= syntax
+	Sort string
+	// Limit is the default page size; DefaultLimit when 0
+	Limit int64
+}
+
+// Query is a parsed list request
+type Query struct {
+	Limit  int64
+	Offset int64
+
+	filter bson.M
+	sort   bson.D
+	order  string
+	after  bson.M
+}
+
+// Page describes the page a query returned
+type Page struct {
+	Total      int64  `json:"total"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+	Page       int64  `json:"page"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+var (
+	filterParam = regexp.MustCompile(`^filter\[([A-Za-z0-9_]+)\](?:\[([a-z]+)\])?$`)
+	operators   = map[string]string{"eq": "", "ne": "$ne", "gt": "$gt", "gte": "$gte", "lt": "$lt", "lte": "$lte", "in": "$in"}
+)
+
+// Parse reads the list parameters against spec. It answers 400 itself and
+// returns false when they are invalid.
+func Parse(c *gin.Context, spec Spec) (Query, bool) {
+	q, err := parse(c, spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return q, false
+	}
+	return q, true
+}
+
+func parse(c *gin.Context, spec Spec) (Query, error) {
+	q := Query{Limit: spec.Limit, filter: bson.M{}}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
+			q.Limit = v
+		}
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.ParseInt(o, 10, 64); err == nil && v >= 0 {
+			q.Offset = v
+		}
+	} else if p := c.Query("page"); p != "" {
+		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
+			q.Offset = (v - 1) * q.Limit
+		}
+	}
+
+	if err := q.parseFilters(c, spec); err != nil {
+		return q, err
+	}
+	if err := q.parseSearch(c.Query("q"), spec); err != nil {
+		return q, err
+	}
+	if err := q.parseSort(c.DefaultQuery("sort", spec.Sort), spec); err != nil {
+		return q, err
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if err := q.parseCursor(cursor); err != nil {
+			return q, err
+		}
+		q.Offset = 0
+	}
+	trash.Live(q.filter)
+	return q, nil
+}
+
+func (q *Query) parseFilters(c *gin.Context, spec Spec) error {
+	params := c.Request.URL.Query()
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "filter[") {
+			continue
+		}
+		m := filterParam.FindStringSubmatch(key)
+		if m == nil {
+			return fmt.Errorf("invalid filter parameter %q", key)
+		}
+		field, ok := spec.Fields[m[1]]
+		if !ok {
+			return fmt.Errorf("cannot filter on %q; allowed: %s", m[1], strings.Join(names(spec, false), ", "))
+		}
+		op := m[2]
+		if op == "" {
+			op = "eq"
+		}
+		if _, ok := operators[op]; !ok {
+			return fmt.Errorf("unknown filter operator %q; use eq, ne, gt, gte, lt, lte or in", op)
+		}
+
+		raw := params[key][len(params[key])-1]
+		cond, err := condition(field.Kind, op, raw)
+		if err != nil {
+			return fmt.Errorf("filter[%s]: %v", m[1], err)
+		}
+		q.add(path(m[1], field), cond)
+	}
+	return nil
+}
+
+// add merges a condition into the filter, so ranges on one field combine
+func (q *Query) add(path string, cond interface{}) {
+	ops, isOps := cond.(bson.M)
+	existing, hasOps := q.filter[path].(bson.M)
+	if isOps && hasOps {
+		for k, v := range ops {
+			existing[k] = v
+		}
+		return
+	}
+	if _, taken := q.filter[path]; taken {
+		q.filter["$and"] = append(and(q.filter), bson.M{path: cond})
+		return
+	}
+	q.filter[path] = cond
+}
+
+func and(filter bson.M) bson.A {
+	clauses, _ := filter["$and"].(bson.A)
+	return clauses
+}
+
+// condition is the query for one filter. A date without a time stands for
+// the whole day.
+func condition(kind Kind, op, raw string) (interface{}, error) {
+	if op == "in" {
+		var values bson.A
+		for _, part := range strings.Split(raw, ",") {
+			v, _, err := value(kind, strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return bson.M{"$in": values}, nil
+	}
+
+	v, day, err := value(kind, raw)
+	if err != nil {
+		return nil, err
+	}
+	if day {
+		start := v.(time.Time)
+		end := start.AddDate(0, 0, 1)
+		switch op {
+		case "eq":
+			return bson.M{"$gte": start, "$lt": end}, nil
+		case "ne":
+			return bson.M{"$not": bson.M{"$gte": start, "$lt": end}}, nil
+		case "gt":
+			return bson.M{"$gte": end}, nil
+		case "lte":
+			return bson.M{"$lt": end}, nil
+		}
+	}
+	if op == "eq" {
+		return v, nil
+	}
+	return bson.M{operators[op]: v}, nil
+}
+
+// value parses raw for kind and reports whether it is a date without a time
+func value(kind Kind, raw string) (interface{}, bool, error) {
+	switch kind {
+	case ObjectID:
+		id, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			return nil, false, fmt.Errorf("%q is not an ID", raw)
+		}
+		return id, false, nil
+	case Date:
+		if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			return t, false, nil
+		}
+		t, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, false, fmt.Errorf("%q is not a date; use YYYY-MM-DD or RFC 3339", raw)
+		}
+		return t, true, nil
+	case Number:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("%q is not a number", raw)
+		}
+		return n, false, nil
+	}
+	return raw, false, nil
+}
+
+func (q *Query) parseSearch(text string, spec Spec) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if len(spec.Search) == 0 {
+		return fmt.Errorf("this list does not support q")
+	}
+	if len(text) > maxSearch {
+		return fmt.Errorf("q is limited to %d characters", maxSearch)
+	}
+	pattern := primitive.Regex{Pattern: regexp.QuoteMeta(text), Options: "i"}
+	var alternatives bson.A
+	for _, field := range spec.Search {
+		alternatives = append(alternatives, bson.M{field: pattern})
+	}
+	q.filter["$and"] = append(and(q.filter), bson.M{"$or": alternatives})
+	return nil
+}
+
+func (q *Query) parseSort(order string, spec Spec) error {
+	q.order = order
+	dir := -1
+	for _, part := range strings.Split(order, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		dir = 1
+		name := part
+		if strings.HasPrefix(part, "-") {
+			dir = -1
+			name = part[1:]
+		}
+		field, ok := spec.Fields[name]
+		if !ok || !field.Sort {
+			return fmt.Errorf("cannot sort on %q; allowed: %s", name, strings.Join(names(spec, true), ", "))
+		}
+		q.sort = append(q.sort, bson.E{Key: path(name, field), Value: dir})
+	}
+	// _id breaks ties so pages and cursors are stable
+	q.sort = append(q.sort, bson.E{Key: "_id", Value: dir})
+	return nil
+}
+
+// cursor is the position after the last document of a page. It is only
+// valid with the sort it was made for.
+type cursor struct {
+	Sort string `bson:"s"`
+	Key  bson.A `bson:"k"`
+}
+
+func (q *Query) parseCursor(raw string) error {
+	invalid := fmt.Errorf("invalid cursor")
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return invalid
+	}
+	var cur cursor
+	if err := bson.Unmarshal(data, &cur); err != nil || len(cur.Key) != len(q.sort) {
+		return invalid
+	}
+	if cur.Sort != q.order {
+		return fmt.Errorf("cursor was made for another sort; start again without it")
+	}
+
+	// After (a, b, id) means a beyond, or a equal and b beyond, and so on
+	var alternatives bson.A
+	for i := range q.sort {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[q.sort[j].Key] = cur.Key[j]
+		}
+		beyond, ok := after(q.sort[i].Value.(int), cur.Key[i])
+		if !ok {
+			continue
+		}
+		clause[q.sort[i].Key] = beyond
+		alternatives = append(alternatives, clause)
+	}
+	if len(alternatives) == 0 {
+		alternatives = bson.A{bson.M{"_id": bson.M{"$exists": false}}}
+	}
+	q.after = bson.M{"$or": alternatives}
+	return nil
+}
+
+// after is the condition for values past v in the direction dir. Missing
+// values sort first, so nothing comes before them.
+func after(dir int, v interface{}) (bson.M, bool) {
+	if v == nil {
+		if dir < 0 {
+			return nil, false
+		}
+		return bson.M{"$ne": nil}, true
+	}
+	if dir < 0 {
+		return bson.M{"$lt": v}, true
+	}
+	return bson.M{"$gt": v}, true
+}
+
+// Filter is the query for every matching live document, without the cursor
+func (q Query) Filter() bson.M {
+	return q.filter
+}
+
+// Match is the query for the documents from the cursor on
+func (q Query) Match() bson.M {
+	if q.after == nil {
+		return q.filter
+	}
+	return bson.M{"$and": bson.A{q.filter, q.after}}
+}
+
+// Pipeline selects the page and then runs shape over it, so lookups and
+// projections only touch the documents returned. Its single result has the
+// page under data and the sort key of the last document under last.
+func (q Query) Pipeline(shape ...bson.D) mongo.Pipeline {
+	keys := bson.A{}
+	for _, e := range q.sort {
+		keys = append(keys, "$"+e.Key)
+	}
+	data := bson.A{}
+	for _, stage := range shape {
+		data = append(data, stage)
+	}
+	if len(data) == 0 {
+		data = append(data, bson.M{"$match": bson.M{}})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: q.Match()}},
+		{{Key: "$sort", Value: q.sort}},
+	}
+	if q.Offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: q.Offset}})
+	}
+	return append(pipeline,
+		bson.D{{Key: "$limit", Value: q.Limit}},
+		bson.D{{Key: "$facet", Value: bson.M{
+			"data": data,
+			"last": bson.A{bson.M{"$group": bson.M{
+				"_id":   nil,
+				"count": bson.M{"$sum": 1},
+				"key":   bson.M{"$last": keys},
+			}}},
+		}}},
+	)
+}
+
+// Run lists the page from collection into results, a pointer to a slice,
+// and counts every match
+func (q Query) Run(ctx context.Context, collection *mongo.Collection, results interface{}, shape ...bson.D) (Page, error) {
+	page := Page{Limit: q.Limit, Offset: q.Offset, Page: q.Offset/q.Limit + 1}
+
+	cur, err := collection.Aggregate(ctx, q.Pipeline(shape...))
+	if err != nil {
+		return page, err
+	}
+	defer cur.Close(ctx)
+
+	var out []struct {
+		Data bson.RawValue `bson:"data"`
+		Last []struct {
+			Count int64  `bson:"count"`
+			Key   bson.A `bson:"key"`
+		} `bson:"last"`
+	}
+	if err := cur.All(ctx, &out); err != nil {
+		return page, err
+	}
+	if len(out) > 0 {
+		if err := out[0].Data.Unmarshal(results); err != nil {
+			return page, err
+		}
+		if len(out[0].Last) > 0 && out[0].Last[0].Count == q.Limit {
+			page.NextCursor, err = encode(cursor{Sort: q.order, Key: out[0].Last[0].Key})
+			if err != nil {
+				return page, err
+			}
+		}
+	}
+
+	page.Total, err = collection.CountDocuments(ctx, q.filter)
+	return page, err
+}
+
+func encode(cur cursor) (string, error) {
+	data, err := bson.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Envelope is the response body every list endpoint sends
+func Envelope(data interface{}, page Page) gin.H {
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice && v.IsNil() {
+		data = []interface{}{}
+	}
+	body := gin.H{
+		"data":   data,
+		"total":  page.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+		"page":   page.Page,
+	}
+	if page.NextCursor != "" {
+		body["nextCursor"] = page.NextCursor
+	}
+	return body
+}
+
+func path(name string, field Field) string {
+	if field.Path != "" {
+		return field.Path
+	}
+	return name
+}
+
+func names(spec Spec, sortable bool) []string {
+	var list []string
+	for name, field := range spec.Fields {
+		if !sortable || field.Sort {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	HTTPRequests = NewCounterVec("polaris_http_requests_total",
+		"HTTP requests by route and status code.", "method", "route", "status")
+	HTTPErrors = NewCounterVec("polaris_http_request_errors_total",
+		"HTTP requests that ended with a 4xx or 5xx status.", "method", "route", "status")
+	HTTPDuration = NewHistogramVec("polaris_http_request_duration_seconds",
+		"HTTP request latency by route; outcome is ok, client_error or server_error.", nil, "method", "route", "outcome")
+
+	MongoDuration = NewHistogramVec("polaris_mongo_command_duration_seconds",
+		"MongoDB command latency by command and collection.", nil, "command", "collection", "outcome")
+
+	InvoicesCreated = NewCounterVec("polaris_invoices_created_total",
+		"Invoices created, by kind (sales or supplier).", "kind")
+	DocumentsCreated = NewCounterVec("polaris_documents_created_total",
+		"Documents created through the API, by collection.", "collection")
+	ReportsGenerated = NewCounterVec("polaris_reports_generated_total",
+		"Reports generated, by report type and file format.", "report", "format")
+)
+
+// ObserveHTTP records one finished request
+func ObserveHTTP(method, route string, status int, elapsed time.Duration) {
+	code := strconv.Itoa(status)
+	HTTPRequests.Inc(method, route, code)
+
+	outcome := "ok"
+	switch {
+	case status >= 500:
+		outcome = "server_error"
+	case status >= 400:
+		outcome = "client_error"
+	}
+	if outcome != "ok" {
+		HTTPErrors.Inc(method, route, code)
+	}
+	HTTPDuration.Observe(elapsed.Seconds(), method, route, outcome)
+}
+
+// MongoMonitor times every command sent to MongoDB. The collection is only
+// known when the command starts, so it is held until the command finishes.
+func MongoMonitor() *event.CommandMonitor {
+	var started sync.Map // request ID -> collection
+
+	finish := func(requestID int64, command string, elapsed time.Duration, outcome string) {
+		collection := ""
+		if v, ok := started.LoadAndDelete(requestID); ok {
+			collection = v.(string)
+		}
+		MongoDuration.Observe(elapsed.Seconds(), command, collection, outcome)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			// The first element of a command names its collection, e.g. {find: "user"}
+			collection := ""
+			if elems, err := e.Command.Elements(); err == nil && len(elems) > 0 {
+				collection, _ = elems[0].Value().StringValueOK()
+			}
+			started.Store(e.RequestID, collection)
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, "ok")
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, e.CommandName, e.Duration, "error")
+		},
+	}
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The metrics are few and fixed, so they are rendered in the Prometheus text
+// format here rather than pulling in the client library.
+
+// Default latency buckets in seconds, from a fast lookup to a slow report
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	mu       sync.Mutex
+	registry []metric
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry = append(registry, m)
+}
+
+// CounterVec is a counter split by label values
+type CounterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds one for the given label values, in the order the labels were declared
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta for the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	key := labelKey(c.labels, values)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braces(key), formatFloat(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram split by label values
+type HistogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram; nil buckets uses DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+	register(h)
+	return h
+}
+
+// Observe records one value for the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := labelKey(h.labels, values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, braces(join(key, `le="`+formatFloat(upper)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, braces(join(key, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braces(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braces(key), s.count)
+	}
+}
+
+// labelKey renders label pairs as they appear inside the braces
+func labelKey(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + escape(value) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func join(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves every registered metric. With a token, scrapers must send
+// it as a bearer token.
+func Handler(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" && c.GetHeader("Authorization") != "Bearer "+token {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+
+		mu.Lock()
+		list := append([]metric(nil), registry...)
+		mu.Unlock()
+		for _, m := range list {
+			m.write(c.Writer)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// ReplayedHeader marks a response served from the idempotency store
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency lets a client retry a create safely. A request carrying an
+// Idempotency-Key runs once; a retry with the same key and body gets the
+// first response back, and the same key with a different body is refused
+// with 409. Only successful responses are kept, so a retry after an error
+// runs again. Requests without the header pass through. It must run after
+// JWTMiddleware; keys are scoped to the caller and route.
+func Idempotency(cfg config.Config, db *mongo.Database) gin.HandlerFunc {
+	ttl := time.Duration(cfg.Server.IdempotencyTTLHours) * time.Hour
+	collection := db.Collection("idempotencykey")
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be 1 to 255 printable characters"})
+			return
+		}
+
+		var userID primitive.ObjectID
+		if value, ok := c.Get("user"); ok {
+			if user, ok := value.(*models.User); ok {
+				userID = user.ID
+			}
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		route := c.Request.Method + " " + c.FullPath()
+		id := digest(userID.Hex(), route, key)
+		requestHash := digest(c.Request.URL.RawQuery, string(body))
+
+		now := time.Now()
+		record := models.IdempotencyKey{
+			ID:          id,
+			UserID:      userID,
+			Route:       route,
+			RequestHash: requestHash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		_, err = collection.InsertOne(c, record)
+		if mongo.IsDuplicateKeyError(err) {
+			// Mongo's TTL monitor only sweeps about once a minute, so a key
+			// past its expiry may still be there; it counts as unused
+			var res *mongo.UpdateResult
+			res, err = collection.ReplaceOne(c, bson.M{"_id": id, "expiresAt": bson.M{"$lte": now}}, record)
+			if err == nil && res.MatchedCount == 0 {
+				replay(c, collection, id, requestHash)
+				return
+			}
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to record Idempotency-Key", "details": err.Error()})
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		stored := false
+		defer func() {
+			// Release the key when the request failed or panicked so a retry
+			// runs again
+			if !stored {
+				collection.DeleteOne(context.Background(), bson.M{"_id": id})
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status < 200 || status >= 300 {
+			return
+		}
+		_, err = collection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{
+			"done":        true,
+			"status":      status,
+			"contentType": writer.Header().Get("Content-Type"),
+			"body":        writer.body.Bytes(),
+		}})
+		if err != nil {
+			Logger(c).WithError(err).Warn("Failed to store idempotent response")
+			return
+		}
+		stored = true
+	}
+}
+
+// replay answers a request whose key was seen before
+func replay(c *gin.Context, collection *mongo.Collection, id, requestHash string) {
+	var record models.IdempotencyKey
+	err := collection.FindOne(c, bson.M{"_id": id, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		// Released or expired in between; the client may simply retry
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "The earlier request with this Idempotency-Key failed or expired; retry"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up Idempotency-Key", "details": err.Error()})
+		return
+	}
+
+	if record.RequestHash != requestHash {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+	if !record.Done {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		return
+	}
+
+	c.Header(ReplayedHeader, "true")
+	c.Data(record.Status, record.ContentType, record.Body)
+	c.Abort()
+}
+
+// validIdempotencyKey accepts 1 to maxIdempotencyKeyLength printable ASCII
+// characters
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func digest(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -2,33 +2,31 @@ package middleware
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/apikey"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/session"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func JWTMiddleware(db *mongo.Database) gin.HandlerFunc {
-	// Load JWT secret from config
-	cfg, err := config.Env()
-	if err != nil {
-		return func(c *gin.Context) {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("failed to load config: %v", err),
-			})
-			c.Abort()
-		}
-	}
-
+func JWTMiddleware(cfg config.Config, db *mongo.Database) gin.HandlerFunc {
 	jwtSecret := []byte(cfg.JWT.Secret)
 
 	return func(c *gin.Context) {
 		// Extract token from Authorization header
+		// Integrations may send an API key instead of a user token
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, db, key)
+			return
+		}
+
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
@@ -39,6 +37,11 @@ func JWTMiddleware(db *mongo.Database) gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
+		if apikey.IsKey(tokenString) {
+			authenticateAPIKey(c, db, tokenString)
+			return
+		}
+
 		// Parse and validate the token
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			// Validate the signing method
@@ -66,6 +69,24 @@ func JWTMiddleware(db *mongo.Database) gin.HandlerFunc {
 			return
 		}
 
+		// Tokens are bound to a session; a revoked session kills the token
+		// before it expires
+		sid, _ := claims["sid"].(string)
+		sessionID, err := primitive.ObjectIDFromHex(sid)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please sign in again"})
+			return
+		}
+		active, err := session.IsActive(c, db, sessionID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please sign in again"})
+			return
+		}
+
 		// Fetch the user from MongoDB
 		var user models.User
 		usersCol := db.Collection("user")
@@ -75,10 +96,43 @@ func JWTMiddleware(db *mongo.Database) gin.HandlerFunc {
 			return
 		}
 
-		// Add user to Gin context
+		if user.Status == "suspended" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Your account is deactivated. Please contact admin."})
+			return
+		}
+
+		// Add user and session to Gin context
 		c.Set("user", &user)
+		c.Set("sessionID", sessionID)
 
 		// Continue to next handler
 		c.Next()
 	}
 }
+
+// authenticateAPIKey resolves a service account from an API key and sets it
+// as the request user. The key's scopes further limit permission.Authorize.
+func authenticateAPIKey(c *gin.Context, db *mongo.Database, raw string) {
+	key, user, err := apikey.Authenticate(c, db, raw)
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify API key"})
+		return
+	}
+
+	if user.Status == "suspended" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "This service account is deactivated"})
+		return
+	}
+
+	c.Set("user", user)
+	c.Set("apiKey", key)
+	if key.Scopes != nil {
+		c.Set(permission.ScopesKey, key.Scopes)
+	}
+
+	c.Next()
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RequirePermission only lets the request through when the caller may reach
+// the screen of at least one of the given menus, as permission.HasAnyMenu
+// decides from the permission matrix. It must run after JWTMiddleware.
+func RequirePermission(db *mongo.Database, menus ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("user")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		user, ok := value.(*models.User)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+			return
+		}
+
+		allowed, err := permission.HasAnyMenu(c, db, user, menus...)
+		if err != nil {
+			logrus.WithError(err).WithField("email", user.Email).Error("Failed to resolve role permissions")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+
+		if !allowed {
+			logrus.WithFields(logrus.Fields{
+				"email":       user.Email,
+				"roles":       user.RoleHexes(),
+				"method":      c.Request.Method,
+				"route":       c.FullPath(),
+				"permissions": menus,
+			}).Warn("Permission denied")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to access this resource"})
+			return
+		}
+
+		c.Next()
+	}
+}
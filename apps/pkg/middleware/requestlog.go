@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey holds the request ID in the gin context
+	RequestIDKey = "requestID"
+
+	maxRequestIDLength = 128
+)
+
+// Probes and scrapes arrive every few seconds; successful ones are counted
+// but not logged
+var quietRoutes = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// RequestID takes the caller's X-Request-ID, e.g. from a load balancer, or
+// makes a new one, and echoes it in the response so a user can quote it
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// Logger returns a log entry tagged with the request ID, for handlers that
+// want their lines to match the access log
+func Logger(c *gin.Context) *logrus.Entry {
+	return logrus.WithField("request_id", c.GetString(RequestIDKey))
+}
+
+// AccessLog writes one structured line per request and records the HTTP
+// metrics. It must run after RequestID.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		metrics.ObserveHTTP(c.Request.Method, route, status, elapsed)
+		if quietRoutes[route] && status < 400 {
+			return
+		}
+
+		fields := logrus.Fields{
+			"request_id": c.GetString(RequestIDKey),
+			"method":     c.Request.Method,
+			"route":      route,
+			"path":       c.Request.URL.Path,
+			"status":     status,
+			"latency_ms": float64(elapsed.Microseconds()) / 1000,
+			"ip":         c.ClientIP(),
+			"bytes":      max(c.Writer.Size(), 0), // -1 when nothing was written
+			"user_agent": c.Request.UserAgent(),
+		}
+		if value, ok := c.Get("user"); ok {
+			if user, ok := value.(*models.User); ok {
+				fields["user_email"] = user.Email
+			}
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.String()
+		}
+
+		entry := logrus.WithFields(fields)
+		switch {
+		case status >= 500:
+			entry.Error("request")
+		case status >= 400:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one numbered schema change. Up must be idempotent: a
+// migration that failed half way is simply run again. Down undoes Up and is
+// nil when the change cannot be reversed, e.g. a data rewrite.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+	// Indexes marks a migration that only creates indexes, so Reapply can
+	// run it again after collections were dropped
+	Indexes bool
+}
+
+// Partial is returned by an Up that did all it could but had to leave some
+// steps out, e.g. a unique index that existing data would violate. The
+// migration is recorded as applied with the skipped steps, and run again by
+// every later Run until nothing is skipped.
+type Partial struct {
+	Skipped []string
+}
+
+func (p *Partial) Error() string {
+	return "skipped " + strings.Join(p.Skipped, "; ")
+}
+
+// Record is the schema_migrations entry written once a migration succeeds
+type Record struct {
+	Version    int       `bson:"_id" json:"version"`
+	Name       string    `bson:"name" json:"name"`
+	AppliedAt  time.Time `bson:"appliedAt" json:"appliedAt"`
+	DurationMs int64     `bson:"durationMs" json:"durationMs"`
+	Skipped    []string  `bson:"skipped,omitempty" json:"skipped,omitempty"`
+}
+
+// Status is a migration with whether and when it was applied, and what it
+// had to skip
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	Skipped   []string   `json:"skipped,omitempty"`
+}
+
+const (
+	collection     = "schema_migrations"
+	lockCollection = "schema_migrations_lock"
+
+	// A lock older than this is assumed to belong to a crashed process
+	staleLock = 15 * time.Minute
+)
+
+var ErrLocked = errors.New("another process is running migrations")
+
+func sorted() ([]Migration, error) {
+	list := append([]Migration(nil), migrations...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	for i, m := range list {
+		if m.Version <= 0 || m.Name == "" || m.Up == nil {
+			return nil, fmt.Errorf("migration %d is incomplete", m.Version)
+		}
+		if i > 0 && list[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return list, nil
+}
+
+func applied(ctx context.Context, db *mongo.Database) (map[int]Record, error) {
+	cursor, err := db.Collection(collection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	done := make(map[int]Record, len(records))
+	for _, r := range records {
+		done[r.Version] = r
+	}
+	return done, nil
+}
+
+// List reports every known migration and whether it has been applied
+func List(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	list, err := sorted()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(list))
+	for _, m := range list {
+		s := Status{Version: m.Version, Name: m.Name}
+		if r, ok := done[m.Version]; ok {
+			at := r.AppliedAt
+			s.Applied = true
+			s.AppliedAt = &at
+			s.Skipped = r.Skipped
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet, or were
+// applied with skipped steps, in order
+func Pending(ctx context.Context, db *mongo.Database) ([]Migration, error) {
+	list, err := sorted()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range list {
+		if r, ok := done[m.Version]; !ok || len(r.Skipped) > 0 {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Run applies all pending migrations in version order and stops at the first
+// failure. A Partial result is logged as a warning and does not stop the
+// run. With dryRun it only returns what would be applied.
+func Run(ctx context.Context, db *mongo.Database, dryRun bool) ([]Migration, error) {
+	pending, err := Pending(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+
+	if err := lock(ctx, db); err != nil {
+		return nil, err
+	}
+	defer unlock(db)
+
+	// Another process may have finished some while we waited for the lock
+	pending, err = Pending(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range pending {
+		if err := apply(ctx, db, m); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Reapply runs the applied index migrations again, in version order, to
+// restore indexes lost when collections were dropped, e.g. by an import
+func Reapply(ctx context.Context, db *mongo.Database) ([]Migration, error) {
+	if err := lock(ctx, db); err != nil {
+		return nil, err
+	}
+	defer unlock(db)
+
+	list, err := sorted()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range list {
+		if _, ok := done[m.Version]; !ok || !m.Indexes {
+			continue
+		}
+		if err := apply(ctx, db, m); err != nil {
+			return ran, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// apply runs m.Up and records the result
+func apply(ctx context.Context, db *mongo.Database, m Migration) error {
+	log := logrus.WithFields(logrus.Fields{"version": m.Version, "name": m.Name})
+	log.Info("Applying migration")
+
+	start := time.Now()
+	var skipped []string
+	if err := m.Up(ctx, db); err != nil {
+		var partial *Partial
+		if !errors.As(err, &partial) {
+			return fmt.Errorf("migration %d %s failed: %w", m.Version, m.Name, err)
+		}
+		skipped = partial.Skipped
+	}
+
+	record := Record{
+		Version:    m.Version,
+		Name:       m.Name,
+		AppliedAt:  time.Now(),
+		DurationMs: time.Since(start).Milliseconds(),
+		Skipped:    skipped,
+	}
+	_, err := db.Collection(collection).ReplaceOne(ctx, bson.M{"_id": m.Version}, record, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("migration %d %s applied but not recorded: %w", m.Version, m.Name, err)
+	}
+	if len(skipped) > 0 {
+		for _, step := range skipped {
+			log.WithField("skipped", step).Warn("Migration skipped a step; fix the cause and it runs again on the next start or migrate up")
+		}
+	} else {
+		log.WithField("duration", time.Since(start)).Info("Migration applied")
+	}
+	return nil
+}
+
+// Rollback reverts the last steps applied migrations, newest first. It
+// refuses to start when any of them has no Down. With dryRun it only returns
+// what would be reverted.
+func Rollback(ctx context.Context, db *mongo.Database, steps int, dryRun bool) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, nil
+	}
+	if !dryRun {
+		if err := lock(ctx, db); err != nil {
+			return nil, err
+		}
+		defer unlock(db)
+	}
+
+	list, err := sorted()
+	if err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []Migration
+	for i := len(list) - 1; i >= 0 && len(targets) < steps; i-- {
+		if _, ok := done[list[i].Version]; ok {
+			targets = append(targets, list[i])
+		}
+	}
+	for _, m := range targets {
+		if m.Down == nil {
+			return nil, fmt.Errorf("migration %d %s cannot be rolled back", m.Version, m.Name)
+		}
+	}
+	if dryRun {
+		return targets, nil
+	}
+
+	var reverted []Migration
+	for _, m := range targets {
+		log := logrus.WithFields(logrus.Fields{"version": m.Version, "name": m.Name})
+		log.Info("Rolling back migration")
+
+		if err := m.Down(ctx, db); err != nil {
+			return reverted, fmt.Errorf("rollback of migration %d %s failed: %w", m.Version, m.Name, err)
+		}
+		if _, err := db.Collection(collection).DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+			return reverted, fmt.Errorf("migration %d %s rolled back but still recorded: %w", m.Version, m.Name, err)
+		}
+		log.Info("Migration rolled back")
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+func lock(ctx context.Context, db *mongo.Database) error {
+	host, _ := os.Hostname()
+	now := time.Now()
+	doc := bson.M{"_id": "lock", "lockedAt": now, "host": host, "pid": os.Getpid()}
+
+	col := db.Collection(lockCollection)
+	_, err := col.InsertOne(ctx, doc)
+	if err == nil {
+		return nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// Take over a lock left behind by a crashed process
+	res, err := col.ReplaceOne(ctx,
+		bson.M{"_id": "lock", "lockedAt": bson.M{"$lt": now.Add(-staleLock)}},
+		doc,
+		options.Replace(),
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return ErrLocked
+	}
+	return nil
+}
+
+func unlock(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := db.Collection(lockCollection).DeleteOne(ctx, bson.M{"_id": "lock"}); err != nil {
+		logrus.WithError(err).Warn("Failed to release migration lock")
+	}
+}
@@ -0,0 +1,320 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations is the ordered history of schema changes. Append new entries
+// with the next version; never renumber or edit one that has shipped.
+var migrations = []Migration{
+	{Version: 1, Name: "foreign_key_indexes", Up: foreignKeyIndexes, Down: dropForeignKeyIndexes, Indexes: true},
+	{Version: 2, Name: "unique_numbers_and_emails", Up: uniqueNumbersAndEmails, Down: dropUniqueNumbersAndEmails, Indexes: true},
+	// Rewrites data in place; the original int64 values cannot be restored
+	{Version: 3, Name: "normalize_timestamps", Up: normalizeTimestamps},
+	{Version: 4, Name: "trash_indexes", Up: trashIndexes, Down: dropTrashIndexes, Indexes: true},
+	{Version: 5, Name: "search_text_indexes", Up: searchTextIndexes, Down: dropSearchTextIndexes, Indexes: true},
+}
+
+// Fields other documents are looked up by, per collection
+var foreignKeys = map[string][]string{
+	"project":                   {"customer_id"},
+	"salesorder":                {"projectId", "customerId"},
+	"supplier_purchase_orders":  {"projectId", "supplierId", "soId"},
+	"sales_invoices":            {"project_id", "customer_id", "sales_order_id"},
+	"delivery_receipts":         {"project_id", "customer_id", "sales_order_id", "sales_invoice_id"},
+	"supplierdeliveryreceipt":   {"project_id", "supplier_id"},
+	"supplierinvoice":           {"project_id", "supplier_id"},
+	"polaris_inventory":         {"sku"},
+	"polaris_receiving_reports": {"sku", "purchase_order_id", "supplier_dr_id", "supplier_invoice_id"},
+}
+
+func foreignKeyIndexes(ctx context.Context, db *mongo.Database) error {
+	for coll, fields := range foreignKeys {
+		var indexes []mongo.IndexModel
+		for _, field := range fields {
+			indexes = append(indexes, mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}})
+		}
+		if _, err := db.Collection(coll).Indexes().CreateMany(ctx, indexes); err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+func dropForeignKeyIndexes(ctx context.Context, db *mongo.Database) error {
+	for coll, fields := range foreignKeys {
+		for _, field := range fields {
+			if err := dropIndex(ctx, db.Collection(coll), field); err != nil {
+				return fmt.Errorf("%s: %w", coll, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dropIndex removes the default-named ascending index on field, if present
+func dropIndex(ctx context.Context, coll *mongo.Collection, field string) error {
+	_, err := coll.Indexes().DropOne(ctx, field+"_1")
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFound || cmdErr.Code == namespaceNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Server error codes for dropping an index or collection that is not there
+const (
+	namespaceNotFound = 26
+	indexNotFound     = 27
+)
+
+// Unique fields that are not document numbers
+var uniqueFields = map[string]string{
+	"user":        "email",
+	"pendinguser": "email",
+}
+
+func uniqueNumbersAndEmails(ctx context.Context, db *mongo.Database) error {
+	indexes := make(map[string]mongo.IndexModel)
+	for _, doc := range sequence.Documents {
+		indexes[doc.Collection] = sequence.NumberIndex(doc)
+	}
+	for coll, field := range uniqueFields {
+		indexes[coll] = mongo.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{field: bson.M{"$type": "string"}}),
+		}
+	}
+
+	// Data from the old generators may hold duplicate numbers. Those indexes
+	// are skipped, with every duplicate named, rather than blocking startup;
+	// the migration runs again until they are fixed
+	var skipped []string
+	for coll, index := range indexes {
+		field := index.Keys.(bson.D)[0].Key
+		dupes, err := duplicates(ctx, db.Collection(coll), field)
+		if err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+		if len(dupes) > 0 {
+			skipped = append(skipped, fmt.Sprintf("unique index on %s.%s, duplicates: %s", coll, field, strings.Join(dupes, ", ")))
+			continue
+		}
+		_, err = db.Collection(coll).Indexes().CreateOne(ctx, index)
+		if mongo.IsDuplicateKeyError(err) {
+			// A duplicate written since the check above
+			skipped = append(skipped, fmt.Sprintf("unique index on %s.%s: %v", coll, field, err))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		return &Partial{Skipped: skipped}
+	}
+	return nil
+}
+
+func dropUniqueNumbersAndEmails(ctx context.Context, db *mongo.Database) error {
+	for _, doc := range sequence.Documents {
+		if err := dropIndex(ctx, db.Collection(doc.Collection), doc.Field); err != nil {
+			return fmt.Errorf("%s: %w", doc.Collection, err)
+		}
+	}
+	for coll, field := range uniqueFields {
+		if err := dropIndex(ctx, db.Collection(coll), field); err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+func duplicates(ctx context.Context, coll *mongo.Collection, field string) ([]string, error) {
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{field: bson.M{"$type": "string"}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 20}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Value string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(groups))
+	for _, g := range groups {
+		values = append(values, fmt.Sprintf("%s (x%d)", g.Value, g.Count))
+	}
+	return values, nil
+}
+
+// Timestamp field spelling each collection's model uses
+var timestampStyle = map[string]struct{ created, updated string }{
+	"project":                   {"created_at", "updated_at"},
+	"delivery_receipts":         {"created_at", "updated_at"},
+	"sales_invoices":            {"created_at", "updated_at"},
+	"polaris_inventory":         {"created_at", "updated_at"},
+	"polaris_receiving_reports": {"created_at", "updated_at"},
+	"salesorder":                {"createdAt", "updatedAt"},
+	"supplier_purchase_orders":  {"createdAt", "updatedAt"},
+}
+
+// normalizeTimestamps converts Unix-second timestamps to dates and folds the
+// other spelling (updatedAt vs updated_at) into the one the model reads,
+// keeping the later value when both exist
+func normalizeTimestamps(ctx context.Context, db *mongo.Database) error {
+	for coll, style := range timestampStyle {
+		col := db.Collection(coll)
+		pairs := [][2]string{
+			{"createdAt", "created_at"},
+			{"updatedAt", "updated_at"},
+		}
+		for _, pair := range pairs {
+			target, other := pair[1], pair[0]
+			if target != style.created && target != style.updated {
+				target, other = other, target
+			}
+
+			for _, field := range []string{target, other} {
+				if err := secondsToDate(ctx, col, field); err != nil {
+					return fmt.Errorf("%s.%s: %w", coll, field, err)
+				}
+			}
+
+			_, err := col.UpdateMany(ctx,
+				bson.M{other: bson.M{"$exists": true}},
+				mongo.Pipeline{
+					{{Key: "$set", Value: bson.M{target: bson.M{"$max": bson.A{"$" + target, "$" + other}}}}},
+					{{Key: "$unset", Value: other}},
+				},
+			)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", coll, other, err)
+			}
+		}
+	}
+	return nil
+}
+
+func secondsToDate(ctx context.Context, col *mongo.Collection, field string) error {
+	_, err := col.UpdateMany(ctx,
+		bson.M{field: bson.M{"$type": "number"}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{field: bson.M{"$toDate": bson.M{"$multiply": bson.A{"$" + field, 1000}}}}}},
+		},
+	)
+	return err
+}
+
+// Collections whose documents are soft-deleted; every read filters on
+// deleted_at
+var trashCollections = []string{
+	"customer",
+	"project",
+	"salesorder",
+	"supplier_purchase_orders",
+	"supplier",
+	"polaris_inventory",
+	"supplierdeliveryreceipt",
+	"supplierinvoice",
+	"polaris_receiving_reports",
+	"sales_invoices",
+	"delivery_receipts",
+}
+
+func trashIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, coll := range trashCollections {
+		_, err := db.Collection(coll).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "deleted_at", Value: 1}}})
+		if err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+func dropTrashIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, coll := range trashCollections {
+		if err := dropIndex(ctx, db.Collection(coll), "deleted_at"); err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+// searchTextFields are the fields and weights of each collection's text
+// index as version 5 built it. They are written out here so the migration
+// keeps building the same index; searching other fields takes a new one.
+var searchTextFields = map[string]bson.D{
+	"customer":                  {{Key: "customername", Value: 10}, {Key: "customerid", Value: 10}, {Key: "tinnumber", Value: 10}, {Key: "customerorg", Value: 5}, {Key: "city", Value: 1}},
+	"project":                   {{Key: "project_name", Value: 10}, {Key: "project_id", Value: 10}, {Key: "notes", Value: 1}},
+	"salesorder":                {{Key: "salesOrderId", Value: 10}},
+	"supplier_purchase_orders":  {{Key: "poId", Value: 10}},
+	"supplier":                  {{Key: "supplier_name", Value: 10}, {Key: "supplier_code", Value: 10}, {Key: "tin_number", Value: 10}, {Key: "organization", Value: 5}},
+	"sales_invoices":            {{Key: "invoice_id", Value: 10}, {Key: "items.sku", Value: 3}},
+	"delivery_receipts":         {{Key: "dr_number", Value: 10}, {Key: "customer_name", Value: 5}, {Key: "customer_tin", Value: 5}, {Key: "items.sku", Value: 3}},
+	"supplierinvoice":           {{Key: "invoice_no", Value: 10}, {Key: "purchase_order_no", Value: 5}, {Key: "delivery_no", Value: 5}},
+	"supplierdeliveryreceipt":   {{Key: "supplier_dr_no", Value: 10}, {Key: "items.serial_nos", Value: 10}, {Key: "your_po_no", Value: 5}, {Key: "items.model", Value: 5}},
+	"polaris_inventory":         {{Key: "sku", Value: 10}, {Key: "barcode", Value: 10}, {Key: "aircon_model_number", Value: 8}, {Key: "aircon_name", Value: 5}},
+	"polaris_receiving_reports": {{Key: "sku", Value: 10}, {Key: "barcode", Value: 10}, {Key: "aircon_model_number", Value: 8}, {Key: "aircon_name", Value: 5}},
+}
+
+// searchTextIndex is the name of the text index. A collection can only have
+// one, so it covers every searched field.
+const searchTextIndex = "search_text"
+
+// searchTextIndexes creates the text index global search reads. The
+// language is none so document numbers and names are matched as written,
+// without stemming.
+func searchTextIndexes(ctx context.Context, db *mongo.Database) error {
+	for coll, weights := range searchTextFields {
+		keys := make(bson.D, len(weights))
+		for i, w := range weights {
+			keys[i] = bson.E{Key: w.Key, Value: "text"}
+		}
+		_, err := db.Collection(coll).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: keys,
+			Options: options.Index().
+				SetName(searchTextIndex).
+				SetWeights(weights).
+				SetDefaultLanguage("none"),
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+func dropSearchTextIndexes(ctx context.Context, db *mongo.Database) error {
+	for coll := range searchTextFields {
+		_, err := db.Collection(coll).Indexes().DropOne(ctx, searchTextIndex)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFound || cmdErr.Code == namespaceNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", coll, err)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"context"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Migrator interface for performing database schema migration
@@ -22,6 +25,12 @@ type Role struct {
 	ID    primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
 	Name  string               `bson:"name" json:"name"`
 	Menus []primitive.ObjectID `bson:"menus,omitempty" json:"menus,omitempty"` // IDs of menus accessible
+	// Permissions maps a resource to the actions granted on it, e.g.
+	// {"salesorder": ["view", "create"]}. Nil means the role predates the
+	// matrix and every action under its menus is allowed.
+	Permissions map[string][]string `bson:"permissions,omitempty" json:"permissions,omitempty"`
+	// RequireTwoFactor forces members of the role to enroll TOTP at sign in
+	RequireTwoFactor bool `bson:"requireTwoFactor,omitempty" json:"requireTwoFactor,omitempty"`
 }
 
 type PendingUser struct {
@@ -33,16 +42,282 @@ type PendingUser struct {
 }
 
 type User struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Email        string             `bson:"email" json:"email"`
-	Password     string             `bson:"password" json:"password"`
-	Roles        primitive.ObjectID `bson:"roles,omitempty" json:"roles,omitempty"`
-	IsSuperAdmin bool               `bson:"isSuperAdmin,omitempty" json:"isSuperAdmin,omitempty"`
-	Status       string             `bson:"status" json:"status"` // e.g. "active", "suspended"
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Email    string             `bson:"email" json:"email"`
+	Password string             `bson:"password" json:"password"`
+	Roles    primitive.ObjectID `bson:"roles,omitempty" json:"roles,omitempty"`
+	// RoleIDs are extra roles on top of Roles; permissions and menus are the
+	// union of all of them
+	RoleIDs      []primitive.ObjectID `bson:"roleIds,omitempty" json:"roleIds,omitempty"`
+	IsSuperAdmin bool                 `bson:"isSuperAdmin,omitempty" json:"isSuperAdmin,omitempty"`
+	Status       string               `bson:"status" json:"status"` // e.g. "active", "suspended"
+	// PasswordChangedAt is set by change-password and reset-password
+	PasswordChangedAt *time.Time `bson:"passwordChangedAt,omitempty" json:"passwordChangedAt,omitempty"`
+	TwoFactor         TwoFactor  `bson:"twoFactor,omitempty" json:"twoFactor"`
+	// Service accounts are machine users: they authenticate only with API
+	// keys and can never sign in with a password
+	IsServiceAccount bool `bson:"isServiceAccount,omitempty" json:"isServiceAccount,omitempty"`
+
+	// Profile, shown on documents the user prepares or approves
+	FullName  string `bson:"fullName,omitempty" json:"fullName,omitempty"`
+	Position  string `bson:"position,omitempty" json:"position,omitempty"`
+	Phone     string `bson:"phone,omitempty" json:"phone,omitempty"`
+	Signature string `bson:"signature,omitempty" json:"signature,omitempty"` // PNG or JPEG data URL
+}
+
+// AllRoleIDs returns the primary role followed by any extra roles, without
+// duplicates
+func (u User) AllRoleIDs() []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	seen := make(map[primitive.ObjectID]bool)
+	for _, id := range append([]primitive.ObjectID{u.Roles}, u.RoleIDs...) {
+		if id.IsZero() || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// RoleHexes is AllRoleIDs as hex strings, for logs and responses
+func (u User) RoleHexes() []string {
+	ids := u.AllRoleIDs()
+	hexes := make([]string, len(ids))
+	for i, id := range ids {
+		hexes[i] = id.Hex()
+	}
+	return hexes
+}
+
+// DisplayName is the full name when set, otherwise the email
+func (u User) DisplayName() string {
+	if u.FullName != "" {
+		return u.FullName
+	}
+	return u.Email
+}
+
+// TwoFactor holds the user's TOTP enrollment. Secrets and recovery codes are
+// never sent to the client.
+type TwoFactor struct {
+	Enabled       bool       `bson:"enabled,omitempty" json:"enabled"`
+	Secret        string     `bson:"secret,omitempty" json:"-"`
+	PendingSecret string     `bson:"pendingSecret,omitempty" json:"-"` // set during enrollment, until the first code is verified
+	RecoveryCodes []string   `bson:"recoveryCodes,omitempty" json:"-"` // sha256 hashes, each usable once
+	LastUsedStep  int64      `bson:"lastUsedStep,omitempty" json:"-"`  // rejects replay of an accepted code
+	EnabledAt     *time.Time `bson:"enabledAt,omitempty" json:"enabledAt,omitempty"`
+}
+
+// Session is a signed-in device. It holds the hash of the current refresh
+// token; access tokens carry the session ID and stop working once the session
+// is revoked.
+type Session struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID            primitive.ObjectID `bson:"userId" json:"userId"`
+	RefreshTokenHash  string             `bson:"refreshTokenHash" json:"-"`
+	PreviousTokenHash string             `bson:"previousTokenHash,omitempty" json:"-"` // last rotated-out token, used to detect reuse
+	UserAgent         string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	IP                string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	CreatedAt         time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt        time.Time          `bson:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt         time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt         *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// Migrate creates the session indexes. Expired sessions are removed by Mongo.
+func (Session) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("session").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "refreshTokenHash", Value: 1}}},
+		{Keys: bson.D{{Key: "previousTokenHash", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// PasswordReset is a single-use token sent by email on forgot-password
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	UsedAt    *time.Time         `bson:"usedAt,omitempty" json:"usedAt,omitempty"`
+}
+
+// Migrate creates the password reset indexes. Expired tokens are removed by Mongo.
+func (PasswordReset) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("passwordreset").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// LoginAttempt is the audit trail of every sign in attempt
+type LoginAttempt struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Email     string             `bson:"email" json:"email"`
+	IP        string             `bson:"ip" json:"ip"`
+	UserAgent string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Outcome   string             `bson:"outcome" json:"outcome"`                   // success | failure | locked
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"` // e.g. bad_password, bad_2fa_code
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// Login attempts are kept for 180 days
+func (LoginAttempt) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("loginattempt").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(180 * 24 * 60 * 60)},
+	})
+	return err
+}
+
+// LoginThrottle counts recent failures for one account ("email:...") or one
+// client address ("ip:...")
+type LoginThrottle struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Key           string             `bson:"key" json:"key"`
+	Failures      int                `bson:"failures" json:"failures"`
+	LastFailureAt time.Time          `bson:"lastFailureAt" json:"lastFailureAt"`
+	LockedUntil   *time.Time         `bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`
+	ExpiresAt     time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+func (LoginThrottle) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("loginthrottle").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// AuditLog is one document mutation. The collection is append-only; nothing
+// in the API updates or deletes audit entries.
+type AuditLog struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	ActorID    *primitive.ObjectID `bson:"actorId,omitempty" json:"actorId,omitempty"`
+	ActorEmail string              `bson:"actorEmail,omitempty" json:"actorEmail,omitempty"`
+	ActorName  string              `bson:"actorName,omitempty" json:"actorName,omitempty"`
+	IP         string              `bson:"ip" json:"ip"`
+	UserAgent  string              `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Method     string              `bson:"method" json:"method"`
+	Route      string              `bson:"route" json:"route"`
+	Entity     string              `bson:"entity" json:"entity"` // collection name
+	EntityID   primitive.ObjectID  `bson:"entityId" json:"entityId"`
+	Action     string              `bson:"action" json:"action"` // create | update | delete | approve | ...
+	Changes    []AuditChange       `bson:"changes,omitempty" json:"changes,omitempty"`
+	At         time.Time           `bson:"at" json:"at"`
+}
+
+// AuditChange is a single field difference; dotted paths for nested fields
+type AuditChange struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+func (AuditLog) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("auditlog").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "entity", Value: 1}, {Key: "entityId", Value: 1}, {Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "at", Value: -1}}},
+	})
+	return err
+}
+
+// Invite is an admin invitation to join with a pre-assigned role. Status is
+// pending until accepted or revoked; expiry is judged from ExpiresAt.
+type Invite struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Email      string             `bson:"email" json:"email"`
+	RoleID     primitive.ObjectID `bson:"roleId" json:"roleId"`
+	NonceHash  string             `bson:"nonceHash" json:"-"`
+	Status     string             `bson:"status" json:"status"` // pending | accepted | revoked
+	InvitedBy  primitive.ObjectID `bson:"invitedBy" json:"invitedBy"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	SentAt     time.Time          `bson:"sentAt" json:"sentAt"`
+	SendCount  int                `bson:"sendCount" json:"sendCount"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+	AcceptedAt *time.Time         `bson:"acceptedAt,omitempty" json:"acceptedAt,omitempty"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+func (Invite) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("invite").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	return err
+}
+
+// Counter holds the last number issued for a document sequence. The ID is
+// the sequence key, e.g. "salesorder:2025" or "salesorder:MNL:2025".
+type Counter struct {
+	ID        string    `bson:"_id" json:"id"`
+	DocType   string    `bson:"docType" json:"docType"`
+	Branch    string    `bson:"branch,omitempty" json:"branch,omitempty"`
+	Year      int       `bson:"year,omitempty" json:"year,omitempty"`
+	Value     int64     `bson:"value" json:"value"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// APIKey authenticates a service account. Only the hash of the secret is
+// stored; the prefix identifies the key in lists and logs.
+type APIKey struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name    string             `bson:"name" json:"name"`
+	Prefix  string             `bson:"prefix" json:"prefix"`
+	KeyHash string             `bson:"keyHash" json:"-"`
+	UserID  primitive.ObjectID `bson:"userId" json:"userId"` // the service account
+	// Scopes narrows the service account's role, resource -> actions. Nil
+	// means the key can do everything the role allows.
+	Scopes     map[string][]string `bson:"scopes,omitempty" json:"scopes,omitempty"`
+	CreatedBy  primitive.ObjectID  `bson:"createdBy" json:"createdBy"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  *time.Time          `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time          `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time          `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+func (APIKey) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("apikey").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+	})
+	return err
+}
+
+// IdempotencyKey remembers a create request sent with an Idempotency-Key
+// header so a retry gets the original response instead of a second document.
+// The ID is derived from the caller, route and key.
+type IdempotencyKey struct {
+	ID          string             `bson:"_id" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	Route       string             `bson:"route" json:"route"`
+	RequestHash string             `bson:"requestHash" json:"-"`
+	Done        bool               `bson:"done" json:"done"` // false while the first request is running
+	Status      int                `bson:"status,omitempty" json:"status,omitempty"`
+	ContentType string             `bson:"contentType,omitempty" json:"contentType,omitempty"`
+	Body        []byte             `bson:"body,omitempty" json:"-"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Migrate creates the idempotency key indexes. Expired keys are removed by
+// Mongo.
+func (IdempotencyKey) Migrate(db *mongo.Database) error {
+	_, err := db.Collection("idempotencykey").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
 }
 
 type Project struct {
 	ID                   primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Version              int64                `bson:"version" json:"version"`
 	ProjectID            string               `bson:"project_id,omitempty" json:"project_id"`
 	ProjectName          string               `bson:"project_name" json:"project_name"`
 	CustomerID           primitive.ObjectID   `bson:"customer_id,omitempty" json:"customer_id"`
@@ -56,12 +331,13 @@ type Project struct {
 	SalesInvoiceID       primitive.ObjectID   `bson:"sales_invoice_id,omitempty" json:"sales_invoice_id"`
 	SalesDrID            primitive.ObjectID   `bson:"sales_dr_id,omitempty" json:"sales_dr_id"`
 	Notes                string               `bson:"notes,omitempty" json:"notes"`
-	CreatedAt            int64                `bson:"created_at,omitempty" json:"created_at"`
-	UpdatedAt            int64                `bson:"updated_at,omitempty" json:"updated_at"`
+	CreatedAt            time.Time            `bson:"created_at,omitempty" json:"created_at"`
+	UpdatedAt            time.Time            `bson:"updated_at,omitempty" json:"updated_at"`
 }
 
 type Customer struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Version      int64              `bson:"version" json:"version"`
 	CustomerID   string             `bson:"customerid" json:"customerid"`
 	CustomerName string             `bson:"customername" json:"customername"`
 	CustomerOrg  string             `bson:"customerorg" json:"customerorg"`
@@ -73,8 +349,9 @@ type Customer struct {
 
 // SupplierPO represents a Purchase Order sent to a supplier
 type SupplierPO struct {
-	ID   primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	POID string             `bson:"poId" json:"poId"`
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Version int64              `bson:"version" json:"version"`
+	POID    string             `bson:"poId" json:"poId"`
 
 	ProjectID  primitive.ObjectID  `bson:"projectId" json:"projectId"`
 	SupplierID primitive.ObjectID  `bson:"supplierId" json:"supplierId"`
@@ -84,6 +361,7 @@ type SupplierPO struct {
 	Status     string              `bson:"status" json:"status"`
 	ApprovedBy *primitive.ObjectID `bson:"approvedBy,omitempty" json:"approvedBy,omitempty"`
 	ApprovedAt *time.Time          `bson:"approvedAt,omitempty" json:"approvedAt,omitempty"`
+	CreatedBy  *primitive.ObjectID `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
 
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 }
@@ -97,6 +375,7 @@ type SupplierPOItem struct {
 // PolarisInventory represents an item in Polaris warehouse inventory.
 type PolarisReceivingReport struct {
 	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Version           int64               `bson:"version" json:"version"`
 	SKU               string              `bson:"sku" json:"sku"`                             // Unique item SKU
 	Barcode           string              `bson:"barcode,omitempty" json:"barcode,omitempty"` // Optional: for scanned code
 	AirconModelNumber string              `bson:"aircon_model_number" json:"aircon_model_number"`
@@ -117,6 +396,7 @@ type PolarisReceivingReport struct {
 
 type PolarisInventory struct {
 	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Version           int64              `bson:"version" json:"version"`
 	SKU               string             `bson:"sku" json:"sku"`
 	Barcode           string             `bson:"barcode,omitempty" json:"barcode,omitempty"`
 	AirconModelNumber string             `bson:"aircon_model_number" json:"aircon_model_number"`
@@ -133,6 +413,7 @@ type PolarisInventory struct {
 
 type SalesOrder struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Version      int64              `bson:"version" json:"version"`
 	SalesOrderID string             `bson:"salesOrderId" json:"salesOrderId"`
 	ProjectID    primitive.ObjectID `bson:"projectId,omitempty" json:"projectId,omitempty"`
 	CustomerID   primitive.ObjectID `bson:"customerId,omitempty" json:"customerId,omitempty"`
@@ -176,6 +457,7 @@ type SupplierDeliveryReceiptItem struct {
 
 type SupplierDeliveryReceipt struct {
 	ID           primitive.ObjectID            `bson:"_id,omitempty" json:"id"`
+	Version      int64                         `bson:"version" json:"version"`
 	SupplierID   primitive.ObjectID            `bson:"supplier_id" json:"supplier_id"`
 	ProjectID    primitive.ObjectID            `bson:"project_id" json:"project_id"`
 	SupplierDRNo string                        `bson:"supplier_dr_no" json:"supplier_dr_no"`
@@ -192,6 +474,7 @@ type SupplierDeliveryReceipt struct {
 
 type SupplierInvoice struct {
 	ID              primitive.ObjectID    `bson:"_id,omitempty" json:"id,omitempty"`
+	Version         int64                 `bson:"version" json:"version"`
 	SupplierID      primitive.ObjectID    `bson:"supplier_id" json:"supplier_id"`
 	ProjectID       primitive.ObjectID    `bson:"project_id" json:"project_id"`
 	InvoiceNo       string                `bson:"invoice_no" json:"invoice_no"`
@@ -218,6 +501,7 @@ type SupplierInvoiceItem struct {
 
 type Supplier struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Version      int64              `bson:"version" json:"version"`
 	SupplierCode string             `bson:"supplier_code" json:"supplier_code"`
 	SupplierName string             `bson:"supplier_name" json:"supplier_name"`
 	TINNumber    string             `bson:"tin_number" json:"tin_number"`
@@ -228,6 +512,7 @@ type Supplier struct {
 }
 type SalesInvoice struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Version      int64              `bson:"version" json:"version"`
 	InvoiceID    string             `bson:"invoice_id" json:"invoice_id"`
 	ProjectID    primitive.ObjectID `bson:"project_id" json:"project_id"`
 	CustomerID   primitive.ObjectID `bson:"customer_id" json:"customer_id"`
@@ -249,6 +534,7 @@ type InvoiceItemSales struct {
 
 type DeliveryReceipt struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Version  int64              `bson:"version" json:"version"`
 	DRNumber string             `bson:"dr_number" json:"dr_number"`
 
 	ProjectID      primitive.ObjectID `bson:"project_id" json:"project_id"`
@@ -263,9 +549,12 @@ type DeliveryReceipt struct {
 
 	Items []DeliveryItem `bson:"items" json:"items"`
 
-	Status    string    `bson:"status" json:"status"` // Ready | Issued
-	CreatedAt time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	Status     string              `bson:"status" json:"status"` // Ready | Issued
+	PreparedBy *primitive.ObjectID `bson:"prepared_by,omitempty" json:"prepared_by,omitempty"`
+	ApprovedBy *primitive.ObjectID `bson:"approved_by,omitempty" json:"approved_by,omitempty"` // set when issued
+	ApprovedAt *time.Time          `bson:"approved_at,omitempty" json:"approved_at,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time           `bson:"updated_at" json:"updated_at"`
 }
 
 type DeliveryItem struct {
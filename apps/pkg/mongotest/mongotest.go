@@ -0,0 +1,162 @@
+package mongotest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tests and benchmarks that need MongoDB run against the server named by
+// POLARIS_TEST_MONGO_URI and are skipped without it. Each gets a scratch
+// database of its own that is dropped when it ends.
+
+// URIEnv names the environment variable holding the test server's URI
+const URIEnv = "POLARIS_TEST_MONGO_URI"
+
+// Open connects to the test server and returns an empty scratch database
+func Open(tb testing.TB) *mongo.Database {
+	tb.Helper()
+	uri := os.Getenv(URIEnv)
+	if uri == "" {
+		tb.Skipf("%s is not set", URIEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		tb.Fatalf("connect to %s: %v", URIEnv, err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		tb.Fatalf("ping %s: %v", URIEnv, err)
+	}
+
+	db := client.Database("polaris_test_" + primitive.NewObjectID().Hex())
+	tb.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return db
+}
+
+// Seeded describes what Seed wrote
+type Seeded struct {
+	// Start and End bound the creation times of every document
+	Start, End time.Time
+	// FirstOrder is the ID of a sales order that exists
+	FirstOrder primitive.ObjectID
+}
+
+// Seed fills db with linked customers, projects, aircons and suppliers, and
+// documents sales orders, sales invoices and supplier invoices of each, the
+// sales orders with items line items apiece. The data is the same on every
+// run.
+func Seed(tb testing.TB, db *mongo.Database, documents, items int) Seeded {
+	tb.Helper()
+	ctx := context.Background()
+	r := rand.New(rand.NewSource(1))
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -90)
+	createdAt := func() time.Time {
+		return start.Add(time.Duration(r.Int63n(int64(end.Sub(start)))))
+	}
+
+	ids := func(n int) []primitive.ObjectID {
+		list := make([]primitive.ObjectID, n)
+		for i := range list {
+			list[i] = primitive.NewObjectID()
+		}
+		return list
+	}
+	pick := func(list []primitive.ObjectID) primitive.ObjectID {
+		return list[r.Intn(len(list))]
+	}
+	customers := ids(documents/10 + 1)
+	projects := ids(documents/4 + 1)
+	aircons := ids(50)
+	suppliers := ids(50)
+	orders := ids(documents)
+
+	seed := map[string]func(i int) interface{}{}
+	counts := map[string]int{}
+	add := func(collection string, n int, doc func(i int) interface{}) {
+		seed[collection], counts[collection] = doc, n
+	}
+
+	add("customer", len(customers), func(i int) interface{} {
+		return bson.M{"_id": customers[i], "customerid": fmt.Sprintf("CUST-%05d", i), "customername": fmt.Sprintf("Customer %d", i), "createdat": createdAt()}
+	})
+	add("project", len(projects), func(i int) interface{} {
+		return bson.M{"_id": projects[i], "project_id": fmt.Sprintf("PRJ-%05d", i), "project_name": fmt.Sprintf("Project %d", i), "customer_id": pick(customers), "created_at": createdAt()}
+	})
+	add("aircon", len(aircons), func(i int) interface{} {
+		return bson.M{"_id": aircons[i], "name": fmt.Sprintf("Aircon %d", i), "price": float64(20000 + 500*i)}
+	})
+	add("supplier", len(suppliers), func(i int) interface{} {
+		return bson.M{"_id": suppliers[i], "supplier_code": fmt.Sprintf("SUP-%05d", i), "supplier_name": fmt.Sprintf("Supplier %d", i), "created_at": createdAt()}
+	})
+	add("salesorder", documents, func(i int) interface{} {
+		lines := make(bson.A, items)
+		var total float64
+		for j := range lines {
+			qty, price := r.Intn(5)+1, float64(20000+r.Intn(50)*500)
+			lines[j] = bson.M{"airconId": pick(aircons), "qty": qty, "uom": "unit", "price": price, "subtotal": float64(qty) * price}
+			total += float64(qty) * price
+		}
+		created := createdAt()
+		return bson.M{"_id": orders[i], "salesOrderId": fmt.Sprintf("SO-%06d", i), "projectId": pick(projects), "customerId": pick(customers),
+			"items": lines, "totalAmount": total, "status": "approved", "createdAt": created, "updatedAt": created}
+	})
+	add("sales_invoices", documents, func(i int) interface{} {
+		return bson.M{"invoice_id": fmt.Sprintf("SI-%06d", i), "project_id": pick(projects), "customer_id": pick(customers),
+			"total_amount": float64(r.Intn(1000000)), "created_at": createdAt()}
+	})
+	add("supplierinvoice", documents, func(i int) interface{} {
+		created := createdAt()
+		return bson.M{"invoice_no": fmt.Sprintf("PI-%06d", i), "project_id": pick(projects), "supplier_id": pick(suppliers),
+			"grand_total": float64(r.Intn(1000000)), "invoice_date": created, "created_at": created}
+	})
+
+	collections := make([]string, 0, len(seed))
+	for collection := range seed {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		batch := make([]interface{}, 0, 1000)
+		for i := 0; i < counts[collection]; i++ {
+			batch = append(batch, seed[collection](i))
+			if len(batch) == cap(batch) || i == counts[collection]-1 {
+				if _, err := db.Collection(collection).InsertMany(ctx, batch); err != nil {
+					tb.Fatalf("seed %s: %v", collection, err)
+				}
+				batch = batch[:0]
+			}
+		}
+	}
+	return Seeded{Start: start, End: end, FirstOrder: orders[0]}
+}
+
+// SameRows fails unless got holds the rows of want, field for field and in
+// the same order
+func SameRows[T any](tb testing.TB, want, got []T) {
+	tb.Helper()
+	for i := 0; i < len(want) && i < len(got); i++ {
+		w, g := fmt.Sprintf("%+v", want[i]), fmt.Sprintf("%+v", got[i])
+		if w != g {
+			tb.Fatalf("row %d is\n  %s\nnot\n  %s", i+1, g, w)
+		}
+	}
+	if len(want) != len(got) {
+		tb.Fatalf("%d rows instead of %d", len(got), len(want))
+	}
+}
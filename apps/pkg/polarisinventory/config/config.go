@@ -10,6 +10,7 @@ type AddUpdateInventory struct {
 	IndoorOutdoorUnit string  `json:"indoor_outdoor_unit" binding:"required"`
 	Quantity          int     `json:"quantity" binding:"required,min=1"`
 	Price             float64 `json:"price" binding:"required"`
+	Version           *int64  `json:"version"`
 }
 
 type AddUpdateInventoryRR struct {
@@ -29,4 +30,6 @@ type AddUpdateInventoryRR struct {
 	SupplierInvoiceID string `json:"supplier_invoice_id,omitempty"`
 	PurchaseOrderID   string `json:"purchase_order_id,omitempty"`
 	SalesOrderID      string `json:"sales_order_id,omitempty"`
+
+	Version *int64 `json:"version"`
 }
@@ -3,12 +3,17 @@ package polarisinventory
 import (
 	"context"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/polarisinventory/config"
+	polarisinventoryconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/polarisinventory/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -26,7 +31,11 @@ func AddInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.AddUpdateInventory
+	if !permission.Authorize(c, db, permission.ResourceInventory, permission.ActionCreate) {
+		return
+	}
+
+	var payload polarisinventoryconfig.AddUpdateInventory
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -54,10 +63,32 @@ func AddInventory(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add inventory", "details": err.Error()})
 		return
 	}
+	audit.Created(c, db, "polaris_inventory", inventory.ID)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Inventory added successfully", "data": inventory})
 }
 
+// inventoryList is how inventory can be listed. Pages default to the
+// maximum because forms load the whole list for their pickers, following
+// nextCursor until the last page.
+var inventoryList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"sku":                 {Sort: true},
+		"barcode":             {},
+		"aircon_name":         {Sort: true},
+		"aircon_model_number": {Sort: true},
+		"type_of_aircon":      {},
+		"indoor_outdoor_unit": {},
+		"hp":                  {},
+		"quantity":            {Kind: listquery.Number, Sort: true},
+		"price":               {Kind: listquery.Number, Sort: true},
+		"created_at":          {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"sku", "barcode", "aircon_name", "aircon_model_number"},
+	Sort:   "-created_at",
+	Limit:  listquery.MaxLimit,
+}
+
 func GetAllInventory(c *gin.Context, db *mongo.Database) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -70,22 +101,25 @@ func GetAllInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("polaris_inventory")
+	if !permission.Authorize(c, db, permission.ResourceInventory, permission.ActionLookup) {
+		return
+	}
 
-	cursor, err := collection.Find(context.Background(), bson.M{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
+	query, ok := listquery.Parse(c, inventoryList)
+	if !ok {
 		return
 	}
-	defer cursor.Close(context.Background())
 
 	var items []models.PolarisInventory
-	if err := cursor.All(context.Background(), &items); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse inventory data"})
+	page, err := query.Run(c, db.Collection("polaris_inventory"), &items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"inventory": items})
+	body := listquery.Envelope(items, page)
+	body["inventory"] = body["data"] // older clients read this key
+	c.JSON(http.StatusOK, body)
 }
 
 func GetInventoryByID(c *gin.Context, db *mongo.Database) {
@@ -100,6 +134,10 @@ func GetInventoryByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceInventory, permission.ActionView) {
+		return
+	}
+
 	idParam := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -110,7 +148,7 @@ func GetInventoryByID(c *gin.Context, db *mongo.Database) {
 	collection := db.Collection("polaris_inventory")
 
 	var item models.PolarisInventory
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&item)
+	err = collection.FindOne(context.Background(), trash.Live(bson.M{"_id": objectID})).Decode(&item)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory not found"})
@@ -135,6 +173,10 @@ func UpdateInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceInventory, permission.ActionEdit) {
+		return
+	}
+
 	idParam := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -142,12 +184,17 @@ func UpdateInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.AddUpdateInventory
+	var payload polarisinventoryconfig.AddUpdateInventory
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	update := bson.M{
 		"$set": bson.M{
 			"sku":                 payload.SKU,
@@ -164,27 +211,38 @@ func UpdateInventory(c *gin.Context, db *mongo.Database) {
 	}
 
 	collection := db.Collection("polaris_inventory")
-	_, err = collection.UpdateByID(context.Background(), objectID, update)
+	before := audit.Snapshot(c, db, "polaris_inventory", objectID)
+	res, err := collection.UpdateOne(context.Background(), version.Filter(objectID, expected), version.Bump(update))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inventory"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		version.Conflict(c, db, "polaris_inventory", objectID, "Inventory not found")
+		return
+	}
+	audit.Updated(c, db, "polaris_inventory", objectID, before)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Inventory updated successfully"})
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Inventory updated successfully", "version": expected + 1})
 }
 
-func DeleteInventory(c *gin.Context, db *mongo.Database) {
+func DeleteInventory(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceInventory, permission.ActionDelete) {
+		return
+	}
+
 	idParam := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -192,12 +250,16 @@ func DeleteInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("polaris_inventory")
-	_, err = collection.DeleteOne(context.Background(), bson.M{"_id": objectID})
+	before := audit.Snapshot(c, db, "polaris_inventory", objectID)
+	_, err = trash.Delete(c, db, cfg, "polaris_inventory", objectID, userObj.ID)
+	if trash.Blocked(c, "Inventory", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inventory"})
 		return
 	}
+	audit.Changed(c, db, "polaris_inventory", objectID, audit.ActionDelete, before)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Inventory deleted successfully"})
 }
@@ -213,12 +275,20 @@ func AddOrUpdateReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
-	var payload config.AddUpdateInventoryRR
+	var payload polarisinventoryconfig.AddUpdateInventoryRR
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	action := permission.ActionCreate
+	if payload.ID != "" {
+		action = permission.ActionEdit
+	}
+	if !permission.Authorize(c, db, permission.ResourceReceivingReport, action) {
+		return
+	}
+
 	collection := db.Collection("polaris_receiving_reports")
 
 	// Parse optional RR IDs
@@ -248,6 +318,11 @@ func AddOrUpdateReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 			return
 		}
 
+		expected, ok := version.Expected(c, payload.Version)
+		if !ok {
+			return
+		}
+
 		update := bson.M{
 			"$set": bson.M{
 				"sku":                 payload.SKU,
@@ -269,13 +344,20 @@ func AddOrUpdateReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 			},
 		}
 
-		_, err = collection.UpdateByID(context.Background(), objID, update)
+		before := audit.Snapshot(c, db, "polaris_receiving_reports", objID)
+		res, err := collection.UpdateOne(context.Background(), version.Filter(objID, expected), version.Bump(update))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inventory"})
 			return
 		}
+		if res.MatchedCount == 0 {
+			version.Conflict(c, db, "polaris_receiving_reports", objID, "RR inventory not found")
+			return
+		}
+		audit.Updated(c, db, "polaris_receiving_reports", objID, before)
 
-		c.JSON(http.StatusOK, gin.H{"message": "RR inventory updated successfully"})
+		version.SetETag(c, expected+1)
+		c.JSON(http.StatusOK, gin.H{"message": "RR inventory updated successfully", "version": expected + 1})
 		return
 	}
 
@@ -300,17 +382,19 @@ func AddOrUpdateReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 		UpdatedAt: time.Now(),
 	}
 
-	_, err := collection.InsertOne(context.Background(), item)
+	res, err := collection.InsertOne(context.Background(), item)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create RR inventory"})
 		return
 	}
+	audit.Created(c, db, "polaris_receiving_reports", res.InsertedID.(primitive.ObjectID))
 
 	c.JSON(http.StatusOK, gin.H{"message": "RR inventory created successfully", "data": item})
 }
 
 type ReceivingReportInventoryResponse struct {
-	ID primitive.ObjectID `bson:"_id" json:"id"`
+	ID      primitive.ObjectID `bson:"_id" json:"id"`
+	Version int64              `bson:"version" json:"version"`
 
 	SKU               string  `bson:"sku" json:"sku"`
 	Barcode           string  `bson:"barcode" json:"barcode"`
@@ -338,6 +422,22 @@ type ReceivingReportInventoryResponse struct {
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+var receivingReportList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"sku":              {Sort: true},
+		"aircon_name":      {Sort: true},
+		"type_of_aircon":   {},
+		"sales_order":      {Path: "sales_order_id", Kind: listquery.ObjectID},
+		"purchase_order":   {Path: "purchase_order_id", Kind: listquery.ObjectID},
+		"supplier_invoice": {Path: "supplier_invoice_id", Kind: listquery.ObjectID},
+		"supplier_dr":      {Path: "supplier_dr_id", Kind: listquery.ObjectID},
+		"quantity":         {Kind: listquery.Number, Sort: true},
+		"created_at":       {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"sku", "barcode", "aircon_name", "aircon_model_number"},
+	Sort:   "-created_at",
+}
+
 func GetAllReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 
 	// Auth
@@ -351,30 +451,18 @@ func GetAllReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Pagination
-	page := int64(1)
-	limit := int64(10)
-
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
+	if !permission.Authorize(c, db, permission.ResourceReceivingReport, permission.ActionView) {
+		return
 	}
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
-			limit = v
-		}
+
+	query, ok := listquery.Parse(c, receivingReportList)
+	if !ok {
+		return
 	}
 
-	skip := (page - 1) * limit
 	collection := db.Collection("polaris_receiving_reports")
 
-	pipeline := mongo.Pipeline{
-
-		{{Key: "$sort", Value: bson.M{"created_at": -1}}},
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
-
+	shape := mongo.Pipeline{
 		// 🔹 Sales Order
 		{{
 			Key: "$lookup",
@@ -436,6 +524,7 @@ func GetAllReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 			Key: "$project",
 			Value: bson.M{
 				"_id":                 1,
+				"version":             1,
 				"sku":                 1,
 				"barcode":             1,
 				"aircon_model_number": 1,
@@ -464,27 +553,14 @@ func GetAllReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 		},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var result []ReceivingReportInventoryResponse
+	page, err := query.Run(c, collection, &result, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch RR inventory"})
 		return
 	}
-	defer cursor.Close(c)
-
-	var result []ReceivingReportInventoryResponse
-	if err := cursor.All(c, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode RR inventory"})
-		return
-	}
 
-	total, _ := collection.CountDocuments(c, bson.M{})
-
-	c.JSON(http.StatusOK, gin.H{
-		"data":  result,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(result, page))
 }
 
 func GetReceivingReportInventoryByID(c *gin.Context, db *mongo.Database) {
@@ -498,6 +574,10 @@ func GetReceivingReportInventoryByID(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceReceivingReport, permission.ActionView) {
+		return
+	}
 	id := c.Param("id")
 
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -509,7 +589,7 @@ func GetReceivingReportInventoryByID(c *gin.Context, db *mongo.Database) {
 	collection := db.Collection("polaris_receiving_reports")
 
 	var item models.PolarisReceivingReport
-	err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&item)
+	err = collection.FindOne(context.Background(), trash.Live(bson.M{"_id": objID})).Decode(&item)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Inventory not found"})
@@ -522,17 +602,21 @@ func GetReceivingReportInventoryByID(c *gin.Context, db *mongo.Database) {
 	c.JSON(http.StatusOK, gin.H{"message": "Inventory fetched", "data": item})
 }
 
-func DeleteReceivingReportInventory(c *gin.Context, db *mongo.Database) {
+func DeleteReceivingReportInventory(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceReceivingReport, permission.ActionDelete) {
+		return
+	}
 	id := c.Param("id")
 
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -541,18 +625,21 @@ func DeleteReceivingReportInventory(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("polaris_receiving_reports")
-
-	res, err := collection.DeleteOne(context.Background(), bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "polaris_receiving_reports", objID)
+	deleted, err := trash.Delete(c, db, cfg, "polaris_receiving_reports", objID, userObj.ID)
+	if trash.Blocked(c, "Receiving report", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inventory"})
 		return
 	}
 
-	if res.DeletedCount == 0 {
+	if !deleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Inventory not found"})
 		return
 	}
 
+	audit.Changed(c, db, "polaris_receiving_reports", objID, audit.ActionDelete, before)
 	c.JSON(http.StatusOK, gin.H{"message": "Inventory deleted successfully"})
 }
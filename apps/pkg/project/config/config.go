@@ -10,4 +10,5 @@ type UpdateProjectRequest struct {
 	ProjectName string `json:"project_name"`
 	CustomerID  string `json:"customer_id"`
 	Notes       string `json:"notes"`
+	Version     *int64 `json:"version"`
 }
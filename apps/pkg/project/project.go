@@ -1,14 +1,19 @@
 package project
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/project/config"
+	projectconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/project/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -25,6 +30,10 @@ func GetCustomerDetails(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceCustomer, permission.ActionLookup) {
+		return
+	}
 	customerID := c.Param("id")
 
 	objID, err := primitive.ObjectIDFromHex(customerID)
@@ -36,7 +45,7 @@ func GetCustomerDetails(c *gin.Context, db *mongo.Database) {
 	var customer models.Customer
 	col := db.Collection("customer")
 
-	err = col.FindOne(c, bson.M{"_id": objID}).Decode(&customer)
+	err = col.FindOne(c, trash.Live(bson.M{"_id": objID})).Decode(&customer)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 		return
@@ -50,7 +59,7 @@ func GetCustomerDetails(c *gin.Context, db *mongo.Database) {
 	})
 }
 
-func CreateProject(c *gin.Context, db *mongo.Database) {
+func CreateProject(c *gin.Context, db *mongo.Database, cfg config.Config) {
 
 	user, exists := c.Get("user")
 	if !exists {
@@ -63,7 +72,11 @@ func CreateProject(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var projectdata config.CreateProjectRequest
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionCreate) {
+		return
+	}
+
+	var projectdata projectconfig.CreateProjectRequest
 	if err := c.ShouldBindJSON(&projectdata); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -75,10 +88,14 @@ func CreateProject(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Auto-generate PRJ-XXXX
-	projectCode := fmt.Sprintf("PRJ-%d", time.Now().Unix()%10000)
+	// Auto-generate PRJ-2025-0001
+	projectCode, err := sequence.Next(c, db, cfg, sequence.Project)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate project code"})
+		return
+	}
 
-	now := time.Now().Unix()
+	now := time.Now()
 
 	project := models.Project{
 		ID:          primitive.NewObjectID(),
@@ -91,11 +108,13 @@ func CreateProject(c *gin.Context, db *mongo.Database) {
 	}
 
 	// Insert to DB
-	_, err = db.Collection("project").InsertOne(c, project)
+	res, err := db.Collection("project").InsertOne(c, project)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
 		return
 	}
+	project.ID = res.InsertedID.(primitive.ObjectID)
+	audit.Created(c, db, "project", project.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Project created successfully",
@@ -114,6 +133,10 @@ func GetProjectFullDetails(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionView) {
+		return
+	}
 	// Get Project Mongo ObjectID from URL
 	projectID := c.Param("projectID")
 	if projectID == "" {
@@ -129,41 +152,42 @@ func GetProjectFullDetails(c *gin.Context, db *mongo.Database) {
 	}
 
 	var project models.Project
-	err = db.Collection("project").FindOne(c, bson.M{"_id": projectObjID}).Decode(&project)
+	err = db.Collection("project").FindOne(c, trash.Live(bson.M{"_id": projectObjID})).Decode(&project)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
 
 	var salesOrders []models.SalesOrder
-	cursor, _ := db.Collection("salesorder").Find(c, bson.M{"projectId": projectObjID})
+	cursor, _ := db.Collection("salesorder").Find(c, trash.Live(bson.M{"projectId": projectObjID}))
 	cursor.All(c, &salesOrders)
 
 	var supplierPO []models.SupplierPO
-	cursor, _ = db.Collection("supplier_purchase_orders").Find(c, bson.M{"projectId": projectObjID})
+	cursor, _ = db.Collection("supplier_purchase_orders").Find(c, trash.Live(bson.M{"projectId": projectObjID}))
 	cursor.All(c, &supplierPO)
 
 	var deliveryReceipts []models.SupplierDeliveryReceipt
-	cursor, _ = db.Collection("supplierdeliveryreceipt").Find(c, bson.M{"project_id": projectObjID})
+	cursor, _ = db.Collection("supplierdeliveryreceipt").Find(c, trash.Live(bson.M{"project_id": projectObjID}))
 	cursor.All(c, &deliveryReceipts)
 
 	var supplierInvoices []models.SupplierInvoice
-	cursor, _ = db.Collection("supplierinvoice").Find(c, bson.M{"project_id": projectObjID})
+	cursor, _ = db.Collection("supplierinvoice").Find(c, trash.Live(bson.M{"project_id": projectObjID}))
 	cursor.All(c, &supplierInvoices)
 
 	var suppliers []models.Supplier
-	cursor, _ = db.Collection("supplier").Find(c, bson.M{"project_id": projectObjID})
+	cursor, _ = db.Collection("supplier").Find(c, trash.Live(bson.M{"project_id": projectObjID}))
 	cursor.All(c, &suppliers)
 
 	var salesInvoices []models.SalesInvoice
-	cursor, _ = db.Collection("sales_invoices").Find(c, bson.M{"project_id": projectObjID})
+	cursor, _ = db.Collection("sales_invoices").Find(c, trash.Live(bson.M{"project_id": projectObjID}))
 	cursor.All(c, &salesInvoices)
 
 	var customerDR []models.DeliveryReceipt
-	cursor, _ = db.Collection("delivery_receipts").Find(c, bson.M{"project_id": projectObjID})
+	cursor, _ = db.Collection("delivery_receipts").Find(c, trash.Live(bson.M{"project_id": projectObjID}))
 	cursor.All(c, &customerDR)
 
 	// Final Response
+	version.SetETag(c, project.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"project":           project,
 		"sales_orders":      salesOrders,
@@ -181,7 +205,8 @@ type ProjectListResponse struct {
 	ProjectID   string             `bson:"project_id" json:"project_id"`
 	ProjectName string             `bson:"project_name" json:"project_name"`
 	Notes       string             `bson:"notes,omitempty" json:"notes,omitempty"`
-	CreatedAt   int64              `bson:"created_at" json:"created_at"`
+	Version     int64              `bson:"version" json:"version"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 
 	Customer struct {
 		ID   primitive.ObjectID `bson:"id" json:"id"`
@@ -190,6 +215,18 @@ type ProjectListResponse struct {
 	} `bson:"customer" json:"customer"`
 }
 
+var projectList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"project_id":   {Sort: true},
+		"project_name": {Sort: true},
+		"customer":     {Path: "customer_id", Kind: listquery.ObjectID},
+		"sales_order":  {Path: "sales_order_id", Kind: listquery.ObjectID},
+		"created_at":   {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"project_id", "project_name", "notes"},
+	Sort:   "-created_at",
+}
+
 func GetAllProjects(c *gin.Context, db *mongo.Database) {
 
 	// Auth
@@ -203,34 +240,18 @@ func GetAllProjects(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Pagination (same as PO)
-	page := int64(1)
-	limit := int64(10)
-
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionView) {
+		return
 	}
 
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
-			limit = v
-		}
+	query, ok := listquery.Parse(c, projectList)
+	if !ok {
+		return
 	}
 
-	skip := (page - 1) * limit
-
 	collection := db.Collection("project")
 
-	pipeline := mongo.Pipeline{
-		// Sort
-		{{Key: "$sort", Value: bson.M{"created_at": -1}}},
-
-		// Pagination
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
-
+	shape := mongo.Pipeline{
 		// Lookup Customer
 		{{
 			Key: "$lookup",
@@ -254,6 +275,7 @@ func GetAllProjects(c *gin.Context, db *mongo.Database) {
 				"project_id":   1,
 				"project_name": 1,
 				"notes":        1,
+				"version":      1,
 				"created_at":   1,
 
 				"customer": bson.M{
@@ -265,27 +287,14 @@ func GetAllProjects(c *gin.Context, db *mongo.Database) {
 		}},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var projects []ProjectListResponse
+	page, err := query.Run(c, collection, &projects, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
 		return
 	}
-	defer cursor.Close(c)
 
-	var projects []ProjectListResponse
-	if err := cursor.All(c, &projects); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode projects"})
-		return
-	}
-
-	total, _ := collection.CountDocuments(c, bson.M{})
-
-	c.JSON(http.StatusOK, gin.H{
-		"data":  projects,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(projects, page))
 }
 
 func GetAllProjectsInfo(c *gin.Context, db *mongo.Database) {
@@ -301,9 +310,14 @@ func GetAllProjectsInfo(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionLookup) {
+		return
+	}
+
 	collection := db.Collection("project")
 
 	pipeline := mongo.Pipeline{
+		trash.MatchLive,
 		// Sort latest first
 		{{Key: "$sort", Value: bson.M{"created_at": -1}}},
 
@@ -315,6 +329,7 @@ func GetAllProjectsInfo(c *gin.Context, db *mongo.Database) {
 				"project_id":   1,
 				"project_name": 1,
 				"notes":        1,
+				"version":      1,
 				"created_at":   1,
 			},
 		}},
@@ -333,7 +348,8 @@ func GetAllProjectsInfo(c *gin.Context, db *mongo.Database) {
 		ProjectID   string             `bson:"project_id" json:"project_id"`
 		ProjectName string             `bson:"project_name" json:"project_name"`
 		Notes       string             `bson:"notes,omitempty" json:"notes,omitempty"`
-		CreatedAt   int64              `bson:"created_at" json:"created_at"`
+		Version     int64              `bson:"version" json:"version"`
+		CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	}
 
 	if err := cursor.All(c, &projects); err != nil {
@@ -360,6 +376,10 @@ func UpdateProject(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionEdit) {
+		return
+	}
+
 	projectID := c.Param("id")
 	if projectID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "project ID is required"})
@@ -373,12 +393,17 @@ func UpdateProject(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var req config.UpdateProjectRequest
+	var req projectconfig.UpdateProjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
 	}
 
+	expected, ok := version.Expected(c, req.Version)
+	if !ok {
+		return
+	}
+
 	// Convert customer ID → ObjectID
 	custObjID, err := primitive.ObjectIDFromHex(req.CustomerID)
 	if err != nil {
@@ -390,13 +415,14 @@ func UpdateProject(c *gin.Context, db *mongo.Database) {
 		"project_name": req.ProjectName,
 		"customer_id":  custObjID,
 		"notes":        req.Notes,
-		"updatedAt":    time.Now().Unix(),
+		"updated_at":   time.Now(),
 	}
 
+	before := audit.Snapshot(c, db, "project", projectObjID)
 	result, err := db.Collection("project").UpdateOne(
 		c,
-		bson.M{"_id": projectObjID},
-		bson.M{"$set": updateData},
+		version.Filter(projectObjID, expected),
+		version.Bump(bson.M{"$set": updateData}),
 	)
 
 	if err != nil {
@@ -405,17 +431,20 @@ func UpdateProject(c *gin.Context, db *mongo.Database) {
 	}
 
 	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		version.Conflict(c, db, "project", projectObjID, "Project not found")
 		return
 	}
 
+	audit.Updated(c, db, "project", projectObjID, before)
+	version.SetETag(c, expected+1)
 	c.JSON(http.StatusOK, gin.H{
 		"message":        "Project updated successfully",
 		"updated_fields": updateData,
+		"version":        expected + 1,
 	})
 }
 
-func DeleteProject(c *gin.Context, db *mongo.Database) {
+func DeleteProject(c *gin.Context, db *mongo.Database, cfg config.Config) {
 
 	// Auth check
 	user, exists := c.Get("user")
@@ -423,12 +452,16 @@ func DeleteProject(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceProject, permission.ActionDelete) {
+		return
+	}
+
 	projectID := c.Param("id")
 	if projectID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "project ID is required"})
@@ -442,18 +475,23 @@ func DeleteProject(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Delete from DB
-	result, err := db.Collection("project").DeleteOne(c, bson.M{"_id": projectObjID})
+	// Move to the trash
+	before := audit.Snapshot(c, db, "project", projectObjID)
+	deleted, err := trash.Delete(c, db, cfg, "project", projectObjID, userObj.ID)
+	if trash.Blocked(c, "Project", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 		return
 	}
 
-	if result.DeletedCount == 0 {
+	if !deleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
 
+	audit.Changed(c, db, "project", projectObjID, audit.ActionDelete, before)
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Project deleted successfully",
 		"project_id": projectID,
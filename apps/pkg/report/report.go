@@ -1,18 +1,24 @@
 package report
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/pipelinehelper"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/reporthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/report/config"
+	reportconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/report/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GenerateReport(c *gin.Context, db *mongo.Database) {
+func GenerateReport(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
@@ -25,7 +31,11 @@ func GenerateReport(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var req config.ReportRequest
+	if !permission.Authorize(c, db, permission.ResourceReport, permission.ActionView) {
+		return
+	}
+
+	var req reportconfig.ReportRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
 		return
@@ -38,24 +48,29 @@ func GenerateReport(c *gin.Context, db *mongo.Database) {
 	switch req.ReportType {
 
 	case "customer":
-		GenerateCustomerReport(c, db, start, end, req.ExportType)
+		GenerateCustomerReport(c, db, cfg, start, end, req.ExportType)
 
 	case "inventory":
-		GenerateInventoryReport(c, db, start, end, req.ExportType)
+		GenerateInventoryReport(c, db, cfg, start, end, req.ExportType)
 	case "supplier":
-		GenerateSupplierReport(c, db, start, end, req.ExportType)
+		GenerateSupplierReport(c, db, cfg, start, end, req.ExportType)
 	case "sales":
-		GenerateSalesInvoiceReport(c, db, start, end, req.ExportType)
+		GenerateSalesInvoiceReport(c, db, cfg, start, end, req.ExportType)
 
 	case "financial":
-		GenerateFinancialReport(c, db, start, end, req.ExportType)
+		GenerateFinancialReport(c, db, cfg, start, end, req.ExportType)
 
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report type"})
+		return
+	}
+
+	if c.Writer.Status() < http.StatusBadRequest {
+		metrics.ReportsGenerated.Inc(req.ReportType, req.ExportType)
 	}
 }
 
-func GenerateCustomerReport(c *gin.Context, db *mongo.Database, start, end time.Time, exportType string) {
+func GenerateCustomerReport(c *gin.Context, db *mongo.Database, cfg config.Config, start, end time.Time, exportType string) {
 
 	collection := db.Collection("customer")
 
@@ -66,7 +81,7 @@ func GenerateCustomerReport(c *gin.Context, db *mongo.Database, start, end time.
 		},
 	}
 
-	cursor, err := collection.Find(c, filter)
+	cursor, err := collection.Find(c, trash.Live(filter))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
 		return
@@ -80,21 +95,21 @@ func GenerateCustomerReport(c *gin.Context, db *mongo.Database, start, end time.
 
 	switch exportType {
 	case "csv":
-		filePath, _ := reporthelper.GenerateCustomerCSV(customers)
+		filePath, _ := reporthelper.GenerateCustomerCSV(cfg, customers)
 		c.Header("Content-Type", "text/csv")
 		c.Header("Content-Disposition", "attachment; filename=customer_report.csv")
 		c.File(filePath)
 		return
 
 	case "excel":
-		filePath, _ := reporthelper.GenerateCustomerExcel(customers)
+		filePath, _ := reporthelper.GenerateCustomerExcel(cfg, customers)
 		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 		c.Header("Content-Disposition", "attachment; filename=customer_report.xlsx")
 		c.File(filePath)
 		return
 
 	case "pdf":
-		filePath, _ := reporthelper.GenerateCustomerPDF(customers, start, end)
+		filePath, _ := reporthelper.GenerateCustomerPDF(cfg, customers, start, end)
 		c.Header("Content-Type", "application/pdf")
 		c.Header("Content-Disposition", "attachment; filename=customer_report.pdf")
 		c.File(filePath)
@@ -107,7 +122,7 @@ func GenerateCustomerReport(c *gin.Context, db *mongo.Database, start, end time.
 
 }
 
-func GenerateInventoryReport(c *gin.Context, db *mongo.Database, start, end time.Time, exportType string) {
+func GenerateInventoryReport(c *gin.Context, db *mongo.Database, cfg config.Config, start, end time.Time, exportType string) {
 
 	collection := db.Collection("polaris_inventory")
 
@@ -118,7 +133,7 @@ func GenerateInventoryReport(c *gin.Context, db *mongo.Database, start, end time
 		},
 	}
 
-	cursor, err := collection.Find(c, filter)
+	cursor, err := collection.Find(c, trash.Live(filter))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
 		return
@@ -133,19 +148,19 @@ func GenerateInventoryReport(c *gin.Context, db *mongo.Database, start, end time
 	switch exportType {
 
 	case "csv":
-		filePath, _ := reporthelper.GenerateInventoryCSV(items)
+		filePath, _ := reporthelper.GenerateInventoryCSV(cfg, items)
 		c.Header("Content-Type", "text/csv")
 		c.Header("Content-Disposition", "attachment; filename=inventory_report.csv")
 		c.File(filePath)
 
 	case "excel":
-		filePath, _ := reporthelper.GenerateInventoryExcel(items)
+		filePath, _ := reporthelper.GenerateInventoryExcel(cfg, items)
 		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 		c.Header("Content-Disposition", "attachment; filename=inventory_report.xlsx")
 		c.File(filePath)
 
 	case "pdf":
-		filePath, _ := reporthelper.GenerateInventoryPDF(items, start, end)
+		filePath, _ := reporthelper.GenerateInventoryPDF(cfg, items, start, end)
 		c.Header("Content-Type", "application/pdf")
 		c.Header("Content-Disposition", "attachment; filename=inventory_report.pdf")
 		c.File(filePath)
@@ -155,7 +170,7 @@ func GenerateInventoryReport(c *gin.Context, db *mongo.Database, start, end time
 	}
 }
 
-func GenerateSupplierReport(c *gin.Context, db *mongo.Database, start, end time.Time, exportType string) {
+func GenerateSupplierReport(c *gin.Context, db *mongo.Database, cfg config.Config, start, end time.Time, exportType string) {
 
 	collection := db.Collection("supplier")
 
@@ -166,7 +181,7 @@ func GenerateSupplierReport(c *gin.Context, db *mongo.Database, start, end time.
 		},
 	}
 
-	cursor, err := collection.Find(c, filter)
+	cursor, err := collection.Find(c, trash.Live(filter))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers"})
 		return
@@ -181,19 +196,19 @@ func GenerateSupplierReport(c *gin.Context, db *mongo.Database, start, end time.
 	switch exportType {
 
 	case "csv":
-		filePath, _ := reporthelper.GenerateSupplierCSV(suppliers)
+		filePath, _ := reporthelper.GenerateSupplierCSV(cfg, suppliers)
 		c.Header("Content-Type", "text/csv")
 		c.Header("Content-Disposition", "attachment; filename=supplier_report.csv")
 		c.File(filePath)
 
 	case "excel":
-		filePath, _ := reporthelper.GenerateSupplierExcel(suppliers)
+		filePath, _ := reporthelper.GenerateSupplierExcel(cfg, suppliers)
 		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 		c.Header("Content-Disposition", "attachment; filename=supplier_report.xlsx")
 		c.File(filePath)
 
 	case "pdf":
-		filePath, _ := reporthelper.GenerateSupplierPDF(suppliers, start, end)
+		filePath, _ := reporthelper.GenerateSupplierPDF(cfg, suppliers, start, end)
 		c.Header("Content-Type", "application/pdf")
 		c.Header("Content-Disposition", "attachment; filename=supplier_report.pdf")
 		c.File(filePath)
@@ -203,69 +218,29 @@ func GenerateSupplierReport(c *gin.Context, db *mongo.Database, start, end time.
 	}
 }
 
-func GenerateSalesInvoiceReport(c *gin.Context, db *mongo.Database, start, end time.Time, exportType string) {
-
-	collection := db.Collection("sales_invoices")
-
-	filter := bson.M{
-		"created_at": bson.M{
-			"$gte": start,
-			"$lte": end,
-		},
-	}
+func GenerateSalesInvoiceReport(c *gin.Context, db *mongo.Database, cfg config.Config, start, end time.Time, exportType string) {
 
-	cursor, err := collection.Find(c, filter)
+	invoiceData, err := SalesInvoiceRows(c, db, start, end)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales invoices"})
 		return
 	}
 
-	var invoices []models.SalesInvoice
-	if err := cursor.All(c, &invoices); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse invoices"})
-		return
-	}
-
-	// Fetch related names
-	var invoiceData []reporthelper.SalesInvoiceReportRow
-
-	projectCol := db.Collection("project")
-	customerCol := db.Collection("customer")
-
-	for _, inv := range invoices {
-		var project models.Project
-		var customer models.Customer
-
-		// Fetch Project
-		_ = projectCol.FindOne(c, bson.M{"_id": inv.ProjectID}).Decode(&project)
-
-		// Fetch Customer
-		_ = customerCol.FindOne(c, bson.M{"_id": inv.CustomerID}).Decode(&customer)
-
-		invoiceData = append(invoiceData, reporthelper.SalesInvoiceReportRow{
-			InvoiceID:    inv.InvoiceID,
-			ProjectName:  project.ProjectName,
-			CustomerName: customer.CustomerName,
-			TotalAmount:  inv.TotalAmount,
-			CreatedAt:    inv.CreatedAt,
-		})
-	}
-
 	switch exportType {
 	case "csv":
-		filePath, _ := reporthelper.GenerateSalesInvoiceCSV(invoiceData)
+		filePath, _ := reporthelper.GenerateSalesInvoiceCSV(cfg, invoiceData)
 		c.Header("Content-Type", "text/csv")
 		c.Header("Content-Disposition", "attachment; filename=sales_invoice_report.csv")
 		c.File(filePath)
 
 	case "excel":
-		filePath, _ := reporthelper.GenerateSalesInvoiceExcel(invoiceData)
+		filePath, _ := reporthelper.GenerateSalesInvoiceExcel(cfg, invoiceData)
 		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 		c.Header("Content-Disposition", "attachment; filename=sales_invoice_report.xlsx")
 		c.File(filePath)
 
 	case "pdf":
-		filePath, _ := reporthelper.GenerateSalesInvoicePDF(invoiceData, start, end)
+		filePath, _ := reporthelper.GenerateSalesInvoicePDF(cfg, invoiceData, start, end)
 		c.Header("Content-Type", "application/pdf")
 		c.Header("Content-Disposition", "attachment; filename=sales_invoice_report.pdf")
 		c.File(filePath)
@@ -275,100 +250,31 @@ func GenerateSalesInvoiceReport(c *gin.Context, db *mongo.Database, start, end t
 	}
 }
 
-func GenerateFinancialReport(c *gin.Context, db *mongo.Database, start, end time.Time, exportType string) {
+func GenerateFinancialReport(c *gin.Context, db *mongo.Database, cfg config.Config, start, end time.Time, exportType string) {
 
-	supplierCol := db.Collection("supplierinvoice")
-	salesCol := db.Collection("sales_invoices")
-	projectCol := db.Collection("project")
-	customerCol := db.Collection("customer")
-	supplierMasterCol := db.Collection("supplier")
-
-	// Final combined dataset
-	var reportData []reporthelper.FinancialReportRow
-
-	// -------------------------
-	// 1. Supplier Invoices
-	// -------------------------
-	supCursor, err := supplierCol.Find(c, bson.M{
-		"created_at": bson.M{"$gte": start, "$lte": end},
-	})
+	reportData, err := FinancialRows(c, db, start, end)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier invoices"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
 		return
 	}
 
-	var supplierInvoices []models.SupplierInvoice
-	_ = supCursor.All(c, &supplierInvoices)
-
-	for _, inv := range supplierInvoices {
-		// Fetch Project
-		var project models.Project
-		_ = projectCol.FindOne(c, bson.M{"_id": inv.ProjectID}).Decode(&project)
-
-		// Fetch Supplier name
-		var supplier models.Supplier
-		_ = supplierMasterCol.FindOne(c, bson.M{"_id": inv.SupplierID}).Decode(&supplier)
-
-		reportData = append(reportData, reporthelper.FinancialReportRow{
-			Category:    "Purchase",
-			InvoiceNo:   inv.InvoiceNo,
-			ProjectName: project.ProjectName,
-			EntityName:  supplier.SupplierName,
-			Amount:      inv.GrandTotal,
-			Date:        inv.InvoiceDate,
-		})
-	}
-
-	// -------------------------
-	// 2. Sales Invoices
-	// -------------------------
-	salesCursor, err := salesCol.Find(c, bson.M{
-		"created_at": bson.M{"$gte": start, "$lte": end},
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales invoices"})
-		return
-	}
-
-	var salesInvoices []models.SalesInvoice
-	_ = salesCursor.All(c, &salesInvoices)
-
-	for _, inv := range salesInvoices {
-		// Fetch Project
-		var project models.Project
-		_ = projectCol.FindOne(c, bson.M{"_id": inv.ProjectID}).Decode(&project)
-
-		// Fetch Customer
-		var customer models.Customer
-		_ = customerCol.FindOne(c, bson.M{"_id": inv.CustomerID}).Decode(&customer)
-
-		reportData = append(reportData, reporthelper.FinancialReportRow{
-			Category:    "Sales",
-			InvoiceNo:   inv.InvoiceID,
-			ProjectName: project.ProjectName,
-			EntityName:  customer.CustomerName,
-			Amount:      inv.TotalAmount,
-			Date:        inv.CreatedAt,
-		})
-	}
-
 	// Handle export
 	switch exportType {
 
 	case "csv":
-		fp, _ := reporthelper.GenerateFinancialCSV(reportData)
+		fp, _ := reporthelper.GenerateFinancialCSV(cfg, reportData)
 		c.Header("Content-Type", "text/csv")
 		c.Header("Content-Disposition", "attachment; filename=financial_report.csv")
 		c.File(fp)
 
 	case "excel":
-		fp, _ := reporthelper.GenerateFinancialExcel(reportData)
+		fp, _ := reporthelper.GenerateFinancialExcel(cfg, reportData)
 		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 		c.Header("Content-Disposition", "attachment; filename=financial_report.xlsx")
 		c.File(fp)
 
 	case "pdf":
-		fp, _ := reporthelper.GenerateFinancialPDF(reportData, start, end)
+		fp, _ := reporthelper.GenerateFinancialPDF(cfg, reportData, start, end)
 		c.Header("Content-Type", "application/pdf")
 		c.Header("Content-Disposition", "attachment; filename=financial_report.pdf")
 		c.File(fp)
@@ -377,3 +283,87 @@ func GenerateFinancialReport(c *gin.Context, db *mongo.Database, start, end time
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export type"})
 	}
 }
+
+// SalesInvoiceRows reads the sales invoices created in the period, with their
+// project and customer names, in one aggregation
+func SalesInvoiceRows(ctx context.Context, db *mongo.Database, start, end time.Time) ([]reporthelper.SalesInvoiceReportRow, error) {
+	cursor, err := db.Collection("sales_invoices").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: trash.Live(bson.M{"created_at": bson.M{"$gte": start, "$lte": end}})}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		lookup("project", "project_id", "project"),
+		lookup("customer", "customer_id", "customer"),
+		{{Key: "$project", Value: bson.M{
+			"invoice_id":    1,
+			"total_amount":  1,
+			"created_at":    1,
+			"project_name":  pipelinehelper.First("$project.project_name"),
+			"customer_name": pipelinehelper.First("$customer.customername"),
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []reporthelper.SalesInvoiceReportRow
+	err = cursor.All(ctx, &rows)
+	return rows, err
+}
+
+// FinancialRows reads the supplier invoices and then the sales invoices
+// created in the period, with their project and supplier or customer names,
+// in one aggregation
+func FinancialRows(ctx context.Context, db *mongo.Database, start, end time.Time) ([]reporthelper.FinancialReportRow, error) {
+	period := trash.Live(bson.M{"created_at": bson.M{"$gte": start, "$lte": end}})
+	byCreation := bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+
+	sales := bson.A{
+		bson.M{"$match": period},
+		bson.M{"$sort": byCreation},
+		lookup("project", "project_id", "project"),
+		lookup("customer", "customer_id", "customer"),
+		bson.M{"$project": bson.M{
+			"_id":          0,
+			"category":     bson.M{"$literal": "Sales"},
+			"invoice_no":   "$invoice_id",
+			"project_name": pipelinehelper.First("$project.project_name"),
+			"entity_name":  pipelinehelper.First("$customer.customername"),
+			"amount":       "$total_amount",
+			"date":         "$created_at",
+		}},
+	}
+
+	cursor, err := db.Collection("supplierinvoice").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: period}},
+		{{Key: "$sort", Value: byCreation}},
+		lookup("project", "project_id", "project"),
+		lookup("supplier", "supplier_id", "supplier"),
+		{{Key: "$project", Value: bson.M{
+			"_id":          0,
+			"category":     bson.M{"$literal": "Purchase"},
+			"invoice_no":   1,
+			"project_name": pipelinehelper.First("$project.project_name"),
+			"entity_name":  pipelinehelper.First("$supplier.supplier_name"),
+			"amount":       "$grand_total",
+			"date":         "$invoice_date",
+		}}},
+		{{Key: "$unionWith", Value: bson.M{"coll": "sales_invoices", "pipeline": sales}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []reporthelper.FinancialReportRow
+	err = cursor.All(ctx, &rows)
+	return rows, err
+}
+
+func lookup(from, localField, as string) bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": "_id",
+		"as":           as,
+	}}}
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/reporthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/mongotest"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BenchmarkSalesInvoiceRows times the sales invoice report as an aggregation
+// against the per-document lookups it replaced
+func BenchmarkSalesInvoiceRows(b *testing.B) {
+	benchmarkRows(b, salesInvoiceRowsPerDocument, SalesInvoiceRows)
+}
+
+// BenchmarkFinancialRows times the financial report as an aggregation
+// against the per-document lookups it replaced
+func BenchmarkFinancialRows(b *testing.B) {
+	benchmarkRows(b, financialRowsPerDocument, FinancialRows)
+}
+
+type rowsFunc[T any] func(ctx context.Context, db *mongo.Database, start, end time.Time) ([]T, error)
+
+// benchmarkRows checks that both ways return the same rows, then times each
+func benchmarkRows[T any](b *testing.B, perDocument, aggregated rowsFunc[T]) {
+	db := mongotest.Open(b)
+	seeded := mongotest.Seed(b, db, 2000, 5)
+	ctx := context.Background()
+
+	want, err := perDocument(ctx, db, seeded.Start, seeded.End)
+	if err != nil {
+		b.Fatal(err)
+	}
+	got, err := aggregated(ctx, db, seeded.Start, seeded.End)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mongotest.SameRows(b, want, got)
+
+	for _, bc := range []struct {
+		name string
+		rows rowsFunc[T]
+	}{{"per-document", perDocument}, {"aggregation", aggregated}} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bc.rows(ctx, db, seeded.Start, seeded.End); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// byCreation is the order the reports list invoices in
+func byCreation() *options.FindOptions {
+	return options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+}
+
+// salesInvoiceRowsPerDocument is the sales invoice report before it was an
+// aggregation
+func salesInvoiceRowsPerDocument(ctx context.Context, db *mongo.Database, start, end time.Time) ([]reporthelper.SalesInvoiceReportRow, error) {
+	cursor, err := db.Collection("sales_invoices").Find(ctx, trash.Live(bson.M{"created_at": bson.M{"$gte": start, "$lte": end}}), byCreation())
+	if err != nil {
+		return nil, err
+	}
+	var invoices []models.SalesInvoice
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+
+	var rows []reporthelper.SalesInvoiceReportRow
+	for _, inv := range invoices {
+		var project models.Project
+		var customer models.Customer
+		_ = db.Collection("project").FindOne(ctx, bson.M{"_id": inv.ProjectID}).Decode(&project)
+		_ = db.Collection("customer").FindOne(ctx, bson.M{"_id": inv.CustomerID}).Decode(&customer)
+		rows = append(rows, reporthelper.SalesInvoiceReportRow{
+			InvoiceID: inv.InvoiceID, ProjectName: project.ProjectName, CustomerName: customer.CustomerName,
+			TotalAmount: inv.TotalAmount, CreatedAt: inv.CreatedAt,
+		})
+	}
+	return rows, nil
+}
+
+// financialRowsPerDocument is the financial report before it was an
+// aggregation
+func financialRowsPerDocument(ctx context.Context, db *mongo.Database, start, end time.Time) ([]reporthelper.FinancialReportRow, error) {
+	period := bson.M{"created_at": bson.M{"$gte": start, "$lte": end}}
+	var rows []reporthelper.FinancialReportRow
+
+	cursor, err := db.Collection("supplierinvoice").Find(ctx, trash.Live(period), byCreation())
+	if err != nil {
+		return nil, err
+	}
+	var purchases []models.SupplierInvoice
+	if err := cursor.All(ctx, &purchases); err != nil {
+		return nil, err
+	}
+	for _, inv := range purchases {
+		var project models.Project
+		var supplier models.Supplier
+		_ = db.Collection("project").FindOne(ctx, bson.M{"_id": inv.ProjectID}).Decode(&project)
+		_ = db.Collection("supplier").FindOne(ctx, bson.M{"_id": inv.SupplierID}).Decode(&supplier)
+		rows = append(rows, reporthelper.FinancialReportRow{
+			Category: "Purchase", InvoiceNo: inv.InvoiceNo, ProjectName: project.ProjectName, EntityName: supplier.SupplierName,
+			Amount: inv.GrandTotal, Date: inv.InvoiceDate,
+		})
+	}
+
+	cursor, err = db.Collection("sales_invoices").Find(ctx, trash.Live(bson.M{"created_at": bson.M{"$gte": start, "$lte": end}}), byCreation())
+	if err != nil {
+		return nil, err
+	}
+	var sales []models.SalesInvoice
+	if err := cursor.All(ctx, &sales); err != nil {
+		return nil, err
+	}
+	for _, inv := range sales {
+		var project models.Project
+		var customer models.Customer
+		_ = db.Collection("project").FindOne(ctx, bson.M{"_id": inv.ProjectID}).Decode(&project)
+		_ = db.Collection("customer").FindOne(ctx, bson.M{"_id": inv.CustomerID}).Decode(&customer)
+		rows = append(rows, reporthelper.FinancialReportRow{
+			Category: "Sales", InvoiceNo: inv.InvoiceID, ProjectName: project.ProjectName, EntityName: customer.CustomerName,
+			Amount: inv.TotalAmount, Date: inv.CreatedAt,
+		})
+	}
+	return rows, nil
+}
@@ -27,4 +27,5 @@ type EditSalesOrder struct {
 	CustomerID string             `json:"customerId"`
 	Items      []SalesOrderItemIn `json:"items"`
 	Status     string             `json:"status"` //"notapproved" or "approved"
+	Version    *int64             `json:"version"`
 }
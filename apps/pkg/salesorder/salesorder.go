@@ -1,23 +1,25 @@
 package salesorder
 
 import (
-	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/salesorder/config"
+	salesorderconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/salesorder/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GenerateSalesOrderID(count int64) string {
-	year := time.Now().Year()
-	return fmt.Sprintf("SO-%d-%05d", year, count+1)
-}
-func CreateSalesOrder(c *gin.Context, db *mongo.Database) {
+func CreateSalesOrder(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
@@ -29,7 +31,11 @@ func CreateSalesOrder(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.SalesOrderData
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionCreate) {
+		return
+	}
+
+	var payload salesorderconfig.SalesOrderData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload", "details": err.Error()})
 		return
@@ -73,16 +79,13 @@ func CreateSalesOrder(c *gin.Context, db *mongo.Database) {
 
 	collection := db.Collection("salesorder")
 
-	// Count existing sales orders for ID generation
-	count, err := collection.CountDocuments(c, bson.M{})
+	// Generate "SO-2025-00001"
+	salesOrderID, err := sequence.Next(c, db, cfg, sequence.SalesOrder)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed generating salesOrderID"})
 		return
 	}
 
-	// Generate "SO-2025-00001"
-	salesOrderID := GenerateSalesOrderID(count)
-
 	// Create new order object
 	salesOrder := models.SalesOrder{
 		SalesOrderID: salesOrderID,
@@ -101,6 +104,7 @@ func CreateSalesOrder(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sales order", "details": err.Error()})
 		return
 	}
+	audit.Created(c, db, "salesorder", res.InsertedID.(primitive.ObjectID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Sales order created successfully",
@@ -121,7 +125,11 @@ func EditSalesOrder(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.EditSalesOrder
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionEdit) {
+		return
+	}
+
+	var payload salesorderconfig.EditSalesOrder
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
 		return
@@ -133,6 +141,11 @@ func EditSalesOrder(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	projectID, err := primitive.ObjectIDFromHex(payload.ProjectID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
@@ -176,29 +189,70 @@ func EditSalesOrder(c *gin.Context, db *mongo.Database) {
 		},
 	}
 
+	collection := db.Collection("salesorder")
+
 	// if the user provides a valid Status ("approved" or "notapproved"), update it
 	if payload.Status == "approved" || payload.Status == "notapproved" {
+		// Changing the status is an approval decision and needs its own permission
+		var current models.SalesOrder
+		if err := collection.FindOne(c, trash.Live(bson.M{"_id": objID})).Decode(&current); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Sales order not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales order", "details": err.Error()})
+			return
+		}
+		if current.Status != payload.Status &&
+			!permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionApprove) {
+			return
+		}
 		update["$set"].(bson.M)["status"] = payload.Status
 	}
 
-	collection := db.Collection("salesorder")
-	res, err := collection.UpdateOne(c, bson.M{"_id": objID}, update)
+	before := audit.Snapshot(c, db, "salesorder", objID)
+	res, err := collection.UpdateOne(c, version.Filter(objID, expected), version.Bump(update))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sales order", "details": err.Error()})
 		return
 	}
 
 	if res.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Sales order not found"})
+		version.Conflict(c, db, "salesorder", objID, "Sales order not found")
 		return
 	}
 
+	action := audit.ActionUpdate
+	if before != nil && before["status"] != payload.Status && payload.Status == "approved" {
+		action = audit.ActionApprove
+	}
+	audit.Changed(c, db, "salesorder", objID, action, before)
+
+	version.SetETag(c, expected+1)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Sales order updated successfully",
 		"status":  payload.Status,
+		"version": expected + 1,
 	})
 }
 
+// salesOrderList is how sales orders can be listed. Pages default to the
+// maximum because forms load the whole list for their pickers, following
+// nextCursor until the last page.
+var salesOrderList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"sales_order_id": {Path: "salesOrderId", Sort: true},
+		"status":         {Sort: true},
+		"customer":       {Path: "customerId", Kind: listquery.ObjectID},
+		"project":        {Path: "projectId", Kind: listquery.ObjectID},
+		"total_amount":   {Path: "totalAmount", Kind: listquery.Number, Sort: true},
+		"created_at":     {Path: "createdAt", Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"salesOrderId", "status"},
+	Sort:   "-created_at",
+	Limit:  listquery.MaxLimit,
+}
+
 func GetAllSalesOrders(c *gin.Context, db *mongo.Database) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -211,75 +265,25 @@ func GetAllSalesOrders(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	orderColl := db.Collection("salesorder")
-	projectColl := db.Collection("project")
-	customerColl := db.Collection("customer")
-	airconColl := db.Collection("aircon")
-
-	// Fetch all sales orders
-	cursor, err := orderColl.Find(c, bson.M{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales orders", "details": err.Error()})
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionLookup) {
 		return
 	}
-	defer cursor.Close(c)
 
-	var orders []models.SalesOrder
-	if err := cursor.All(c, &orders); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode sales orders", "details": err.Error()})
+	query, ok := listquery.Parse(c, salesOrderList)
+	if !ok {
 		return
 	}
 
-	// Prepare response slice
-	var enrichedOrders []bson.M
-
-	for _, order := range orders {
-		// --- Project Name ---
-		var project models.Project
-		projectName := ""
-		if err := projectColl.FindOne(c, bson.M{"_id": order.ProjectID}).Decode(&project); err == nil {
-			projectName = project.ProjectName
-		}
-
-		// --- Customer Name ---
-		var customer models.Customer
-		customerName := ""
-		if err := customerColl.FindOne(c, bson.M{"_id": order.CustomerID}).Decode(&customer); err == nil {
-			customerName = customer.CustomerName
-		}
-
-		// --- Replace Aircon IDs with Names ---
-		var items []bson.M
-		for _, item := range order.Items {
-			var aircon models.Aircon
-			airconName := ""
-			if err := airconColl.FindOne(c, bson.M{"_id": item.AirconID}).Decode(&aircon); err == nil {
-				airconName = aircon.Name
-			}
-			items = append(items, bson.M{
-				"airconName": airconName,
-				"qty":        item.Qty,
-				"uom":        item.UOM,
-				"price":      item.Price,
-				"subtotal":   item.Subtotal,
-			})
-		}
-
-		enrichedOrders = append(enrichedOrders, bson.M{
-			"id":           order.ID.Hex(),
-			"projectName":  projectName,
-			"salesOrderId": order.SalesOrderID,
-			"customerName": customerName,
-			"items":        items,
-			"totalAmount":  order.TotalAmount,
-			"createdBy":    order.CreatedBy.Hex(),
-			"createdAt":    order.CreatedAt,
-			"updatedAt":    order.UpdatedAt,
-			"status":       order.Status,
-		})
+	var orders []SalesOrderView
+	page, err := query.Run(c, db.Collection("salesorder"), &orders, ViewStages()...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales orders", "details": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"salesOrders": enrichedOrders})
+	body := listquery.Envelope(orders, page)
+	body["salesOrders"] = body["data"] // older clients read this key
+	c.JSON(http.StatusOK, body)
 }
 
 func GetSalesOrderByID(c *gin.Context, db *mongo.Database) {
@@ -294,6 +298,10 @@ func GetSalesOrderByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionView) {
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID parameter required"})
@@ -306,82 +314,47 @@ func GetSalesOrderByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	orderColl := db.Collection("salesorder")
-	projectColl := db.Collection("project")
-	customerColl := db.Collection("customer")
-	airconColl := db.Collection("aircon")
-
-	// Find the sales order by ID
-	var order models.SalesOrder
-	err = orderColl.FindOne(c, bson.M{"_id": objID}).Decode(&order)
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: trash.Live(bson.M{"_id": objID})}},
+	}, ViewStages()...)
+	cursor, err := db.Collection("salesorder").Aggregate(c, pipeline)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Sales order not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales order", "details": err.Error()})
-		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales order", "details": err.Error()})
 		return
 	}
+	defer cursor.Close(c)
 
-	// --- Fetch project name ---
-	var project models.Project
-	projectName := ""
-	if err := projectColl.FindOne(c, bson.M{"_id": order.ProjectID}).Decode(&project); err == nil {
-		projectName = project.ProjectName
-	}
-
-	// --- Fetch customer name ---
-	var customer models.Customer
-	customerName := ""
-	if err := customerColl.FindOne(c, bson.M{"_id": order.CustomerID}).Decode(&customer); err == nil {
-		customerName = customer.CustomerName
-	}
-
-	// --- Fetch aircon names for each item ---
-	var items []bson.M
-	for _, item := range order.Items {
-		var aircon models.Aircon
-		airconName := ""
-		if err := airconColl.FindOne(c, bson.M{"_id": item.AirconID}).Decode(&aircon); err == nil {
-			airconName = aircon.Name
-		}
-		items = append(items, bson.M{
-			"airconName": airconName,
-			"qty":        item.Qty,
-			"uom":        item.UOM,
-			"price":      item.Price,
-			"subtotal":   item.Subtotal,
-		})
+	var orders []SalesOrderView
+	if err := cursor.All(c, &orders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales order", "details": err.Error()})
+		return
 	}
-
-	// --- Construct enriched response ---
-	enrichedOrder := bson.M{
-		"id":           order.ID.Hex(),
-		"projectName":  projectName,
-		"customerName": customerName,
-		"items":        items,
-		"totalAmount":  order.TotalAmount,
-		"createdBy":    order.CreatedBy.Hex(),
-		"createdAt":    order.CreatedAt,
-		"updatedAt":    order.UpdatedAt,
-		"status":       order.Status,
+	if len(orders) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sales order not found"})
+		return
 	}
+	order := orders[0]
 
-	c.JSON(http.StatusOK, gin.H{"salesOrder": enrichedOrder})
+	version.SetETag(c, order.Version)
+	c.JSON(http.StatusOK, gin.H{"salesOrder": order})
 }
 
-func DeleteSalesOrder(c *gin.Context, db *mongo.Database) {
+func DeleteSalesOrder(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionDelete) {
+		return
+	}
+
 	var payload struct {
 		ID string `json:"id"`
 	}
@@ -401,18 +374,22 @@ func DeleteSalesOrder(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("salesorder")
-	res, err := collection.DeleteOne(c, bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "salesorder", objID)
+	deleted, err := trash.Delete(c, db, cfg, "salesorder", objID, userObj.ID)
+	if trash.Blocked(c, "Sales order", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sales order", "details": err.Error()})
 		return
 	}
 
-	if res.DeletedCount == 0 {
+	if !deleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Sales order not found"})
 		return
 	}
 
+	audit.Changed(c, db, "salesorder", objID, audit.ActionDelete, before)
 	c.JSON(http.StatusOK, gin.H{"message": "Sales order deleted successfully", "deletedId": payload.ID})
 }
 
@@ -428,7 +405,11 @@ func CreateAircon(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.AirconData
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionCreate) {
+		return
+	}
+
+	var payload salesorderconfig.AirconData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
 		return
@@ -440,11 +421,14 @@ func CreateAircon(c *gin.Context, db *mongo.Database) {
 	}
 
 	collection := db.Collection("aircon")
-	_, err := collection.InsertOne(c, payload)
+	res, err := collection.InsertOne(c, payload)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save aircon", "details": err.Error()})
 		return
 	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		audit.Created(c, db, "aircon", id)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Aircon added successfully",
@@ -463,6 +447,10 @@ func GetAllAircon(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSalesOrder, permission.ActionLookup) {
+		return
+	}
 	collection := db.Collection("aircon")
 
 	cursor, err := collection.Find(c, bson.M{})
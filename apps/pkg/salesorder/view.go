@@ -0,0 +1,92 @@
+package salesorder
+
+import (
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/pipelinehelper"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SalesOrderView is a sales order as the screens show it, with the project,
+// customer and aircon names in place of their IDs
+type SalesOrderView struct {
+	ID           primitive.ObjectID   `bson:"_id" json:"id"`
+	SalesOrderID string               `bson:"salesOrderId" json:"salesOrderId"`
+	ProjectName  string               `bson:"projectName" json:"projectName"`
+	CustomerName string               `bson:"customerName" json:"customerName"`
+	Items        []SalesOrderViewItem `bson:"items" json:"items"`
+	TotalAmount  float64              `bson:"totalAmount" json:"totalAmount"`
+	CreatedBy    primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	CreatedAt    time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time            `bson:"updatedAt" json:"updatedAt"`
+	Status       string               `bson:"status" json:"status"`
+	Version      int64                `bson:"version" json:"version"`
+}
+
+type SalesOrderViewItem struct {
+	AirconName string  `bson:"airconName" json:"airconName"`
+	Qty        int     `bson:"qty" json:"qty"`
+	UOM        string  `bson:"uom" json:"uom"`
+	Price      float64 `bson:"price" json:"price"`
+	Subtotal   float64 `bson:"subtotal" json:"subtotal"`
+}
+
+// ViewStages turn sales orders into SalesOrderViews. Each lookup fetches only
+// the name it needs, and all the aircons of an order come back in one lookup.
+// Run them after the page is selected so they only touch the orders returned.
+func ViewStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "project",
+			"localField":   "projectId",
+			"foreignField": "_id",
+			"as":           "project",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "customer",
+			"localField":   "customerId",
+			"foreignField": "_id",
+			"as":           "customer",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "aircon",
+			"localField":   "items.airconId",
+			"foreignField": "_id",
+			"as":           "aircons",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"salesOrderId": 1,
+			"totalAmount":  1,
+			"createdBy":    1,
+			"createdAt":    1,
+			"updatedAt":    1,
+			"status":       1,
+			"version":      1,
+			"projectName":  pipelinehelper.First("$project.project_name"),
+			"customerName": pipelinehelper.First("$customer.customername"),
+			"items": bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$items", bson.A{}}},
+				"as":    "item",
+				"in": bson.M{
+					"airconName": bson.M{"$let": bson.M{
+						"vars": bson.M{"aircon": bson.M{"$arrayElemAt": bson.A{
+							bson.M{"$filter": bson.M{
+								"input": "$aircons",
+								"as":    "aircon",
+								"cond":  bson.M{"$eq": bson.A{"$$aircon._id", "$$item.airconId"}},
+							}},
+							0,
+						}}},
+						"in": bson.M{"$ifNull": bson.A{"$$aircon.name", ""}},
+					}},
+					"qty":      "$$item.qty",
+					"uom":      "$$item.uom",
+					"price":    "$$item.price",
+					"subtotal": "$$item.subtotal",
+				},
+			}},
+		}}},
+	}
+}
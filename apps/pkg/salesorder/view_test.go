@@ -0,0 +1,122 @@
+package salesorder
+
+import (
+	"context"
+	"testing"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/mongotest"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BenchmarkSalesOrderViews times the sales order listing as an aggregation
+// against the per-document lookups it replaced, after checking that both
+// return the same rows
+func BenchmarkSalesOrderViews(b *testing.B) {
+	db := mongotest.Open(b)
+	seeded := mongotest.Seed(b, db, 2000, 5)
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		filter bson.M
+		limit  int64
+	}{
+		{"page", bson.M{}, 100},
+		{"by-id", bson.M{"_id": seeded.FirstOrder}, 1},
+	}
+	for _, bc := range cases {
+		b.Run(bc.name, func(b *testing.B) {
+			want, err := viewsPerDocument(ctx, db, bc.filter, bc.limit)
+			if err != nil {
+				b.Fatal(err)
+			}
+			got, err := viewsAggregated(ctx, db, bc.filter, bc.limit)
+			if err != nil {
+				b.Fatal(err)
+			}
+			mongotest.SameRows(b, want, got)
+
+			b.Run("per-document", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := viewsPerDocument(ctx, db, bc.filter, bc.limit); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("aggregation", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := viewsAggregated(ctx, db, bc.filter, bc.limit); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// viewsAggregated lists sales orders the way the API does
+func viewsAggregated(ctx context.Context, db *mongo.Database, filter bson.M, limit int64) ([]SalesOrderView, error) {
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: trash.Live(filter)}},
+		{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	}, ViewStages()...)
+	cursor, err := db.Collection("salesorder").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var views []SalesOrderView
+	err = cursor.All(ctx, &views)
+	return views, err
+}
+
+// viewsPerDocument is the sales order listing before it was an aggregation:
+// one query for the page, then one per project, customer and line item
+func viewsPerDocument(ctx context.Context, db *mongo.Database, filter bson.M, limit int64) ([]SalesOrderView, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit)
+	cursor, err := db.Collection("salesorder").Find(ctx, trash.Live(filter), opts)
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.SalesOrder
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	var views []SalesOrderView
+	for _, order := range orders {
+		var project models.Project
+		var customer models.Customer
+		_ = db.Collection("project").FindOne(ctx, bson.M{"_id": order.ProjectID}).Decode(&project)
+		_ = db.Collection("customer").FindOne(ctx, bson.M{"_id": order.CustomerID}).Decode(&customer)
+
+		view := SalesOrderView{
+			ID:           order.ID,
+			SalesOrderID: order.SalesOrderID,
+			ProjectName:  project.ProjectName,
+			CustomerName: customer.CustomerName,
+			Items:        []SalesOrderViewItem{},
+			TotalAmount:  order.TotalAmount,
+			CreatedBy:    order.CreatedBy,
+			CreatedAt:    order.CreatedAt,
+			UpdatedAt:    order.UpdatedAt,
+			Status:       order.Status,
+			Version:      order.Version,
+		}
+		for _, item := range order.Items {
+			var aircon models.Aircon
+			_ = db.Collection("aircon").FindOne(ctx, bson.M{"_id": item.AirconID}).Decode(&aircon)
+			view.Items = append(view.Items, SalesOrderViewItem{
+				AirconName: aircon.Name, Qty: item.Qty, UOM: item.UOM, Price: item.Price, Subtotal: item.Subtotal,
+			})
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
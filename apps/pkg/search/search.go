@@ -0,0 +1,312 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Global search runs one text query against every kind of record the caller
+// may view and ranks the hits together. Each collection has a single text
+// index, created by the migrations, that decides which fields match and how
+// much each counts. Searching a new collection or field takes a migration.
+
+const (
+	defaultLimit = 20
+	maxLimit     = 50
+	minQuery     = 2
+	maxQuery     = 100
+)
+
+// Source is one kind of record search covers
+type Source struct {
+	Type       string
+	Collection string
+	// Resource is the permission resource; callers need its view right
+	Resource string
+	// Title and Subtitle are the fields shown for a hit
+	Title    string
+	Subtitle []string
+	// Link is the path that reads the record, below the API version prefix
+	Link func(doc bson.M) string
+}
+
+// Sources lists everything search covers
+var Sources = []Source{
+	{
+		Type: "customer", Collection: "customer", Resource: permission.ResourceCustomer,
+		Title:    "customername",
+		Subtitle: []string{"customerid", "tinnumber"},
+		Link:     byField("/customer/get-all-customer?filter[customerid]=", "customerid"),
+	},
+	{
+		Type: "project", Collection: "project", Resource: permission.ResourceProject,
+		Title:    "project_name",
+		Subtitle: []string{"project_id"},
+		Link:     byID("/project/get-project-by/"),
+	},
+	{
+		Type: "salesorder", Collection: "salesorder", Resource: permission.ResourceSalesOrder,
+		Title:    "salesOrderId",
+		Subtitle: []string{"status"},
+		Link:     byID("/salesorder/get-sales-order-by-id/"),
+	},
+	{
+		Type: "supplierpo", Collection: "supplier_purchase_orders", Resource: permission.ResourceSupplierPO,
+		Title:    "poId",
+		Subtitle: []string{"status"},
+		Link:     byID("/supplierpo/get-po-by/"),
+	},
+	{
+		Type: "supplier", Collection: "supplier", Resource: permission.ResourceSupplier,
+		Title:    "supplier_name",
+		Subtitle: []string{"supplier_code", "tin_number"},
+		Link:     byID("/supplier/get-supplier-by-id/"),
+	},
+	{
+		Type: "salesinvoice", Collection: "sales_invoices", Resource: permission.ResourceSalesInvoice,
+		Title: "invoice_id",
+		Link:  byID("/sales-invoice/get-sales-invoice-by-id/"),
+	},
+	{
+		Type: "deliveryreceipt", Collection: "delivery_receipts", Resource: permission.ResourceDeliveryReceipt,
+		Title:    "dr_number",
+		Subtitle: []string{"customer_name", "status"},
+		Link:     byID("/delivery-receipt/get-delivery-receipt-by-id/"),
+	},
+	{
+		Type: "supplierinvoice", Collection: "supplierinvoice", Resource: permission.ResourceSupplierInvoice,
+		Title:    "invoice_no",
+		Subtitle: []string{"purchase_order_no"},
+		Link:     byID("/supplier/invoice-get-by-id/"),
+	},
+	{
+		Type: "supplierdr", Collection: "supplierdeliveryreceipt", Resource: permission.ResourceSupplierDR,
+		Title:    "supplier_dr_no",
+		Subtitle: []string{"your_po_no"},
+		Link:     byID("/supplier/dr-get-by-id/"),
+	},
+	{
+		Type: "inventory", Collection: "polaris_inventory", Resource: permission.ResourceInventory,
+		Title:    "aircon_name",
+		Subtitle: []string{"sku", "aircon_model_number"},
+		Link:     byID("/inventory/get-by/"),
+	},
+	{
+		Type: "receivingreport", Collection: "polaris_receiving_reports", Resource: permission.ResourceReceivingReport,
+		Title:    "aircon_name",
+		Subtitle: []string{"sku", "aircon_model_number"},
+		Link:     byID("/receiving-r/rr-get-by-id/"),
+	},
+}
+
+// Result is one hit
+type Result struct {
+	Type     string             `json:"type"`
+	ID       primitive.ObjectID `json:"id"`
+	Title    string             `json:"title"`
+	Subtitle string             `json:"subtitle,omitempty"`
+	Score    float64            `json:"score"`
+	Link     string             `json:"link"`
+}
+
+// ErrNoIndex means a collection has no text index yet
+var ErrNoIndex = errors.New("search index missing; run the migrations")
+
+// Find searches the sources for input and returns the best hits first.
+// Deleted documents are left out.
+func Find(ctx context.Context, db *mongo.Database, sources []Source, input string, limit int64) ([]Result, error) {
+	query := Text(input)
+	results := []Result{}
+	for _, source := range sources {
+		found, err := source.find(ctx, db, query, limit)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", source.Type, err)
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if int64(len(results)) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Text turns what the user typed into a $text search. A single word with
+// separators, like DR-2025-0001 or 123-456-789, is searched as a phrase so it
+// matches that number and not every document sharing one of its parts.
+func Text(input string) string {
+	input = strings.TrimSpace(input)
+	if !strings.ContainsAny(input, " \t\"") && strings.ContainsAny(input, "-/._") {
+		return `"` + input + `"`
+	}
+	return input
+}
+
+func (s Source) find(ctx context.Context, db *mongo.Database, query string, limit int64) ([]Result, error) {
+	score := bson.M{"$meta": "textScore"}
+	projection := bson.M{"score": score, s.Title: 1}
+	for _, field := range s.Subtitle {
+		projection[field] = 1
+	}
+	opts := options.Find().
+		SetProjection(projection).
+		SetSort(bson.D{{Key: "score", Value: score}}).
+		SetLimit(limit)
+
+	cursor, err := db.Collection(s.Collection).Find(ctx, bson.M{
+		"$text":      bson.M{"$search": query},
+		"deleted_at": nil,
+	}, opts)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == indexNotFound {
+			return nil, ErrNoIndex
+		}
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []Result
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		id, _ := doc["_id"].(primitive.ObjectID)
+		scored, _ := doc["score"].(float64)
+
+		var subtitle []string
+		for _, field := range s.Subtitle {
+			if v := text(doc[field]); v != "" {
+				subtitle = append(subtitle, v)
+			}
+		}
+		results = append(results, Result{
+			Type:     s.Type,
+			ID:       id,
+			Title:    text(doc[s.Title]),
+			Subtitle: strings.Join(subtitle, " · "),
+			Score:    scored,
+			Link:     s.Link(doc),
+		})
+	}
+	return results, cursor.Err()
+}
+
+// Server error code for a $text query on a collection without a text index
+const indexNotFound = 27
+
+func text(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func byID(path string) func(bson.M) string {
+	return func(doc bson.M) string {
+		id, _ := doc["_id"].(primitive.ObjectID)
+		return path + id.Hex()
+	}
+}
+
+func byField(path, field string) func(bson.M) string {
+	return func(doc bson.M) string {
+		return path + url.QueryEscape(text(doc[field]))
+	}
+}
+
+// Search answers GET /search?q=...&type=customer,salesorder&limit=20 with the
+// best hits across the records the caller may view
+func Search(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	value, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	user, ok := value.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if len(q) < minQuery || len(q) > maxQuery {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must be %d to %d characters", minQuery, maxQuery)})
+		return
+	}
+	limit := int64(defaultLimit)
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	wanted := map[string]bool{}
+	if types := c.Query("type"); types != "" {
+		known := map[string]bool{}
+		for _, source := range Sources {
+			known[source.Type] = true
+		}
+		for _, t := range strings.Split(types, ",") {
+			t = strings.TrimSpace(t)
+			if !known[t] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown type %q", t)})
+				return
+			}
+			wanted[t] = true
+		}
+	}
+
+	var sources []Source
+	for _, source := range Sources {
+		if len(wanted) > 0 && !wanted[source.Type] {
+			continue
+		}
+		allowed, err := permission.Allowed(c, db, user, source.Resource, permission.ActionView)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if allowed {
+			sources = append(sources, source)
+		}
+	}
+
+	results, err := Find(c, db, sources, q, limit)
+	if errors.Is(err, ErrNoIndex) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Search is not available yet", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed", "details": err.Error()})
+		return
+	}
+	prefix := "/" + strings.Trim(cfg.Server.APIVersion, "/")
+	for i := range results {
+		results[i].Link = prefix + results[i].Link
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": q, "results": results, "total": len(results)})
+}
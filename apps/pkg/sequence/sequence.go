@@ -0,0 +1,226 @@
+package sequence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Document types with a numbered sequence
+const (
+	Customer        = "customer"
+	Project         = "project"
+	SalesOrder      = "salesorder"
+	SalesInvoice    = "salesinvoice"
+	DeliveryReceipt = "deliveryreceipt"
+	SupplierPO      = "supplierpo"
+)
+
+// Document describes where a sequence's numbers are stored and how they look
+// unless env.yaml overrides the format
+type Document struct {
+	Collection string
+	Field      string
+	Prefix     string
+	Padding    int
+}
+
+// Documents lists every numbered document type. Numbers look like
+// SO-2025-00001 by default, matching what the app issued before.
+var Documents = map[string]Document{
+	Customer:        {Collection: "customer", Field: "customerid", Prefix: "CUST", Padding: 5},
+	Project:         {Collection: "project", Field: "project_id", Prefix: "PRJ", Padding: 4},
+	SalesOrder:      {Collection: "salesorder", Field: "salesOrderId", Prefix: "SO", Padding: 5},
+	SalesInvoice:    {Collection: "sales_invoices", Field: "invoice_id", Prefix: "INV", Padding: 5},
+	DeliveryReceipt: {Collection: "delivery_receipts", Field: "dr_number", Prefix: "DR", Padding: 5},
+	SupplierPO:      {Collection: "supplier_purchase_orders", Field: "poId", Prefix: "PO", Padding: 5},
+}
+
+const separator = "-"
+
+type format struct {
+	prefix      string
+	branch      string
+	padding     int
+	includeYear bool
+	resetYearly bool
+}
+
+func resolve(cfg config.Config, docType string) (Document, format, error) {
+	doc, ok := Documents[docType]
+	if !ok {
+		return Document{}, format{}, fmt.Errorf("unknown document type %q", docType)
+	}
+
+	f := format{
+		prefix:      doc.Prefix,
+		padding:     doc.Padding,
+		includeYear: true,
+		resetYearly: true,
+	}
+
+	override, ok := cfg.Sequences[docType]
+	if !ok {
+		return doc, f, nil
+	}
+	if override.Prefix != "" {
+		f.prefix = override.Prefix
+	}
+	if override.Padding > 0 {
+		f.padding = override.Padding
+	}
+	if override.IncludeYear != nil {
+		f.includeYear = *override.IncludeYear
+	}
+	if override.ResetYearly != nil {
+		f.resetYearly = *override.ResetYearly
+	}
+	f.branch = override.Branch
+	return doc, f, nil
+}
+
+// stem is the number without its running count, e.g. "SO-2025-"
+func (f format) stem(year int) string {
+	var parts []string
+	if f.prefix != "" {
+		parts = append(parts, f.prefix)
+	}
+	if f.branch != "" {
+		parts = append(parts, f.branch)
+	}
+	if f.includeYear {
+		parts = append(parts, strconv.Itoa(year))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, separator) + separator
+}
+
+func (f format) key(docType string, year int) string {
+	key := docType
+	if f.branch != "" {
+		key += ":" + f.branch
+	}
+	if f.resetYearly {
+		key += ":" + strconv.Itoa(year)
+	}
+	return key
+}
+
+// Next issues the next number for a document type. The counter is bumped
+// with a single atomic $inc, so concurrent callers never get the same number
+// and deleting a document never frees its number for reuse.
+func Next(ctx context.Context, db *mongo.Database, cfg config.Config, docType string) (string, error) {
+	doc, f, err := resolve(cfg, docType)
+	if err != nil {
+		return "", err
+	}
+
+	// The year in the number follows the business timezone, not the server's
+	year := time.Now().In(cfg.Location()).Year()
+	key := f.key(docType, year)
+	stem := f.stem(year)
+
+	value, err := increment(ctx, db, key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// First number of this sequence: start after any number already
+		// issued, e.g. by the count based generator this replaces
+		if err := start(ctx, db, key, docType, f, year, doc, stem); err != nil {
+			return "", err
+		}
+		value, err = increment(ctx, db, key)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%0*d", stem, f.padding, value), nil
+}
+
+func increment(ctx context.Context, db *mongo.Database, key string) (int64, error) {
+	var counter models.Counter
+	err := db.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc": bson.M{"value": 1},
+			"$set": bson.M{"updatedAt": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Value, err
+}
+
+// start creates a counter at the highest number already stored. When two
+// requests race here, one insert wins and the other sees a duplicate key.
+func start(ctx context.Context, db *mongo.Database, key, docType string, f format, year int, doc Document, stem string) error {
+	last, err := highest(ctx, db, doc, stem)
+	if err != nil {
+		return err
+	}
+
+	counter := models.Counter{
+		ID:        key,
+		DocType:   docType,
+		Branch:    f.branch,
+		Value:     last,
+		UpdatedAt: time.Now(),
+	}
+	if f.resetYearly {
+		counter.Year = year
+	}
+
+	_, err = db.Collection("counters").InsertOne(ctx, counter)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// highest finds the largest running number already used with this stem
+func highest(ctx context.Context, db *mongo.Database, doc Document, stem string) (int64, error) {
+	pattern := "^" + regexp.QuoteMeta(stem) + `(\d+)$`
+	cursor, err := db.Collection(doc.Collection).Find(ctx,
+		bson.M{doc.Field: bson.M{"$regex": pattern}},
+		options.Find().SetProjection(bson.M{doc.Field: 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	re := regexp.MustCompile(pattern)
+	var last int64
+	for cursor.Next(ctx) {
+		number, _ := cursor.Current.Lookup(doc.Field).StringValueOK()
+		m := re.FindStringSubmatch(number)
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.ParseInt(m[1], 10, 64); err == nil && n > last {
+			last = n
+		}
+	}
+	return last, cursor.Err()
+}
+
+// NumberIndex is the unique index on a document type's number field.
+// Documents without a number are left out of it.
+func NumberIndex(doc Document) mongo.IndexModel {
+	return mongo.IndexModel{
+		Keys: bson.D{{Key: doc.Field, Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{doc.Field: bson.M{"$type": "string"}}),
+	}
+}
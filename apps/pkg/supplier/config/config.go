@@ -15,4 +15,5 @@ type EditSupplier struct {
 	TINNumber    string `json:"tin_number"`
 	Organization string `json:"organization"`
 	Location     string `json:"location"`
+	Version      *int64 `json:"version"`
 }
@@ -5,8 +5,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplier/config"
+	supplierconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplier/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -24,7 +30,11 @@ func CreateSupplier(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.SupplierData
+	if !permission.Authorize(c, db, permission.ResourceSupplier, permission.ActionCreate) {
+		return
+	}
+
+	var payload supplierconfig.SupplierData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -41,15 +51,33 @@ func CreateSupplier(c *gin.Context, db *mongo.Database) {
 	}
 
 	collection := db.Collection("supplier")
-	_, err := collection.InsertOne(c, supplier)
+	res, err := collection.InsertOne(c, supplier)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier"})
 		return
 	}
+	audit.Created(c, db, "supplier", res.InsertedID.(primitive.ObjectID))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Supplier created"})
 }
 
+// supplierList is how suppliers can be listed. Pages default to the
+// maximum because forms load the whole list for their pickers, following
+// nextCursor until the last page.
+var supplierList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"supplier_code": {Sort: true},
+		"supplier_name": {Sort: true},
+		"organization":  {Sort: true},
+		"location":      {},
+		"tin_number":    {},
+		"created_at":    {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"supplier_code", "supplier_name", "organization", "location"},
+	Sort:   "-created_at",
+	Limit:  listquery.MaxLimit,
+}
+
 func GetAllSuppliers(c *gin.Context, db *mongo.Database) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -61,16 +89,25 @@ func GetAllSuppliers(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
-	collection := db.Collection("supplier")
-	cursor, err := collection.Find(c, bson.M{})
+
+	if !permission.Authorize(c, db, permission.ResourceSupplier, permission.ActionLookup) {
+		return
+	}
+	query, ok := listquery.Parse(c, supplierList)
+	if !ok {
+		return
+	}
+
+	var list []models.Supplier
+	page, err := query.Run(c, db.Collection("supplier"), &list)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers"})
 		return
 	}
-	var list []models.Supplier
-	cursor.All(c, &list)
 
-	c.JSON(http.StatusOK, gin.H{"suppliers": list})
+	body := listquery.Envelope(list, page)
+	body["suppliers"] = body["data"] // older clients read this key
+	c.JSON(http.StatusOK, body)
 }
 
 func GetSupplierByID(c *gin.Context, db *mongo.Database) {
@@ -84,6 +121,10 @@ func GetSupplierByID(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplier, permission.ActionView) {
+		return
+	}
 	id := c.Param("id")
 
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -93,12 +134,13 @@ func GetSupplierByID(c *gin.Context, db *mongo.Database) {
 	}
 
 	var supplier models.Supplier
-	err = db.Collection("supplier").FindOne(c, bson.M{"_id": objID}).Decode(&supplier)
+	err = db.Collection("supplier").FindOne(c, trash.Live(bson.M{"_id": objID})).Decode(&supplier)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
 		return
 	}
 
+	version.SetETag(c, supplier.Version)
 	c.JSON(http.StatusOK, gin.H{"supplier": supplier})
 }
 
@@ -113,7 +155,11 @@ func EditSupplier(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
-	var payload config.EditSupplier
+
+	if !permission.Authorize(c, db, permission.ResourceSupplier, permission.ActionEdit) {
+		return
+	}
+	var payload supplierconfig.EditSupplier
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -121,6 +167,11 @@ func EditSupplier(c *gin.Context, db *mongo.Database) {
 
 	objID, _ := primitive.ObjectIDFromHex(payload.ID)
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	update := bson.M{
 		"$set": bson.M{
 			"supplier_code": payload.SupplierCode,
@@ -131,26 +182,37 @@ func EditSupplier(c *gin.Context, db *mongo.Database) {
 		},
 	}
 
-	_, err := db.Collection("supplier").UpdateOne(c, bson.M{"_id": objID}, update)
+	before := audit.Snapshot(c, db, "supplier", objID)
+	res, err := db.Collection("supplier").UpdateOne(c, version.Filter(objID, expected), version.Bump(update))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update supplier"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		version.Conflict(c, db, "supplier", objID, "Supplier not found")
+		return
+	}
+	audit.Updated(c, db, "supplier", objID, before)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Supplier updated"})
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier updated", "version": expected + 1})
 }
 
-func DeleteSupplier(c *gin.Context, db *mongo.Database) {
+func DeleteSupplier(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplier, permission.ActionDelete) {
+		return
+	}
 	var payload struct {
 		ID string `json:"id"`
 	}
@@ -158,11 +220,16 @@ func DeleteSupplier(c *gin.Context, db *mongo.Database) {
 
 	objID, _ := primitive.ObjectIDFromHex(payload.ID)
 
-	_, err := db.Collection("supplier").DeleteOne(c, bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "supplier", objID)
+	_, err := trash.Delete(c, db, cfg, "supplier", objID, userObj.ID)
+	if trash.Blocked(c, "Supplier", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete supplier"})
 		return
 	}
+	audit.Changed(c, db, "supplier", objID, audit.ActionDelete, before)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Supplier deleted"})
 }
@@ -36,4 +36,5 @@ type EditSupplierDR struct {
 	Reference    string           `json:"reference"`
 	Date         string           `json:"date"`
 	Items        []SupplierDRItem `json:"items"`
+	Version      *int64           `json:"version"`
 }
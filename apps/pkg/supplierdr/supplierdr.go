@@ -2,12 +2,17 @@ package supplierdr
 
 import (
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierdr/config"
+	supplierdrconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierdr/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -25,7 +30,11 @@ func CreateSupplierDR(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.SupplierDRData
+	if !permission.Authorize(c, db, permission.ResourceSupplierDR, permission.ActionCreate) {
+		return
+	}
+
+	var payload supplierdrconfig.SupplierDRData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -78,15 +87,30 @@ func CreateSupplierDR(c *gin.Context, db *mongo.Database) {
 		CreatedAt:    time.Now(),
 	}
 
-	_, err = db.Collection("supplierdeliveryreceipt").InsertOne(c, dr)
+	res, err := db.Collection("supplierdeliveryreceipt").InsertOne(c, dr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create supplier DR"})
 		return
 	}
+	audit.Created(c, db, "supplierdeliveryreceipt", res.InsertedID.(primitive.ObjectID))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Supplier Delivery Receipt created"})
 }
 
+var supplierDRList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"supplier_dr_no": {Sort: true},
+		"your_po_no":     {},
+		"supplier":       {Path: "supplier_id", Kind: listquery.ObjectID},
+		"project":        {Path: "project_id", Kind: listquery.ObjectID},
+		"dispatch_date":  {Kind: listquery.Date, Sort: true},
+		"date":           {Kind: listquery.Date, Sort: true},
+		"created_at":     {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"supplier_dr_no", "your_po_no", "reference", "ship_to"},
+	Sort:   "-created_at",
+}
+
 func GetAllSupplierDR(c *gin.Context, db *mongo.Database) {
 
 	user, exists := c.Get("user")
@@ -99,27 +123,18 @@ func GetAllSupplierDR(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// 🔹 Pagination
-	page := int64(1)
-	limit := int64(10)
-
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
-	}
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
-			limit = v
-		}
+	if !permission.Authorize(c, db, permission.ResourceSupplierDR, permission.ActionView) {
+		return
 	}
 
-	skip := (page - 1) * limit
+	query, ok := listquery.Parse(c, supplierDRList)
+	if !ok {
+		return
+	}
 
 	collection := db.Collection("supplierdeliveryreceipt")
 
-	pipeline := mongo.Pipeline{
-
+	shape := mongo.Pipeline{
 		bson.D{{Key: "$lookup", Value: bson.M{
 			"from":         "project",
 			"localField":   "project_id",
@@ -132,65 +147,33 @@ func GetAllSupplierDR(c *gin.Context, db *mongo.Database) {
 			"preserveNullAndEmptyArrays": true,
 		}}},
 
-		bson.D{{Key: "$facet", Value: bson.M{
-			"data": bson.A{
-				bson.M{"$sort": bson.M{"created_at": -1}},
-				bson.M{"$skip": skip},
-				bson.M{"$limit": limit},
-
-				bson.M{"$project": bson.M{
-					"_id":            1,
-					"supplier_id":    1,
-					"project_id":     1,
-					"supplier_dr_no": 1,
-					"your_po_no":     1,
-					"dispatch_date":  1,
-					"ship_to":        1,
-					"reference":      1,
-					"date":           1,
-					"items":          1,
-					"received_by":    1,
-					"created_at":     1,
-
-					"project_name": "$project.project_name",
-				}},
-			},
-			"total": bson.A{
-				bson.M{"$count": "count"},
-			},
+		bson.D{{Key: "$project", Value: bson.M{
+			"_id":            1,
+			"supplier_id":    1,
+			"project_id":     1,
+			"supplier_dr_no": 1,
+			"your_po_no":     1,
+			"dispatch_date":  1,
+			"ship_to":        1,
+			"reference":      1,
+			"date":           1,
+			"items":          1,
+			"received_by":    1,
+			"created_at":     1,
+			"version":        1,
+
+			"project_name": "$project.project_name",
 		}}},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var result []bson.M
+	page, err := query.Run(c, collection, &result, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch supplier DR"})
 		return
 	}
-	defer cursor.Close(c)
-
-	var result []struct {
-		Data  []bson.M `bson:"data"`
-		Total []struct {
-			Count int64 `bson:"count"`
-		} `bson:"total"`
-	}
-
-	if err := cursor.All(c, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode supplier DR"})
-		return
-	}
-
-	var total int64
-	if len(result) > 0 && len(result[0].Total) > 0 {
-		total = result[0].Total[0].Count
-	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  result[0].Data,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(result, page))
 }
 
 func GetAllSupplierDRWithoutPagination(c *gin.Context, db *mongo.Database) {
@@ -205,9 +188,14 @@ func GetAllSupplierDRWithoutPagination(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSupplierDR, permission.ActionView) {
+		return
+	}
+
 	collection := db.Collection("supplierdeliveryreceipt")
 
 	pipeline := mongo.Pipeline{
+		trash.MatchLive,
 
 		bson.D{{Key: "$lookup", Value: bson.M{
 			"from":         "project",
@@ -238,6 +226,7 @@ func GetAllSupplierDRWithoutPagination(c *gin.Context, db *mongo.Database) {
 			"items":          1,
 			"received_by":    1,
 			"created_at":     1,
+			"version":        1,
 			"project_name":   "$project.project_name",
 		}}},
 	}
@@ -271,6 +260,10 @@ func GetSupplierDRByID(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierDR, permission.ActionView) {
+		return
+	}
 	id := c.Param("id")
 
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -280,12 +273,13 @@ func GetSupplierDRByID(c *gin.Context, db *mongo.Database) {
 	}
 
 	var dr models.SupplierDeliveryReceipt
-	err = db.Collection("supplierdeliveryreceipt").FindOne(c, bson.M{"_id": objID}).Decode(&dr)
+	err = db.Collection("supplierdeliveryreceipt").FindOne(c, trash.Live(bson.M{"_id": objID})).Decode(&dr)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "DR not found"})
 		return
 	}
 
+	version.SetETag(c, dr.Version)
 	c.JSON(http.StatusOK, gin.H{"supplierDR": dr})
 }
 
@@ -300,7 +294,11 @@ func EditSupplierDR(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
-	var payload config.EditSupplierDR
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierDR, permission.ActionEdit) {
+		return
+	}
+	var payload supplierdrconfig.EditSupplierDR
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -312,6 +310,11 @@ func EditSupplierDR(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	supplierID, err := primitive.ObjectIDFromHex(payload.SupplierID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
@@ -358,26 +361,37 @@ func EditSupplierDR(c *gin.Context, db *mongo.Database) {
 		},
 	}
 
-	_, err = db.Collection("supplierdeliveryreceipt").UpdateOne(c, bson.M{"_id": objID}, update)
+	before := audit.Snapshot(c, db, "supplierdeliveryreceipt", objID)
+	res, err := db.Collection("supplierdeliveryreceipt").UpdateOne(c, version.Filter(objID, expected), version.Bump(update))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update DR"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		version.Conflict(c, db, "supplierdeliveryreceipt", objID, "DR not found")
+		return
+	}
+	audit.Updated(c, db, "supplierdeliveryreceipt", objID, before)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Supplier DR updated"})
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier DR updated", "version": expected + 1})
 }
 
-func DeleteSupplierDR(c *gin.Context, db *mongo.Database) {
+func DeleteSupplierDR(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierDR, permission.ActionDelete) {
+		return
+	}
 	var payload struct {
 		ID string `json:"id"`
 	}
@@ -385,13 +399,17 @@ func DeleteSupplierDR(c *gin.Context, db *mongo.Database) {
 
 	objID, _ := primitive.ObjectIDFromHex(payload.ID)
 
-	_, err := db.Collection("supplierdeliveryreceipt").
-		DeleteOne(c, bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "supplierdeliveryreceipt", objID)
+	_, err := trash.Delete(c, db, cfg, "supplierdeliveryreceipt", objID, userObj.ID)
+	if trash.Blocked(c, "Supplier DR", err) {
+		return
+	}
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete DR"})
 		return
 	}
+	audit.Changed(c, db, "supplierdeliveryreceipt", objID, audit.ActionDelete, before)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Supplier DR deleted"})
 }
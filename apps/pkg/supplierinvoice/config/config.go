@@ -37,4 +37,5 @@ type EditSupplierInvoice struct {
 	TotalSales      float64               `json:"total_sales"`
 	VAT             float64               `json:"vat"`
 	GrandTotal      float64               `json:"grand_total"`
+	Version         *int64                `json:"version"`
 }
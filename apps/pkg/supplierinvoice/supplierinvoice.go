@@ -2,12 +2,18 @@ package supplierinvoice
 
 import (
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierinvoice/config"
+	supplierinvoiceconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierinvoice/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -25,7 +31,11 @@ func CreateSupplierInvoice(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	var payload config.SupplierInvoiceData
+	if !permission.Authorize(c, db, permission.ResourceSupplierInvoice, permission.ActionCreate) {
+		return
+	}
+
+	var payload supplierinvoiceconfig.SupplierInvoiceData
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -74,15 +84,33 @@ func CreateSupplierInvoice(c *gin.Context, db *mongo.Database) {
 	}
 
 	collection := db.Collection("supplierinvoice")
-	_, err = collection.InsertOne(c, invoice)
+	res, err := collection.InsertOne(c, invoice)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invoice"})
 		return
 	}
+	audit.Created(c, db, "supplierinvoice", res.InsertedID.(primitive.ObjectID))
+	metrics.InvoicesCreated.Inc("supplier")
 
 	c.JSON(http.StatusOK, gin.H{"message": "Supplier Invoice created"})
 }
 
+var supplierInvoiceList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"invoice_no":        {Sort: true},
+		"purchase_order_no": {},
+		"delivery_no":       {},
+		"supplier":          {Path: "supplier_id", Kind: listquery.ObjectID},
+		"project":           {Path: "project_id", Kind: listquery.ObjectID},
+		"invoice_date":      {Kind: listquery.Date, Sort: true},
+		"due_date":          {Kind: listquery.Date, Sort: true},
+		"grand_total":       {Kind: listquery.Number, Sort: true},
+		"created_at":        {Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"invoice_no", "purchase_order_no", "delivery_no", "items.description"},
+	Sort:   "-created_at",
+}
+
 func GetAllSupplierInvoices(c *gin.Context, db *mongo.Database) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -94,26 +122,18 @@ func GetAllSupplierInvoices(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
-	page := int64(1)
-	limit := int64(10)
 
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
+	if !permission.Authorize(c, db, permission.ResourceSupplierInvoice, permission.ActionView) {
+		return
 	}
-	if l := c.Query("limit"); l != "" {
-		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
-			limit = v
-		}
+	query, ok := listquery.Parse(c, supplierInvoiceList)
+	if !ok {
+		return
 	}
 
-	skip := (page - 1) * limit
-
 	collection := db.Collection("supplierinvoice")
 
-	pipeline := mongo.Pipeline{
-
+	shape := mongo.Pipeline{
 		// 🔹 Join Project
 		bson.D{{Key: "$lookup", Value: bson.M{
 			"from":         "project",
@@ -127,68 +147,36 @@ func GetAllSupplierInvoices(c *gin.Context, db *mongo.Database) {
 			"preserveNullAndEmptyArrays": true,
 		}}},
 
-		bson.D{{Key: "$facet", Value: bson.M{
-			"data": bson.A{
-				bson.M{"$sort": bson.M{"created_at": -1}},
-				bson.M{"$skip": skip},
-				bson.M{"$limit": limit},
-
-				bson.M{"$project": bson.M{
-					"_id":               1,
-					"supplier_id":       1,
-					"project_id":        1,
-					"invoice_no":        1,
-					"invoice_date":      1,
-					"delivery_no":       1,
-					"purchase_order_no": 1,
-					"due_date":          1,
-					"delivery_address":  1,
-					"items":             1,
-					"total_sales":       1,
-					"vat":               1,
-					"grand_total":       1,
-					"created_at":        1,
-					"created_by":        1,
-
-					"project_name": "$project.project_name",
-				}},
-			},
-			"total": bson.A{
-				bson.M{"$count": "count"},
-			},
+		bson.D{{Key: "$project", Value: bson.M{
+			"_id":               1,
+			"supplier_id":       1,
+			"project_id":        1,
+			"invoice_no":        1,
+			"invoice_date":      1,
+			"delivery_no":       1,
+			"purchase_order_no": 1,
+			"due_date":          1,
+			"delivery_address":  1,
+			"items":             1,
+			"total_sales":       1,
+			"vat":               1,
+			"grand_total":       1,
+			"created_at":        1,
+			"created_by":        1,
+			"version":           1,
+
+			"project_name": "$project.project_name",
 		}}},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var result []bson.M
+	page, err := query.Run(c, collection, &result, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invoices"})
 		return
 	}
-	defer cursor.Close(c)
-
-	var result []struct {
-		Data  []bson.M `bson:"data"`
-		Total []struct {
-			Count int64 `bson:"count"`
-		} `bson:"total"`
-	}
-
-	if err := cursor.All(c, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode invoices"})
-		return
-	}
-
-	var total int64
-	if len(result) > 0 && len(result[0].Total) > 0 {
-		total = result[0].Total[0].Count
-	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  result[0].Data,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(result, page))
 }
 
 func GetAllSupplierInvoicesWithoutPagination(c *gin.Context, db *mongo.Database) {
@@ -204,9 +192,14 @@ func GetAllSupplierInvoicesWithoutPagination(c *gin.Context, db *mongo.Database)
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSupplierInvoice, permission.ActionView) {
+		return
+	}
+
 	collection := db.Collection("supplierinvoice")
 
 	pipeline := mongo.Pipeline{
+		trash.MatchLive,
 
 		// 🔹 Join Project
 		bson.D{{Key: "$lookup", Value: bson.M{
@@ -244,6 +237,7 @@ func GetAllSupplierInvoicesWithoutPagination(c *gin.Context, db *mongo.Database)
 			"grand_total":       1,
 			"created_at":        1,
 			"created_by":        1,
+			"version":           1,
 
 			"project_name": "$project.project_name",
 		}}},
@@ -280,6 +274,10 @@ func GetSupplierInvoiceByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSupplierInvoice, permission.ActionView) {
+		return
+	}
+
 	id := c.Param("id")
 
 	objID, err := primitive.ObjectIDFromHex(id)
@@ -291,12 +289,13 @@ func GetSupplierInvoiceByID(c *gin.Context, db *mongo.Database) {
 	var invoice models.SupplierInvoice
 	collection := db.Collection("supplierinvoice")
 
-	err = collection.FindOne(c, bson.M{"_id": objID}).Decode(&invoice)
+	err = collection.FindOne(c, trash.Live(bson.M{"_id": objID})).Decode(&invoice)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
 		return
 	}
 
+	version.SetETag(c, invoice.Version)
 	c.JSON(http.StatusOK, gin.H{"invoice": invoice})
 }
 
@@ -311,7 +310,11 @@ func EditSupplierInvoice(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
-	var payload config.EditSupplierInvoice
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierInvoice, permission.ActionEdit) {
+		return
+	}
+	var payload supplierinvoiceconfig.EditSupplierInvoice
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
 		return
@@ -320,6 +323,11 @@ func EditSupplierInvoice(c *gin.Context, db *mongo.Database) {
 	objID, _ := primitive.ObjectIDFromHex(payload.ID)
 	supplierID, _ := primitive.ObjectIDFromHex(payload.SupplierID)
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	projectID, err := primitive.ObjectIDFromHex(payload.ProjectID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
@@ -358,26 +366,37 @@ func EditSupplierInvoice(c *gin.Context, db *mongo.Database) {
 	}
 	collection := db.Collection("supplierinvoice")
 
-	_, err = collection.UpdateOne(c, bson.M{"_id": objID}, update)
+	before := audit.Snapshot(c, db, "supplierinvoice", objID)
+	res, err := collection.UpdateOne(c, version.Filter(objID, expected), version.Bump(update))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update invoice"})
 		return
 	}
+	if res.MatchedCount == 0 {
+		version.Conflict(c, db, "supplierinvoice", objID, "Invoice not found")
+		return
+	}
+	audit.Updated(c, db, "supplierinvoice", objID, before)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Supplier Invoice updated"})
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier Invoice updated", "version": expected + 1})
 }
 
-func DeleteSupplierInvoice(c *gin.Context, db *mongo.Database) {
+func DeleteSupplierInvoice(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierInvoice, permission.ActionDelete) {
+		return
+	}
 	var payload struct {
 		ID string `json:"id"`
 	}
@@ -385,11 +404,16 @@ func DeleteSupplierInvoice(c *gin.Context, db *mongo.Database) {
 
 	objID, _ := primitive.ObjectIDFromHex(payload.ID)
 
-	_, err := db.Collection("supplierinvoice").DeleteOne(c, bson.M{"_id": objID})
+	before := audit.Snapshot(c, db, "supplierinvoice", objID)
+	_, err := trash.Delete(c, db, cfg, "supplierinvoice", objID, userObj.ID)
+	if trash.Blocked(c, "Invoice", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invoice"})
 		return
 	}
+	audit.Changed(c, db, "supplierinvoice", objID, audit.ActionDelete, before)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Invoice deleted"})
 }
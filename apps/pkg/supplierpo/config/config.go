@@ -12,6 +12,7 @@ type UpdateSupplierPO struct {
 	SupplierPOID string             `json:"supplierPOId" binding:"required"`
 	Items        []SupplierPOItemIn `json:"items" binding:"required"`
 	Status       string             `json:"status" binding:"required"`
+	Version      *int64             `json:"version"`
 }
 
 // SupplierPOItemIn represents an item being added/updated in a Supplier PO
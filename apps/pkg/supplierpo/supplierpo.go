@@ -2,31 +2,44 @@ package supplierpo
 
 import (
 	"net/http"
-	"strconv"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/profile"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/reporthelper"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/listquery"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
-	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierpo/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/sequence"
+	supplierpoconfig "github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierpo/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Add Supplier Purchase Order
-func AddSupplierPO(c *gin.Context, db *mongo.Database) {
+func AddSupplierPO(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
-	var payload config.AddSupplierPO
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionCreate) {
+		return
+	}
+
+	var payload supplierpoconfig.AddSupplierPO
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
 		return
@@ -65,14 +78,21 @@ func AddSupplierPO(c *gin.Context, db *mongo.Database) {
 		})
 	}
 
+	poNumber, err := sequence.Next(c, db, cfg, sequence.SupplierPO)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PO number"})
+		return
+	}
+
 	po := models.SupplierPO{
 		ID:         primitive.NewObjectID(),
-		POID:       "PO-" + time.Now().Format("20060102150405"), // simple & readable
+		POID:       poNumber,
 		ProjectID:  projectID,
 		SupplierID: supplierID,
 		SOID:       soID,
 		Items:      items,
 		Status:     "draft",
+		CreatedBy:  &userObj.ID,
 		CreatedAt:  time.Now(),
 	}
 
@@ -81,6 +101,7 @@ func AddSupplierPO(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Supplier PO", "details": err.Error()})
 		return
 	}
+	audit.Created(c, db, "supplier_purchase_orders", po.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Supplier PO created successfully",
@@ -93,6 +114,7 @@ type SupplierPOResponse struct {
 	POID         string                  `bson:"po_id" json:"po_id"`
 	SalesOrderID string                  `bson:"sales_order_id,omitempty" json:"sales_order_id,omitempty"`
 	Status       string                  `bson:"status" json:"status"`
+	Version      int64                   `bson:"version" json:"version"`
 	CreatedAt    time.Time               `bson:"created_at" json:"created_at"`
 	Items        []models.SupplierPOItem `bson:"items" json:"items"`
 
@@ -107,6 +129,19 @@ type SupplierPOResponse struct {
 	} `bson:"supplier" json:"supplier"`
 }
 
+var supplierPOList = listquery.Spec{
+	Fields: map[string]listquery.Field{
+		"po_id":       {Path: "poId", Sort: true},
+		"status":      {Sort: true},
+		"project":     {Path: "projectId", Kind: listquery.ObjectID},
+		"supplier":    {Path: "supplierId", Kind: listquery.ObjectID},
+		"sales_order": {Path: "soId", Kind: listquery.ObjectID},
+		"created_at":  {Path: "createdAt", Kind: listquery.Date, Sort: true},
+	},
+	Search: []string{"poId", "status"},
+	Sort:   "-created_at",
+}
+
 func GetAllSupplierPO(c *gin.Context, db *mongo.Database) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -118,27 +153,18 @@ func GetAllSupplierPO(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	// Pagination
-	page := int64(1)
-	limit := int64(10)
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionView) {
+		return
+	}
 
-	if p := c.Query("page"); p != "" {
-		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
-			page = v
-		}
+	query, ok := listquery.Parse(c, supplierPOList)
+	if !ok {
+		return
 	}
 
-	skip := (page - 1) * limit
 	collection := db.Collection("supplier_purchase_orders")
 
-	pipeline := mongo.Pipeline{
-		// Sort
-		{{Key: "$sort", Value: bson.M{"createdAt": -1}}},
-
-		// Pagination
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
-
+	shape := mongo.Pipeline{
 		// Lookup Project
 		{{
 			Key: "$lookup",
@@ -192,6 +218,7 @@ func GetAllSupplierPO(c *gin.Context, db *mongo.Database) {
 				"po_id":          "$poId",
 				"sales_order_id": "$salesOrder.salesOrderId",
 				"status":         1,
+				"version":        1,
 				"created_at":     "$createdAt",
 				"items":          1,
 
@@ -208,27 +235,14 @@ func GetAllSupplierPO(c *gin.Context, db *mongo.Database) {
 		}},
 	}
 
-	cursor, err := collection.Aggregate(c, pipeline)
+	var result []SupplierPOResponse
+	page, err := query.Run(c, collection, &result, shape...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Supplier POs"})
 		return
 	}
-	defer cursor.Close(c)
-
-	var result []SupplierPOResponse
-	if err := cursor.All(c, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode Supplier POs"})
-		return
-	}
-
-	total, _ := collection.CountDocuments(c, bson.M{})
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":  result,
-		"page":  page,
-		"limit": limit,
-		"total": total,
-	})
+	c.JSON(http.StatusOK, listquery.Envelope(result, page))
 }
 
 func GetAllSupplierPOinfo(c *gin.Context, db *mongo.Database) {
@@ -243,10 +257,15 @@ func GetAllSupplierPOinfo(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionLookup) {
+		return
+	}
+
 	collection := db.Collection("supplier_purchase_orders")
 
 	// 🔹 Mongo Pipeline (ONLY PO DATA)
 	pipeline := mongo.Pipeline{
+		trash.MatchLive,
 		// Sort latest first
 		{{
 			Key:   "$sort",
@@ -263,6 +282,7 @@ func GetAllSupplierPOinfo(c *gin.Context, db *mongo.Database) {
 				"supplier_id": "$supplierId",
 				"so_id":       "$soId",
 				"status":      1,
+				"version":     1,
 				"items":       1,
 				"created_at":  "$createdAt",
 			},
@@ -304,6 +324,10 @@ func GetSupplierPOByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionView) {
+		return
+	}
+
 	id := c.Param("id")
 
 	poID, err := primitive.ObjectIDFromHex(id)
@@ -315,7 +339,7 @@ func GetSupplierPOByID(c *gin.Context, db *mongo.Database) {
 	collection := db.Collection("supplier_purchase_orders")
 
 	var po models.SupplierPO
-	err = collection.FindOne(c, bson.M{"_id": poID}).Decode(&po)
+	err = collection.FindOne(c, trash.Live(bson.M{"_id": poID})).Decode(&po)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier PO not found"})
@@ -325,6 +349,7 @@ func GetSupplierPOByID(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	version.SetETag(c, po.Version)
 	c.JSON(http.StatusOK, gin.H{"supplierPO": po})
 }
 
@@ -334,13 +359,17 @@ func UpdateSupplierPO(c *gin.Context, db *mongo.Database) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
 
-	var payload config.UpdateSupplierPO
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionEdit) {
+		return
+	}
+
+	var payload supplierpoconfig.UpdateSupplierPO
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
@@ -352,6 +381,11 @@ func UpdateSupplierPO(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
+	expected, ok := version.Expected(c, payload.Version)
+	if !ok {
+		return
+	}
+
 	var items []models.SupplierPOItem
 	for _, item := range payload.Items {
 		items = append(items, models.SupplierPOItem{
@@ -368,39 +402,69 @@ func UpdateSupplierPO(c *gin.Context, db *mongo.Database) {
 		},
 	}
 
+	collection := db.Collection("supplier_purchase_orders")
+
+	var current models.SupplierPO
+	if err := collection.FindOne(c, trash.Live(bson.M{"_id": poID})).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier PO not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Supplier PO"})
+		return
+	}
+
+	// Moving a PO into or out of "approved" requires the approve permission
+	if current.Status != payload.Status && (payload.Status == "approved" || current.Status == "approved") {
+		if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionApprove) {
+			return
+		}
+	}
+
 	// Approval handling
-	if payload.Status == "approved" {
+	if payload.Status == "approved" && current.Status != "approved" {
 		now := time.Now()
 		update["$set"].(bson.M)["approvedAt"] = &now
+		update["$set"].(bson.M)["approvedBy"] = userObj.ID
 	}
 
-	collection := db.Collection("supplier_purchase_orders")
-
-	res, err := collection.UpdateOne(c, bson.M{"_id": poID}, update)
+	before := audit.Snapshot(c, db, "supplier_purchase_orders", poID)
+	res, err := collection.UpdateOne(c, version.Filter(poID, expected), version.Bump(update))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Supplier PO"})
 		return
 	}
 
 	if res.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier PO not found"})
+		version.Conflict(c, db, "supplier_purchase_orders", poID, "Supplier PO not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Supplier PO updated successfully"})
+	action := audit.ActionUpdate
+	if payload.Status == "approved" && current.Status != "approved" {
+		action = audit.ActionApprove
+	}
+	audit.Changed(c, db, "supplier_purchase_orders", poID, action, before)
+
+	version.SetETag(c, expected+1)
+	c.JSON(http.StatusOK, gin.H{"message": "Supplier PO updated successfully", "version": expected + 1})
 }
 
-func DeleteSupplierPO(c *gin.Context, db *mongo.Database) {
+func DeleteSupplierPO(c *gin.Context, db *mongo.Database, cfg config.Config) {
 	user, exists := c.Get("user")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
-	_, ok := user.(*models.User)
+	userObj, ok := user.(*models.User)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
 		return
 	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionDelete) {
+		return
+	}
 	id := c.Param("id")
 
 	poID, err := primitive.ObjectIDFromHex(id)
@@ -409,18 +473,77 @@ func DeleteSupplierPO(c *gin.Context, db *mongo.Database) {
 		return
 	}
 
-	collection := db.Collection("supplier_purchase_orders")
-
-	res, err := collection.DeleteOne(c, bson.M{"_id": poID})
+	before := audit.Snapshot(c, db, "supplier_purchase_orders", poID)
+	deleted, err := trash.Delete(c, db, cfg, "supplier_purchase_orders", poID, userObj.ID)
+	if trash.Blocked(c, "Supplier PO", err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete Supplier PO"})
 		return
 	}
 
-	if res.DeletedCount == 0 {
+	if !deleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier PO not found"})
 		return
 	}
 
+	audit.Changed(c, db, "supplier_purchase_orders", poID, audit.ActionDelete, before)
 	c.JSON(http.StatusOK, gin.H{"message": "Supplier PO deleted successfully"})
 }
+
+// DownloadSupplierPOPDF renders the PO with the preparer and approver names
+func DownloadSupplierPOPDF(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	_, ok := user.(*models.User)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user object"})
+		return
+	}
+
+	if !permission.Authorize(c, db, permission.ResourceSupplierPO, permission.ActionView) {
+		return
+	}
+
+	poID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Supplier PO ID"})
+		return
+	}
+
+	var po models.SupplierPO
+	err = db.Collection("supplier_purchase_orders").FindOne(c, trash.Live(bson.M{"_id": poID})).Decode(&po)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier PO not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Supplier PO"})
+		return
+	}
+
+	var supplier models.Supplier
+	_ = db.Collection("supplier").FindOne(c, bson.M{"_id": po.SupplierID}).Decode(&supplier)
+	var project models.Project
+	_ = db.Collection("project").FindOne(c, bson.M{"_id": po.ProjectID}).Decode(&project)
+
+	signatories := []reporthelper.Signatory{
+		profile.Signatory(c, db, "Prepared by", po.CreatedBy, &po.CreatedAt),
+		profile.Signatory(c, db, "Approved by", po.ApprovedBy, po.ApprovedAt),
+	}
+
+	filePath, err := reporthelper.GenerateSupplierPOPDF(cfg, po, supplier.SupplierName, project.ProjectName, signatories)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+		return
+	}
+	defer os.Remove(filePath)
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", "attachment; filename="+po.POID+".pdf")
+	c.File(filePath)
+}
@@ -0,0 +1,214 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/database"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/integrity"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// A document that other live documents reference cannot be deleted on its
+// own. Dependents either block the delete or, where trash.cascade allows it,
+// go to the trash with it.
+
+// Cascade modes for trash.cascade
+const (
+	CascadeBlock  = "block"
+	CascadeDrafts = "drafts"
+	CascadeTrash  = "trash"
+)
+
+// draftStatus is the status a document has until it is approved or issued
+var draftStatus = map[string]string{
+	"salesorder":               "notapproved",
+	"supplier_purchase_orders": "draft",
+	"delivery_receipts":        "Ready",
+}
+
+// Plan is what deleting one document takes
+type Plan struct {
+	// Cascade are the dependents trashed along with the document
+	Cascade []integrity.Dependent `json:"cascade"`
+	// Blocking are the dependents that have to be deleted first
+	Blocking []integrity.Dependent `json:"blocking"`
+}
+
+// BlockedError is returned by Delete when dependents block it
+type BlockedError struct {
+	Plan Plan
+}
+
+func (e *BlockedError) Error() string {
+	var names []string
+	for _, d := range e.Plan.Blocking {
+		names = append(names, d.Collection+" "+d.ID.Hex())
+	}
+	return "referenced by " + strings.Join(names, ", ")
+}
+
+// Check works out what deleting a document would do under the cascade rules.
+// A dependent that would cascade is checked the same way, so a draft with
+// blocking dependents of its own blocks too.
+func Check(ctx context.Context, db *mongo.Database, rules map[string]string, collection string, id primitive.ObjectID) (Plan, error) {
+	var plan Plan
+	seen := map[primitive.ObjectID]bool{id: true}
+	err := plan.walk(ctx, db, rules, collection, id, seen)
+	return plan, err
+}
+
+func (p *Plan) walk(ctx context.Context, db *mongo.Database, rules map[string]string, collection string, id primitive.ObjectID, seen map[primitive.ObjectID]bool) error {
+	dependents, err := integrity.Dependents(ctx, db, collection, id)
+	if err != nil {
+		return err
+	}
+	for _, d := range dependents {
+		if seen[d.ID] {
+			continue
+		}
+		seen[d.ID] = true
+
+		if !cascades(rules, d) {
+			p.Blocking = append(p.Blocking, d)
+			continue
+		}
+		p.Cascade = append(p.Cascade, d)
+		if err := p.walk(ctx, db, rules, d.Collection, d.ID, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cascades(rules map[string]string, d integrity.Dependent) bool {
+	if !trashable(d.Collection) {
+		return false
+	}
+	switch rules[d.Collection] {
+	case CascadeTrash:
+		return true
+	case CascadeDrafts:
+		status, ok := draftStatus[d.Collection]
+		return ok && d.Status == status
+	}
+	return false
+}
+
+func trashable(collection string) bool {
+	for _, e := range Entities {
+		if e.Collection == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete moves a document to the trash together with the dependents the
+// cascade rules allow, in one transaction, and audits the cascaded ones. It
+// returns a *BlockedError when other dependents still reference the document,
+// and false when no live document has the id.
+func Delete(c *gin.Context, db *mongo.Database, cfg config.Config, collection string, id, by primitive.ObjectID) (bool, error) {
+	plan, err := Check(c, db, cfg.Trash.Cascade, collection, id)
+	if err != nil {
+		return false, err
+	}
+	if len(plan.Blocking) > 0 {
+		return false, &BlockedError{Plan: plan}
+	}
+
+	befores := make([]bson.M, len(plan.Cascade))
+	for i, d := range plan.Cascade {
+		befores[i] = audit.Snapshot(c, db, d.Collection, d.ID)
+	}
+
+	var deleted bool
+	err = database.WithTransaction(c, db, func(ctx context.Context) error {
+		ok, err := SoftDelete(ctx, db, collection, id, by)
+		if err != nil || !ok {
+			deleted = false
+			return err
+		}
+		for _, d := range plan.Cascade {
+			if _, err := SoftDelete(ctx, db, d.Collection, d.ID, by); err != nil {
+				return err
+			}
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil || !deleted {
+		return false, err
+	}
+
+	for i, d := range plan.Cascade {
+		audit.Changed(c, db, d.Collection, d.ID, audit.ActionDelete, befores[i])
+	}
+	return true, nil
+}
+
+// Blocked answers 409 with the blocking documents when err is a
+// *BlockedError and reports whether it did
+func Blocked(c *gin.Context, label string, err error) bool {
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    fmt.Sprintf("%s is still referenced by %d document(s); delete those first", label, len(blocked.Plan.Blocking)),
+		"blocking": blocked.Plan.Blocking,
+	})
+	return true
+}
+
+// TrashedTarget is a document in the trash that another one points at
+type TrashedTarget struct {
+	Field      string             `json:"field"`
+	Collection string             `json:"collection"`
+	ID         primitive.ObjectID `json:"id"`
+}
+
+// trashedTargets lists the documents doc references that are in the trash.
+// Restoring doc before them would leave it pointing at hidden documents.
+func trashedTargets(ctx context.Context, db *mongo.Database, collection string, doc bson.M) ([]TrashedTarget, error) {
+	var targets []TrashedTarget
+	for _, ref := range integrity.References {
+		if ref.Collection != collection || ref.Backlink || !trashable(ref.Target) {
+			continue
+		}
+
+		var ids []primitive.ObjectID
+		switch v := doc[ref.Field].(type) {
+		case primitive.ObjectID:
+			ids = append(ids, v)
+		case primitive.A:
+			for _, item := range v {
+				if id, ok := item.(primitive.ObjectID); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+
+		for _, id := range ids {
+			if id.IsZero() {
+				continue
+			}
+			n, err := db.Collection(ref.Target).CountDocuments(ctx, inTrash(bson.M{"_id": id}))
+			if err != nil {
+				return targets, err
+			}
+			if n > 0 {
+				targets = append(targets, TrashedTarget{Field: ref.Field, Collection: ref.Target, ID: id})
+			}
+		}
+	}
+	return targets, nil
+}
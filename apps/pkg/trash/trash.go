@@ -0,0 +1,399 @@
+package trash
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/integrity"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/models"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/version"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Business documents are never removed by their delete endpoints. They get
+// deleted_at and deleted_by, drop out of every list and lookup, and can be
+// restored until a super admin purges them after the retention window.
+
+const (
+	DeletedAt = "deleted_at"
+	DeletedBy = "deleted_by"
+)
+
+// Entity is a kind of document that goes to the trash
+type Entity struct {
+	Collection string
+	// Resource is the permission resource; its delete right covers the trash
+	Resource string
+	Label    string
+}
+
+// maxLimit caps a trash page like listquery.MaxLimit caps every other
+// list; listquery imports this package, so it cannot be used here
+const maxLimit = 100
+
+// Entities by the name used in trash routes, which is the permission resource
+var Entities = map[string]Entity{
+	permission.ResourceCustomer:        {Collection: "customer", Resource: permission.ResourceCustomer, Label: "Customer"},
+	permission.ResourceProject:         {Collection: "project", Resource: permission.ResourceProject, Label: "Project"},
+	permission.ResourceSalesOrder:      {Collection: "salesorder", Resource: permission.ResourceSalesOrder, Label: "Sales order"},
+	permission.ResourceSupplierPO:      {Collection: "supplier_purchase_orders", Resource: permission.ResourceSupplierPO, Label: "Supplier PO"},
+	permission.ResourceSupplier:        {Collection: "supplier", Resource: permission.ResourceSupplier, Label: "Supplier"},
+	permission.ResourceInventory:       {Collection: "polaris_inventory", Resource: permission.ResourceInventory, Label: "Inventory item"},
+	permission.ResourceSupplierDR:      {Collection: "supplierdeliveryreceipt", Resource: permission.ResourceSupplierDR, Label: "Supplier DR"},
+	permission.ResourceSupplierInvoice: {Collection: "supplierinvoice", Resource: permission.ResourceSupplierInvoice, Label: "Supplier invoice"},
+	permission.ResourceReceivingReport: {Collection: "polaris_receiving_reports", Resource: permission.ResourceReceivingReport, Label: "Receiving report"},
+	permission.ResourceSalesInvoice:    {Collection: "sales_invoices", Resource: permission.ResourceSalesInvoice, Label: "Sales invoice"},
+	permission.ResourceDeliveryReceipt: {Collection: "delivery_receipts", Resource: permission.ResourceDeliveryReceipt, Label: "Delivery receipt"},
+}
+
+// Live restricts a filter to documents that are not in the trash. A nil
+// filter matches every live document.
+func Live(filter bson.M) bson.M {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter[DeletedAt] = nil // also matches documents without the field
+	return filter
+}
+
+// MatchLive is the pipeline stage that drops trashed documents
+var MatchLive = bson.D{{Key: "$match", Value: bson.M{DeletedAt: nil}}}
+
+// inTrash matches trashed documents
+func inTrash(filter bson.M) bson.M {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter[DeletedAt] = bson.M{"$ne": nil}
+	return filter
+}
+
+// SoftDelete moves a live document to the trash. It returns false when no
+// live document has the id.
+func SoftDelete(ctx context.Context, db *mongo.Database, collection string, id, by primitive.ObjectID) (bool, error) {
+	res, err := db.Collection(collection).UpdateOne(ctx,
+		Live(bson.M{"_id": id}),
+		version.Bump(bson.M{"$set": bson.M{DeletedAt: time.Now(), DeletedBy: by}}),
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// Purgeable matches trashed documents older than the retention window
+func Purgeable(retention time.Duration) bson.M {
+	return bson.M{DeletedAt: bson.M{"$ne": nil, "$lte": time.Now().Add(-retention)}}
+}
+
+// Retention is the configured time documents stay restorable
+func Retention(cfg config.Config) time.Duration {
+	return time.Duration(cfg.Trash.RetentionDays) * 24 * time.Hour
+}
+
+// entity resolves the :entity route parameter and checks the caller may
+// delete that kind of document
+func entity(c *gin.Context, db *mongo.Database) (Entity, bool) {
+	e, ok := Entities[c.Param("entity")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown entity", "entities": Names()})
+		return Entity{}, false
+	}
+	if !permission.Authorize(c, db, e.Resource, permission.ActionDelete) {
+		return Entity{}, false
+	}
+	return e, true
+}
+
+// Names lists the entity names, sorted
+func Names() []string {
+	names := make([]string, 0, len(Entities))
+	for name := range Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListTrash pages through the trashed documents of one entity, most recently
+// deleted first
+func ListTrash(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	if _, exists := c.Get("user"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	e, ok := entity(c, db)
+	if !ok {
+		return
+	}
+
+	page := int64(1)
+	limit := int64(10)
+	if p := c.Query("page"); p != "" {
+		if v, err := strconv.ParseInt(p, 10, 64); err == nil && v > 0 {
+			page = v
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.ParseInt(l, 10, 64); err == nil && v > 0 {
+			limit = v
+		}
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	collection := db.Collection(e.Collection)
+	opts := options.Find().
+		SetSort(bson.D{{Key: DeletedAt, Value: -1}}).
+		SetSkip((page - 1) * limit).
+		SetLimit(limit)
+	cursor, err := collection.Find(c, inTrash(nil), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash", "details": err.Error()})
+		return
+	}
+	defer cursor.Close(c)
+
+	data := []bson.M{}
+	if err := cursor.All(c, &data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode trash", "details": err.Error()})
+		return
+	}
+	total, _ := collection.CountDocuments(c, inTrash(nil))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":          data,
+		"page":          page,
+		"limit":         limit,
+		"total":         total,
+		"retentionDays": cfg.Trash.RetentionDays,
+	})
+}
+
+// GetDependents previews a delete: which dependents would go to the trash
+// with the document and which block it
+func GetDependents(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	if _, exists := c.Get("user"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	e, ok := entity(c, db)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	plan, err := Check(c, db, cfg.Trash.Cascade, e.Collection, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check references", "details": err.Error()})
+		return
+	}
+	if plan.Cascade == nil {
+		plan.Cascade = []integrity.Dependent{}
+	}
+	if plan.Blocking == nil {
+		plan.Blocking = []integrity.Dependent{}
+	}
+	c.JSON(http.StatusOK, gin.H{"deletable": len(plan.Blocking) == 0, "cascade": plan.Cascade, "blocking": plan.Blocking})
+}
+
+// Restore takes a document out of the trash
+func Restore(c *gin.Context, db *mongo.Database) {
+	if _, exists := c.Get("user"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+	e, ok := entity(c, db)
+	if !ok {
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	before := audit.Snapshot(c, db, e.Collection, id)
+	if before != nil {
+		targets, err := trashedTargets(c, db, e.Collection, before)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check references", "details": err.Error()})
+			return
+		}
+		if len(targets) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   e.Label + " points at documents that are in the trash; restore those first",
+				"trashed": targets,
+			})
+			return
+		}
+	}
+
+	res, err := db.Collection(e.Collection).UpdateOne(c,
+		inTrash(bson.M{"_id": id}),
+		version.Bump(bson.M{"$unset": bson.M{DeletedAt: "", DeletedBy: ""}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore", "details": err.Error()})
+		return
+	}
+	if res.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Label + " not found in trash"})
+		return
+	}
+	audit.Changed(c, db, e.Collection, id, audit.ActionRestore, before)
+
+	c.JSON(http.StatusOK, gin.H{"message": e.Label + " restored", "id": id.Hex()})
+}
+
+// Purge permanently removes one trashed document. Super admins only, and
+// only once the document has been in the trash for the retention window.
+func Purge(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	if !superAdmin(c) {
+		return
+	}
+	e, ok := Entities[c.Param("entity")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown entity", "entities": Names()})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	before := audit.Snapshot(c, db, e.Collection, id)
+	if before == nil || before[DeletedAt] == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Label + " not found in trash"})
+		return
+	}
+
+	// Live documents may still point at it, e.g. after one was restored
+	dependents, err := integrity.Dependents(c, db, e.Collection, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check references", "details": err.Error()})
+		return
+	}
+	if len(dependents) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    e.Label + " is still referenced by live documents",
+			"blocking": dependents,
+		})
+		return
+	}
+
+	filter := Purgeable(Retention(cfg))
+	filter["_id"] = id
+	res, err := db.Collection(e.Collection).DeleteOne(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge", "details": err.Error()})
+		return
+	}
+	if res.DeletedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         e.Label + " is still within the retention window",
+			"retentionDays": cfg.Trash.RetentionDays,
+			"deletedAt":     before[DeletedAt],
+		})
+		return
+	}
+	audit.Record(c, db, e.Collection, id, audit.ActionPurge, before, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": e.Label + " purged", "id": id.Hex()})
+}
+
+// PurgeExpired permanently removes every document whose retention window has
+// passed, across all entities. Super admins only.
+func PurgeExpired(c *gin.Context, db *mongo.Database, cfg config.Config) {
+	if !superAdmin(c) {
+		return
+	}
+
+	purged, err := Expire(c, db, Retention(cfg), func(collection string, doc bson.M) {
+		id, _ := doc["_id"].(primitive.ObjectID)
+		audit.Record(c, db, collection, id, audit.ActionPurge, doc, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge trash", "details": err.Error(), "purged": purged})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Expired trash purged", "purged": purged})
+}
+
+// Expire deletes the documents past the retention window in every entity,
+// calling purged for each one after it is gone. Documents live ones still
+// reference are kept. It returns the counts per
+// entity name. The CLI uses it too.
+func Expire(ctx context.Context, db *mongo.Database, retention time.Duration, purged func(collection string, doc bson.M)) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, name := range Names() {
+		e := Entities[name]
+		collection := db.Collection(e.Collection)
+
+		cursor, err := collection.Find(ctx, Purgeable(retention))
+		if err != nil {
+			return counts, err
+		}
+		var docs []bson.M
+		err = cursor.All(ctx, &docs)
+		if err != nil {
+			return counts, err
+		}
+
+		for _, doc := range docs {
+			id, _ := doc["_id"].(primitive.ObjectID)
+			dependents, err := integrity.Dependents(ctx, db, e.Collection, id)
+			if err != nil {
+				return counts, err
+			}
+			if len(dependents) > 0 {
+				continue // kept until nothing live points at it
+			}
+
+			// Re-check the window so a restore in between wins
+			filter := Purgeable(retention)
+			filter["_id"] = id
+			res, err := collection.DeleteOne(ctx, filter)
+			if err != nil {
+				return counts, err
+			}
+			if res.DeletedCount > 0 {
+				counts[name]++
+				if purged != nil {
+					purged(e.Collection, doc)
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+func superAdmin(c *gin.Context) bool {
+	value, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return false
+	}
+	user, ok := value.(*models.User)
+	if !ok || !user.IsSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return false
+	}
+	return true
+}
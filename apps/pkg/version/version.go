@@ -0,0 +1,109 @@
+package version
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Every editable document carries a version that each write increments. An
+// edit names the version it was based on and only applies if nobody has
+// written in between; otherwise the caller gets the current copy back.
+
+// Field is the document field holding the version
+const Field = "version"
+
+// Expected reads the version the client last saw, from If-Match or else the
+// body. It answers 428 or 400 itself and returns false when there is none.
+func Expected(c *gin.Context, body *int64) (int64, bool) {
+	if header := c.GetHeader("If-Match"); header != "" {
+		v, err := parseETag(header)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match must be the document version"})
+			return 0, false
+		}
+		return v, true
+	}
+	if body != nil {
+		return *body, true
+	}
+	c.JSON(http.StatusPreconditionRequired, gin.H{"error": "version is required; send the version from your last read as a body field or If-Match header"})
+	return 0, false
+}
+
+// parseETag accepts 3, "3" and W/"3"
+func parseETag(header string) (int64, error) {
+	tag := strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	return strconv.ParseInt(strings.Trim(tag, `"`), 10, 64)
+}
+
+// Filter matches the document only while it is still at the expected version.
+// Documents written before versions existed count as version 0. Documents
+// in the trash never match.
+func Filter(id primitive.ObjectID, expected int64) bson.M {
+	if expected == 0 {
+		return bson.M{"_id": id, "deleted_at": nil, "$or": bson.A{
+			bson.M{Field: 0},
+			bson.M{Field: bson.M{"$exists": false}},
+		}}
+	}
+	return bson.M{"_id": id, "deleted_at": nil, Field: expected}
+}
+
+// Bump adds the version increment to an update document
+func Bump(update bson.M) bson.M {
+	inc, _ := update["$inc"].(bson.M)
+	if inc == nil {
+		inc = bson.M{}
+	}
+	inc[Field] = 1
+	update["$inc"] = inc
+	return update
+}
+
+// Of reads the version from a raw document. $inc on a missing field stores
+// a 32-bit number, so both widths occur.
+func Of(doc bson.M) int64 {
+	switch v := doc[Field].(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// SetETag exposes the version as an ETag so clients can echo it in If-Match
+func SetETag(c *gin.Context, v int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(v, 10)+`"`)
+}
+
+// Conflict answers an edit whose filter matched nothing: 404 when the
+// document is gone or in the trash, otherwise 409 with the copy now on the server
+func Conflict(c *gin.Context, db *mongo.Database, collection string, id primitive.ObjectID, notFound string) {
+	var current bson.M
+	err := db.Collection(collection).FindOne(c, bson.M{"_id": id, "deleted_at": nil}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the current document", "details": err.Error()})
+		return
+	}
+
+	v := Of(current)
+	SetETag(c, v)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "The document was changed by someone else; review the current version and retry",
+		"version": v,
+		"current": current,
+	})
+}
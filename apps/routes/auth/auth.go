@@ -1,39 +1,80 @@
 package auth
 
 import (
-	"log"
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/accountsreceivable/deliveryreceipt"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/accountsreceivable/salesinvoice"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/audit"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/apikey"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/invite"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/loginguard"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/password"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/permission"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/profile"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/session"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/signin"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/signup"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/auth/twofactor"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/customer"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/dashboard"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/health"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/integrity"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/metrics"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/middleware"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/polarisinventory"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/project"
 
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/report"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/salesorder"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/search"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplier"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierdr"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierinvoice"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/supplierpo"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/trash"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/routes/getapiroutes"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func Auth(db *mongo.Database) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "10004"
-		log.Printf("Defaulting to port %s", port)
-	}
-
-	apiV1, router := getapiroutes.GetApiRoutes()
+// Auth registers every API route and returns the router; the caller owns the
+// HTTP server
+func Auth(cfg config.Config, db *mongo.Database) *gin.Engine {
+	apiV1, router := getapiroutes.GetApiRoutes(cfg)
+
+	// Probes for the orchestrator, outside the versioned API and without auth
+	router.GET("/healthz", health.Liveness)
+	router.GET("/readyz", func(c *gin.Context) {
+		health.Readiness(c, db)
+	})
+	router.GET("/metrics", metrics.Handler(cfg.Server.MetricsToken))
+
+	// Route group permissions. Each group is unlocked by the menu of the screen
+	// that uses it; lookup routes feeding dropdowns on other screens accept any
+	// of those screens' menus as well.
+	settingsAccess := middleware.RequirePermission(db, permission.Settings)
+	dashboardAccess := middleware.RequirePermission(db, permission.Dashboard)
+	customerAccess := middleware.RequirePermission(db, permission.Customers)
+	projectAccess := middleware.RequirePermission(db, permission.Projects)
+	salesOrderAccess := middleware.RequirePermission(db, permission.SalesOrders)
+	purchaseOrderAccess := middleware.RequirePermission(db, permission.PurchaseOrders)
+	warehousingAccess := middleware.RequirePermission(db, permission.Warehousing)
+	accountsReceivableAccess := middleware.RequirePermission(db, permission.AccountsReceivable)
+	reportAccess := middleware.RequirePermission(db, permission.GenerateReports)
+
+	customerLookupAccess := middleware.RequirePermission(db, permission.Lookups[permission.ResourceCustomer]...)
+	projectLookupAccess := middleware.RequirePermission(db, permission.Lookups[permission.ResourceProject]...)
+	salesOrderLookupAccess := middleware.RequirePermission(db, permission.Lookups[permission.ResourceSalesOrder]...)
+	supplierPOLookupAccess := middleware.RequirePermission(db, permission.Lookups[permission.ResourceSupplierPO]...)
+	supplierLookupAccess := middleware.RequirePermission(db, permission.Lookups[permission.ResourceSupplier]...)
+	inventoryLookupAccess := middleware.RequirePermission(db, permission.Lookups[permission.ResourceInventory]...)
+	salesInvoiceLookupAccess := middleware.RequirePermission(db, permission.AccountsReceivable, permission.SalesOrders)
+
+	// Create routes accept an Idempotency-Key so a retried submission does
+	// not make a second document
+	idempotent := middleware.Idempotency(cfg, db)
 
 	// Define health check endpoint for the auth service
 	apiV1.GET("/auth", func(c *gin.Context) {
@@ -42,330 +83,479 @@ func Auth(db *mongo.Database) {
 
 	// Define sign-up handler for email-based sign-up
 	apiV1.POST("/auth/sign-up-email", func(c *gin.Context) {
-		signup.SignUp(c, db)
+		signup.SignUp(c, db, cfg)
 	})
 
 	apiV1.POST("/auth/sign-in-email", func(c *gin.Context) {
-		signin.SignIn(c, db)
+		signin.SignIn(c, db, cfg)
+	})
+
+	apiV1.POST("/auth/2fa/verify", func(c *gin.Context) {
+		signin.VerifyTwoFactor(c, db, cfg)
+	})
+
+	apiV1.GET("/auth/2fa/status", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		twofactor.Status(c, db)
+	})
+
+	apiV1.POST("/auth/2fa/setup", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		twofactor.Setup(c, db)
+	})
+
+	apiV1.POST("/auth/2fa/enable", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		twofactor.Enable(c, db)
+	})
+
+	apiV1.POST("/auth/2fa/disable", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		twofactor.Disable(c, db)
+	})
+
+	apiV1.POST("/auth/2fa/recovery-codes", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		twofactor.RegenerateRecoveryCodes(c, db)
+	})
+
+	apiV1.POST("/auth/refresh", func(c *gin.Context) {
+		session.Refresh(c, db, cfg)
+	})
+
+	apiV1.POST("/auth/logout", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		session.Logout(c, db)
+	})
+
+	apiV1.POST("/auth/logout-all", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		session.LogoutAll(c, db)
+	})
+
+	apiV1.GET("/auth/my-profile", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		profile.GetMyProfile(c, db)
+	})
+
+	apiV1.PUT("/auth/my-profile", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		profile.UpdateMyProfile(c, db)
+	})
+
+	apiV1.POST("/auth/change-password", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		password.ChangePassword(c, db, cfg)
+	})
+
+	apiV1.POST("/auth/forgot-password", func(c *gin.Context) {
+		password.ForgotPassword(c, db, cfg)
 	})
 
-	apiV1.GET("/auth/get-all-user", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/auth/reset-password", func(c *gin.Context) {
+		password.ResetPassword(c, db, cfg)
+	})
+
+	apiV1.GET("/auth/invite", func(c *gin.Context) {
+		invite.GetInvite(c, db, cfg)
+	})
+
+	apiV1.POST("/auth/accept-invite", func(c *gin.Context) {
+		invite.AcceptInvite(c, db, cfg)
+	})
+
+	apiV1.GET("/auth/get-all-user", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
 		signup.GetAllUsers(c, db)
 	})
 
-	apiV1.GET("/auth/get-all-roles", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/auth/get-all-roles", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
 		signup.GetAllRoles(c, db)
 	})
 
-	apiV1.POST("/auth/create-roles", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/auth/create-roles", middleware.JWTMiddleware(cfg, db), settingsAccess, idempotent, func(c *gin.Context) {
 		signup.CreateRole(c, db)
 	})
-	apiV1.PUT("/auth/update-menus-of-roles", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/auth/update-menus-of-roles", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
 		signup.UpdateRoleMenus(c, db)
 	})
 
-	apiV1.POST("/auth/get-menus-by-roles", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/auth/get-menus-by-roles", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
 		signup.GetRoleWithMenus(c, db)
 	})
-	apiV1.GET("/auth/get-all-menus", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/auth/get-all-menus", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
 		signup.GetAllMenus(c, db)
 	})
 
-	apiV1.POST("/auth/update-user-roles", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/auth/get-permission-catalog", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		signup.GetPermissionCatalog(c)
+	})
+
+	apiV1.POST("/auth/update-user-roles", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
 		signup.ApproveOrUpdateUser(c, db)
 	})
 
+	apiV1.POST("/auth/unlock-account", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		loginguard.UnlockAccount(c, db)
+	})
+
+	apiV1.GET("/auth/login-attempts", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		loginguard.GetLoginAttempts(c, db)
+	})
+
+	apiV1.POST("/auth/invite-user", middleware.JWTMiddleware(cfg, db), settingsAccess, idempotent, func(c *gin.Context) {
+		invite.InviteUser(c, db, cfg)
+	})
+
+	apiV1.POST("/auth/resend-invite/:id", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		invite.ResendInvite(c, db, cfg)
+	})
+
+	apiV1.DELETE("/auth/revoke-invite/:id", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		invite.RevokeInvite(c, db)
+	})
+
+	apiV1.POST("/auth/create-service-account", middleware.JWTMiddleware(cfg, db), settingsAccess, idempotent, func(c *gin.Context) {
+		apikey.CreateServiceAccount(c, db)
+	})
+
+	apiV1.GET("/auth/get-service-accounts", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		apikey.GetServiceAccounts(c, db)
+	})
+
+	apiV1.POST("/auth/create-api-key", middleware.JWTMiddleware(cfg, db), settingsAccess, idempotent, func(c *gin.Context) {
+		apikey.CreateAPIKey(c, db)
+	})
+
+	apiV1.GET("/auth/get-api-keys", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		apikey.GetAPIKeys(c, db)
+	})
+
+	apiV1.DELETE("/auth/revoke-api-key/:id", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		apikey.RevokeAPIKey(c, db)
+	})
+
+	apiV1.GET("/audit/get-audit-logs", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		audit.GetAuditLogs(c, db)
+	})
+
+	apiV1.GET("/integrity/get-report", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		integrity.GetIntegrityReport(c, db)
+	})
+	apiV1.POST("/integrity/fix", middleware.JWTMiddleware(cfg, db), settingsAccess, func(c *gin.Context) {
+		integrity.FixIntegrity(c, db)
+	})
+
+	// Trash. Each entity's delete permission covers its trash and the delete
+	// preview; purging is for super admins. Both are checked in the handlers.
+	apiV1.GET("/trash/get-trash/:entity", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		trash.ListTrash(c, db, cfg)
+	})
+	apiV1.GET("/trash/get-dependents/:entity/:id", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		trash.GetDependents(c, db, cfg)
+	})
+	apiV1.POST("/trash/restore/:entity/:id", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		trash.Restore(c, db)
+	})
+	apiV1.DELETE("/trash/purge/:entity/:id", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		trash.Purge(c, db, cfg)
+	})
+	apiV1.DELETE("/trash/purge-expired", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		trash.PurgeExpired(c, db, cfg)
+	})
+
+	// Global search; each result type needs its view permission, checked in
+	// the handler
+	apiV1.GET("/search", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
+		search.Search(c, db, cfg)
+	})
+
 	//project
-	apiV1.GET("/project/get-customer-details/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/project/get-customer-details/:id", middleware.JWTMiddleware(cfg, db), projectAccess, func(c *gin.Context) {
 		project.GetCustomerDetails(c, db)
 	})
-	apiV1.POST("/project/create-project", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		project.CreateProject(c, db)
+	apiV1.POST("/project/create-project", middleware.JWTMiddleware(cfg, db), projectAccess, idempotent, func(c *gin.Context) {
+		project.CreateProject(c, db, cfg)
 	})
-	apiV1.GET("/project/get-all-project", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/project/get-all-project", middleware.JWTMiddleware(cfg, db), projectAccess, func(c *gin.Context) {
 		project.GetAllProjects(c, db)
 	})
-	apiV1.GET("/project/get-all-project-info", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/project/get-all-project-info", middleware.JWTMiddleware(cfg, db), projectLookupAccess, func(c *gin.Context) {
 		project.GetAllProjectsInfo(c, db)
 	})
-	apiV1.GET("/project/get-project-by/:projectID", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/project/get-project-by/:projectID", middleware.JWTMiddleware(cfg, db), projectAccess, func(c *gin.Context) {
 		project.GetProjectFullDetails(c, db)
 	})
-	apiV1.PUT("/project/edit-project/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/project/edit-project/:id", middleware.JWTMiddleware(cfg, db), projectAccess, func(c *gin.Context) {
 		project.UpdateProject(c, db)
 	})
-	apiV1.DELETE("/project/delete-project/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		project.DeleteProject(c, db)
+	apiV1.DELETE("/project/delete-project/:id", middleware.JWTMiddleware(cfg, db), projectAccess, func(c *gin.Context) {
+		project.DeleteProject(c, db, cfg)
 	})
 
 	//customer
-	apiV1.POST("/customer/add-update-customer", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		customer.AddCustomer(c, db)
+	apiV1.POST("/customer/add-update-customer", middleware.JWTMiddleware(cfg, db), customerAccess, idempotent, func(c *gin.Context) {
+		customer.AddCustomer(c, db, cfg)
 	})
 
-	apiV1.GET("/customer/get-all-customer", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/customer/get-all-customer", middleware.JWTMiddleware(cfg, db), customerLookupAccess, func(c *gin.Context) {
 		customer.GetAllCustomers(c, db)
 	})
 
-	apiV1.DELETE("/customer/delete-customer", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		customer.DeleteCustomer(c, db)
+	apiV1.DELETE("/customer/delete-customer", middleware.JWTMiddleware(cfg, db), customerAccess, func(c *gin.Context) {
+		customer.DeleteCustomer(c, db, cfg)
 	})
 
 	// //quotation
-	// apiV1.POST("/quotation/upsert", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.POST("/quotation/upsert", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	quotation.UpsertQuotation(c, db)
 	// })
-	// apiV1.POST("/quotation/toggle-status", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.POST("/quotation/toggle-status", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	quotation.ToggleQuotationStatus(c, db)
 	// })
-	// apiV1.GET("/quotation/customer-quotations/:customerId", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.GET("/quotation/customer-quotations/:customerId", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	quotation.GetQuotationsByCustomer(c, db)
 	// })
-	// apiV1.GET("/quotation/get-quotation-by-id/:quotationId", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.GET("/quotation/get-quotation-by-id/:quotationId", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	quotation.GetQuotationByID(c, db)
 	// })
-	// apiV1.DELETE("/quotation/delete-quotation/:quotationId", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.DELETE("/quotation/delete-quotation/:quotationId", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	quotation.DeleteQuotation(c, db)
 	// })
 
 	//Supplier Purchase order
-	apiV1.POST("/supplierpo/add", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		supplierpo.AddSupplierPO(c, db)
+	apiV1.POST("/supplierpo/add", middleware.JWTMiddleware(cfg, db), purchaseOrderAccess, idempotent, func(c *gin.Context) {
+		supplierpo.AddSupplierPO(c, db, cfg)
 	})
 
-	apiV1.PUT("/supplierpo/update", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/supplierpo/update", middleware.JWTMiddleware(cfg, db), purchaseOrderAccess, func(c *gin.Context) {
 		supplierpo.UpdateSupplierPO(c, db)
 	})
 
-	apiV1.GET("/supplierpo/get-all-supplierpo", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplierpo/get-all-supplierpo", middleware.JWTMiddleware(cfg, db), purchaseOrderAccess, func(c *gin.Context) {
 		supplierpo.GetAllSupplierPO(c, db)
 	})
 
-	apiV1.GET("/supplierpo/get-all-info", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplierpo/get-all-info", middleware.JWTMiddleware(cfg, db), supplierPOLookupAccess, func(c *gin.Context) {
 		supplierpo.GetAllSupplierPOinfo(c, db)
 	})
 
-	apiV1.GET("/supplierpo/get-po-by/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplierpo/get-po-by/:id", middleware.JWTMiddleware(cfg, db), purchaseOrderAccess, func(c *gin.Context) {
 		supplierpo.GetSupplierPOByID(c, db)
 	})
 
-	apiV1.DELETE("/supplierpo/delete-po/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		supplierpo.DeleteSupplierPO(c, db)
+	apiV1.DELETE("/supplierpo/delete-po/:id", middleware.JWTMiddleware(cfg, db), purchaseOrderAccess, func(c *gin.Context) {
+		supplierpo.DeleteSupplierPO(c, db, cfg)
+	})
+
+	apiV1.GET("/supplierpo/download-pdf/:id", middleware.JWTMiddleware(cfg, db), purchaseOrderAccess, func(c *gin.Context) {
+		supplierpo.DownloadSupplierPOPDF(c, db, cfg)
 	})
 
 	// Inventory
-	apiV1.POST("/inventory/add", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/inventory/add", middleware.JWTMiddleware(cfg, db), warehousingAccess, idempotent, func(c *gin.Context) {
 		polarisinventory.AddInventory(c, db)
 	})
 
-	apiV1.GET("/inventory/get", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/inventory/get", middleware.JWTMiddleware(cfg, db), inventoryLookupAccess, func(c *gin.Context) {
 		polarisinventory.GetAllInventory(c, db)
 	})
 
-	apiV1.GET("/inventory/get-by/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/inventory/get-by/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		polarisinventory.GetInventoryByID(c, db)
 	})
 
-	apiV1.PUT("/inventory/update/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/inventory/update/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		polarisinventory.UpdateInventory(c, db)
 	})
 
-	apiV1.DELETE("/inventory/delete/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		polarisinventory.DeleteInventory(c, db)
+	apiV1.DELETE("/inventory/delete/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
+		polarisinventory.DeleteInventory(c, db, cfg)
 	})
 
 	//sales order
-	apiV1.POST("/salesorder/create-sales-order", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		salesorder.CreateSalesOrder(c, db)
+	apiV1.POST("/salesorder/create-sales-order", middleware.JWTMiddleware(cfg, db), salesOrderAccess, idempotent, func(c *gin.Context) {
+		salesorder.CreateSalesOrder(c, db, cfg)
 	})
 
-	apiV1.PUT("/salesorder/edit-sales-order", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/salesorder/edit-sales-order", middleware.JWTMiddleware(cfg, db), salesOrderAccess, func(c *gin.Context) {
 		salesorder.EditSalesOrder(c, db)
 	})
 
-	apiV1.GET("/salesorder/get-all-sales-order", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/salesorder/get-all-sales-order", middleware.JWTMiddleware(cfg, db), salesOrderLookupAccess, func(c *gin.Context) {
 		salesorder.GetAllSalesOrders(c, db)
 	})
-	apiV1.GET("/salesorder/get-sales-order-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/salesorder/get-sales-order-by-id/:id", middleware.JWTMiddleware(cfg, db), salesOrderAccess, func(c *gin.Context) {
 		salesorder.GetSalesOrderByID(c, db)
 	})
-	apiV1.DELETE("/salesorder/delete-sales-order", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		salesorder.DeleteSalesOrder(c, db)
+	apiV1.DELETE("/salesorder/delete-sales-order", middleware.JWTMiddleware(cfg, db), salesOrderAccess, func(c *gin.Context) {
+		salesorder.DeleteSalesOrder(c, db, cfg)
 	})
-	apiV1.POST("/salesorder/add-aircon", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/salesorder/add-aircon", middleware.JWTMiddleware(cfg, db), salesOrderAccess, idempotent, func(c *gin.Context) {
 		salesorder.CreateAircon(c, db)
 	})
-	apiV1.GET("/salesorder/get-aircon", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/salesorder/get-aircon", middleware.JWTMiddleware(cfg, db), salesOrderLookupAccess, func(c *gin.Context) {
 		salesorder.GetAllAircon(c, db)
 	})
 
 	//Invoices
-	// apiV1.POST("/invoices/add", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.POST("/invoices/add", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	invoices.CreateInvoice(c, db)
 	// })
 
-	// apiV1.GET("/invoices/get", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.GET("/invoices/get", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	invoices.GetAllInvoices(c, db)
 	// })
 
-	// apiV1.GET("/invoices/get-by/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.GET("/invoices/get-by/:id", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	invoices.GetInvoiceByID(c, db)
 	// })
 
-	// apiV1.PUT("/invoices/update/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.PUT("/invoices/update/:id", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	invoices.UpdateInvoice(c, db)
 	// })
 
-	// apiV1.DELETE("/invoices/delete/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	// apiV1.DELETE("/invoices/delete/:id", middleware.JWTMiddleware(cfg, db), func(c *gin.Context) {
 	// 	invoices.DeleteInvoice(c, db)
 	// })
 
 	//supplier dr
-	apiV1.POST("/supplier/delivery-r-create", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/supplier/delivery-r-create", middleware.JWTMiddleware(cfg, db), warehousingAccess, idempotent, func(c *gin.Context) {
 		supplierdr.CreateSupplierDR(c, db)
 	})
 
-	apiV1.GET("/supplier/dr/get-all", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/dr/get-all", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierdr.GetAllSupplierDR(c, db)
 	})
-	apiV1.GET("/supplier/dr/get-all-info", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/dr/get-all-info", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierdr.GetAllSupplierDRWithoutPagination(c, db)
 	})
-	apiV1.GET("/supplier/dr-get-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/dr-get-by-id/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierdr.GetSupplierDRByID(c, db)
 	})
-	apiV1.PUT("/supplier/dr-edit", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/supplier/dr-edit", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierdr.EditSupplierDR(c, db)
 	})
-	apiV1.DELETE("/supplier/dr-delete", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		supplierdr.DeleteSupplierDR(c, db)
+	apiV1.DELETE("/supplier/dr-delete", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
+		supplierdr.DeleteSupplierDR(c, db, cfg)
 	})
 
 	//supplier invoice
-	apiV1.POST("/supplier/invoice-create", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/supplier/invoice-create", middleware.JWTMiddleware(cfg, db), warehousingAccess, idempotent, func(c *gin.Context) {
 		supplierinvoice.CreateSupplierInvoice(c, db)
 	})
 
-	apiV1.GET("/supplier/invoice/get-all", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/invoice/get-all", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierinvoice.GetAllSupplierInvoices(c, db)
 	})
 
-	apiV1.GET("/supplier/invoice/get-all-info", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/invoice/get-all-info", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierinvoice.GetAllSupplierInvoicesWithoutPagination(c, db)
 	})
 
-	apiV1.GET("/supplier/invoice-get-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/invoice-get-by-id/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierinvoice.GetSupplierInvoiceByID(c, db)
 	})
 
-	apiV1.PUT("/supplier/invoice-edit", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/supplier/invoice-edit", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplierinvoice.EditSupplierInvoice(c, db)
 	})
 
-	apiV1.DELETE("/supplier/invoice-delete", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		supplierinvoice.DeleteSupplierInvoice(c, db)
+	apiV1.DELETE("/supplier/invoice-delete", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
+		supplierinvoice.DeleteSupplierInvoice(c, db, cfg)
 	})
 
 	//RR
-	apiV1.POST("/receiving-r/rr-create", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/receiving-r/rr-create", middleware.JWTMiddleware(cfg, db), warehousingAccess, idempotent, func(c *gin.Context) {
 		polarisinventory.AddOrUpdateReceivingReportInventory(c, db)
 	})
 
-	apiV1.GET("/receiving-r/rr-get-all", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/receiving-r/rr-get-all", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		polarisinventory.GetAllReceivingReportInventory(c, db)
 	})
 
-	apiV1.GET("/receiving-r/rr-get-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/receiving-r/rr-get-by-id/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		polarisinventory.GetReceivingReportInventoryByID(c, db)
 	})
 
-	apiV1.DELETE("/receiving-r/rr-delete/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		polarisinventory.DeleteReceivingReportInventory(c, db)
+	apiV1.DELETE("/receiving-r/rr-delete/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
+		polarisinventory.DeleteReceivingReportInventory(c, db, cfg)
 	})
 
 	//supplier
-	apiV1.POST("/supplier/add-supplier", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.POST("/supplier/add-supplier", middleware.JWTMiddleware(cfg, db), warehousingAccess, idempotent, func(c *gin.Context) {
 		supplier.CreateSupplier(c, db)
 	})
 
-	apiV1.GET("/supplier/get-all-suppliers", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/get-all-suppliers", middleware.JWTMiddleware(cfg, db), supplierLookupAccess, func(c *gin.Context) {
 		supplier.GetAllSuppliers(c, db)
 	})
 
-	apiV1.GET("/supplier/get-supplier-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/supplier/get-supplier-by-id/:id", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplier.GetSupplierByID(c, db)
 	})
 
-	apiV1.PUT("/supplier/edit-supplier", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/supplier/edit-supplier", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
 		supplier.EditSupplier(c, db)
 	})
 
-	apiV1.DELETE("/supplier/supplier-delete", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		supplier.DeleteSupplier(c, db)
+	apiV1.DELETE("/supplier/supplier-delete", middleware.JWTMiddleware(cfg, db), warehousingAccess, func(c *gin.Context) {
+		supplier.DeleteSupplier(c, db, cfg)
 	})
 
 	// sales invoice
-	apiV1.POST("/sales-invoice/create-sales-invoice", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		salesinvoice.CreateSalesInvoice(c, db)
+	apiV1.POST("/sales-invoice/create-sales-invoice", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, idempotent, func(c *gin.Context) {
+		salesinvoice.CreateSalesInvoice(c, db, cfg)
 	})
 
-	apiV1.GET("/sales-invoice/get-all-sales-invoice", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/sales-invoice/get-all-sales-invoice", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		salesinvoice.GetAllSalesInvoices(c, db)
 	})
 
-	apiV1.GET("/sales-invoice/get-sales-invoice-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/sales-invoice/get-sales-invoice-by-id/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		salesinvoice.GetSalesInvoiceByID(c, db)
 	})
 
-	apiV1.PUT("/sales-invoice/update-sales-invoice/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/sales-invoice/update-sales-invoice/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		salesinvoice.UpdateSalesInvoice(c, db)
 	})
 
-	apiV1.DELETE("/sales-invoice/delete-sales-invoice/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		salesinvoice.DeleteSalesInvoice(c, db)
+	apiV1.DELETE("/sales-invoice/delete-sales-invoice/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
+		salesinvoice.DeleteSalesInvoice(c, db, cfg)
 	})
 
 	// extra: get customer by project
-	apiV1.GET("/sales-invoice/customer-by-project/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/sales-invoice/customer-by-project/:id", middleware.JWTMiddleware(cfg, db), salesInvoiceLookupAccess, func(c *gin.Context) {
 		salesinvoice.GetCustomerByProjectID(c, db)
 	})
 
-	apiV1.GET("/project/all-data-by-project/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/project/all-data-by-project/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		salesinvoice.GetInvoiceDetailsByProjectID(c, db)
 	})
 
 	// delivery receipt
-	apiV1.POST("/delivery-receipt/create-delivery-receipt", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		deliveryreceipt.CreateDeliveryReceipt(c, db)
+	apiV1.POST("/delivery-receipt/create-delivery-receipt", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, idempotent, func(c *gin.Context) {
+		deliveryreceipt.CreateDeliveryReceipt(c, db, cfg)
 	})
 
-	apiV1.GET("/delivery-receipt/get-all-delivery-receipts", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/delivery-receipt/get-all-delivery-receipts", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		deliveryreceipt.GetAllDeliveryReceipts(c, db)
 	})
 
-	apiV1.GET("/delivery-receipt/get-delivery-receipt-by-id/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/delivery-receipt/get-delivery-receipt-by-id/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		deliveryreceipt.GetDeliveryReceiptByID(c, db)
 	})
 
-	apiV1.PUT("/delivery-receipt/update-delivery-receipt/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.PUT("/delivery-receipt/update-delivery-receipt/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
 		deliveryreceipt.UpdateDeliveryReceipt(c, db)
 	})
 
-	apiV1.DELETE("/delivery-receipt/delete-delivery-receipt/:id", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		deliveryreceipt.DeleteDeliveryReceipt(c, db)
+	apiV1.DELETE("/delivery-receipt/delete-delivery-receipt/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
+		deliveryreceipt.DeleteDeliveryReceipt(c, db, cfg)
+	})
+
+	apiV1.GET("/delivery-receipt/download-pdf/:id", middleware.JWTMiddleware(cfg, db), accountsReceivableAccess, func(c *gin.Context) {
+		deliveryreceipt.DownloadDeliveryReceiptPDF(c, db, cfg)
 	})
 
 	//generate report
-	apiV1.POST("/generate-report/generate-report", middleware.JWTMiddleware(db), func(c *gin.Context) {
-		report.GenerateReport(c, db)
+	apiV1.POST("/generate-report/generate-report", middleware.JWTMiddleware(cfg, db), reportAccess, func(c *gin.Context) {
+		report.GenerateReport(c, db, cfg)
 	})
 
 	//dashboard
-	apiV1.GET("/dashboard/get-dashboard", middleware.JWTMiddleware(db), func(c *gin.Context) {
+	apiV1.GET("/dashboard/get-dashboard", middleware.JWTMiddleware(cfg, db), dashboardAccess, func(c *gin.Context) {
 		dashboard.GetDashboard(c, db)
 	})
 
-	// Listen and serve on defined port
-	log.Printf("Application started, Listening on Port %s", port)
-	router.Run(":" + port)
+	return router
 }
@@ -1,27 +1,19 @@
 package getapiroutes
 
 import (
-	"log"
-	"os"
-
 	"github.com/gin-gonic/gin"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/config"
 	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/helper/cors"
+	"github.com/innovativecursor/PolarisPrimeAirTechCorp/apps/pkg/middleware"
 )
 
-func GetApiRoutes() (*gin.RouterGroup, *gin.Engine) {
-	// version
-	getCurrentApiVersion := os.Getenv("API_VERSION")
-
-	if getCurrentApiVersion == "" {
-		getCurrentApiVersion = "v1"
-		log.Printf("Defaulting to version %s", getCurrentApiVersion)
-	}
-
-	router := gin.Default()
+func GetApiRoutes(cfg config.Config) (*gin.RouterGroup, *gin.Engine) {
+	router := gin.New()
 
-	router.Use(cors.CORSMiddleware())
+	router.Use(gin.Recovery(), middleware.RequestID(), middleware.AccessLog())
+	router.Use(cors.CORSMiddleware(cfg))
 
-	apiV1 := router.Group(getCurrentApiVersion)
+	apiV1 := router.Group(cfg.Server.APIVersion)
 
 	return apiV1, router
 }
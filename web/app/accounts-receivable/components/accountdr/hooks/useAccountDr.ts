@@ -118,6 +118,7 @@ export function useAccountDr() {
         setSaving(true);
         await fetchDataPut(endpoints.deliveryReceipt.update(id), {
           status,
+          version: allAccountDr.find((dr) => dr.id === id)?.version,
         });
 
         toast.success("Delivery receipt updated");
@@ -128,7 +129,7 @@ export function useAccountDr() {
         setSaving(false);
       }
     },
-    [GetAccountDr]
+    [GetAccountDr, allAccountDr]
   );
 
   return {
@@ -13,6 +13,7 @@ export type DeliveryReceiptItem = {
 export type DeliveryReceipt = {
   id: string;
   dr_number: string;
+  version: number;
 
   project: {
     id: string;
@@ -13,6 +13,7 @@ import { useSalesOrders } from "@/app/sales-orders/hooks/useSalesOrders";
 export function useAccountSales() {
   const [mode, setMode] = useState<"list" | "create">("list");
   const [editing, setEditing] = useState<string | null>(null);
+  const [version, setVersion] = useState<number | undefined>(undefined);
   const [loading, setLoading] = useState(false);
   const [saving, setSaving] = useState(false);
   const [error, setError] = useState<string | null>(null);
@@ -91,6 +92,7 @@ export function useAccountSales() {
       const res = await fetchDataGet<any>(endpoints.salesInvoice.getById(id));
 
       const invoice = res.data ?? res;
+      setVersion(invoice.version);
 
       setForm({
         project_id: invoice.project?.id || invoice.project_id || "",
@@ -153,6 +155,7 @@ export function useAccountSales() {
         sku: it.sku,
         quantity: it.quantity,
       })),
+      version: editing ? version : undefined,
     };
 
     try {
@@ -178,7 +181,7 @@ export function useAccountSales() {
     } finally {
       setSaving(false);
     }
-  }, [form, items, editing, GetAccountSales]);
+  }, [form, items, editing, version, GetAccountSales]);
 
   const deleteSalesInvoice = useCallback(
     async (id: string) => {
@@ -6,7 +6,14 @@ import SignupForm from "./SignupForm";
 
 export default function LoginView() {
   const [mode, setMode] = useState<"login" | "signup">("login");
-  const { handleLogin, loading } = useLogin();
+  const {
+    handleLogin,
+    handleVerify,
+    continueToDashboard,
+    challenge,
+    recoveryCodes,
+    loading,
+  } = useLogin();
 
   const onSubmit = (e: FormEvent<HTMLFormElement>) => {
     void handleLogin(e);
@@ -66,7 +73,80 @@ export default function LoginView() {
               </p>
             </div>
 
-            {mode === "login" ? (
+            {recoveryCodes ? (
+              <div className="space-y-4">
+                <p className="text-sm text-slate-600">
+                  Two-factor authentication is now on. Store these recovery
+                  codes somewhere safe; each one can be used once if you lose
+                  your authenticator.
+                </p>
+                <ul className="grid grid-cols-2 gap-2 rounded-xl border border-slate-200 bg-slate-50 p-4 font-mono text-sm text-slate-900">
+                  {recoveryCodes.map((code) => (
+                    <li key={code}>{code}</li>
+                  ))}
+                </ul>
+                <button
+                  type="button"
+                  onClick={continueToDashboard}
+                  className="inline-flex w-full cursor-pointer items-center justify-center rounded-xl bg-slate-900 px-4 py-2.5 text-sm font-semibold text-white shadow-sm hover:bg-slate-800 transition-colors"
+                >
+                  I saved them, continue
+                </button>
+              </div>
+            ) : challenge ? (
+              <form
+                onSubmit={(e) => void handleVerify(e)}
+                autoComplete="off"
+                className="space-y-5"
+                noValidate
+              >
+                {challenge.setup && (
+                  <div className="space-y-2 rounded-xl border border-slate-200 bg-slate-50 p-4 text-sm text-slate-600">
+                    <p>
+                      Your account requires two-factor authentication. Add it
+                      to your authenticator app with this key, or open the
+                      setup link on your phone:
+                    </p>
+                    <p className="break-all font-mono text-slate-900">
+                      {challenge.secret}
+                    </p>
+                    <a
+                      href={challenge.otpauthUrl}
+                      className="font-medium text-slate-900 underline"
+                    >
+                      Open in authenticator
+                    </a>
+                  </div>
+                )}
+
+                <div className="space-y-1.5">
+                  <label
+                    htmlFor="code"
+                    className="block text-sm font-medium text-slate-700"
+                  >
+                    Authentication code
+                  </label>
+                  <input
+                    id="code"
+                    name="code"
+                    type="text"
+                    inputMode="text"
+                    autoComplete="one-time-code"
+                    placeholder="6-digit code or recovery code"
+                    required
+                    className="block w-full rounded-xl border border-slate-200 bg-white px-3.5 py-2.5 text-sm text-slate-900 placeholder:text-slate-400 focus:outline-none focus:ring-2 focus:ring-slate-900 focus:border-slate-900"
+                  />
+                </div>
+
+                <button
+                  type="submit"
+                  disabled={loading}
+                  className="mt-1 inline-flex w-full cursor-pointer items-center justify-center rounded-xl bg-slate-900 px-4 py-2.5 text-sm font-semibold text-white shadow-sm hover:bg-slate-800 disabled:opacity-60 disabled:cursor-not-allowed transition-colors"
+                >
+                  {loading ? "Verifying..." : "Verify"}
+                </button>
+              </form>
+            ) : mode === "login" ? (
               <>
                 <form
                   onSubmit={onSubmit}
@@ -3,6 +3,8 @@ import Link from "next/link";
 import { usePathname, useRouter } from "next/navigation";
 import { useState } from "react";
 import { useAuth } from "../auth/AuthContext";
+import endpoints from "@/app/lib/endpoints";
+import { fetchDataPost } from "@/app/lib/fetchData";
 
 // type NavItem = {
 //   label: string;
@@ -30,7 +32,10 @@ export default function Sidebar() {
     pathname === href || (href === "/dashboard" && pathname === "/");
 
   const handleLogout = () => {
+    // Revoke the session server-side; sign out locally either way
+    fetchDataPost(endpoints.auth.logout).catch(() => {});
     localStorage.removeItem("authToken");
+    localStorage.removeItem("refreshToken");
 
     setUser(null);
     setMenus([]);
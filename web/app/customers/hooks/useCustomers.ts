@@ -1,7 +1,7 @@
 /* eslint-disable @typescript-eslint/no-explicit-any */
 import { useEffect, useRef, useState } from "react";
 import {
-  fetchDataGet,
+  fetchAllPages,
   fetchDataPost,
   fetchWithError,
 } from "@/app/lib/fetchData";
@@ -50,15 +50,7 @@ export function useCustomers() {
       }
       setError(null);
 
-      const apiData = await fetchDataGet<any>(endpoints.customer.getAll);
-
-      let list: any[] = [];
-      if (Array.isArray(apiData?.data)) list = apiData.data;
-      else if (Array.isArray(apiData)) list = apiData;
-      else if (apiData && typeof apiData === "object") {
-        const arr = Object.values(apiData).find(Array.isArray);
-        if (arr) list = arr as any[];
-      }
+      const list = await fetchAllPages<any>(endpoints.customer.getAll);
 
       const rows: CustomerRow[] = list.map((c: any) => ({
         id: c.id || c._id || "",
@@ -94,6 +86,7 @@ export function useCustomers() {
         address: values.location,
         city: values.city,
         tinnumber: values.tin,
+        version: values.id ? editing?._raw?.version : undefined,
       };
 
       await fetchDataPost(endpoints.customer.addOrUpdate, payload);
@@ -11,7 +11,15 @@ import { useToast } from "./useToast";
 type LoginResponse = {
   message: string;
   token: string;
+  refresh_token: string;
+  expires_in: number;
   menus: MenuItem[];
+  two_factor_required?: boolean;
+  two_factor_setup?: boolean;
+  challenge_token?: string;
+  secret?: string;
+  otpauth_url?: string;
+  recovery_codes?: string[];
   user?: {
     email?: string;
     name?: string;
@@ -19,12 +27,51 @@ type LoginResponse = {
   };
 };
 
+export type TwoFactorChallenge = {
+  email: string;
+  challengeToken: string;
+  setup: boolean;
+  secret?: string;
+  otpauthUrl?: string;
+};
+
 export default function useLogin() {
   const [loading, setLoading] = useState(false);
+  const [challenge, setChallenge] = useState<TwoFactorChallenge | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
   const router = useRouter();
   const { setUser, setMenus } = useAuth();
   const toast = useToast();
 
+  function finishLogin(email: string, data: LoginResponse) {
+    // 🔐 Save token for later API calls
+    if (typeof window !== "undefined") {
+      window.localStorage.setItem("authToken", data.token);
+      window.localStorage.setItem("refreshToken", data.refresh_token);
+    }
+
+    // optional: store user in context for header display
+    setUser?.({
+      email,
+      name: data.user?.name ?? "Admin",
+    });
+    setMenus(data.menus || []);
+
+    // Recovery codes are shown once, right after 2FA was switched on
+    if (data.recovery_codes?.length) {
+      setRecoveryCodes(data.recovery_codes);
+      return;
+    }
+
+    toast.success("Login successful! Redirecting...");
+    router.push("/dashboard");
+  }
+
+  function continueToDashboard() {
+    setRecoveryCodes(null);
+    router.push("/dashboard");
+  }
+
   async function handleLogin(e: FormEvent<HTMLFormElement>) {
     e.preventDefault();
     setLoading(true);
@@ -45,19 +92,18 @@ export default function useLogin() {
         }
       );
 
-      // 🔐 Save token for later API calls
-      if (typeof window !== "undefined") {
-        window.localStorage.setItem("authToken", data.token);
+      if (data.two_factor_required && data.challenge_token) {
+        setChallenge({
+          email,
+          challengeToken: data.challenge_token,
+          setup: !!data.two_factor_setup,
+          secret: data.secret,
+          otpauthUrl: data.otpauth_url,
+        });
+        return;
       }
 
-      // optional: store user in context for header display
-      setUser?.({
-        email,
-        name: data.user?.name ?? "Admin",
-      });
-      setMenus(data.menus || []);
-      toast.success("Login successful! Redirecting...");
-      router.push("/dashboard");
+      finishLogin(email, data);
     } catch (err: any) {
       console.error("Login failed:", err?.message);
       toast.error(err?.message ?? "Login failed");
@@ -66,5 +112,43 @@ export default function useLogin() {
     }
   }
 
-  return { handleLogin, loading };
+  async function handleVerify(e: FormEvent<HTMLFormElement>) {
+    e.preventDefault();
+    if (!challenge) return;
+    setLoading(true);
+
+    try {
+      const form = e.currentTarget;
+      const code = (form.elements.namedItem("code") as HTMLInputElement).value;
+
+      const data = await fetchWithError<LoginResponse>(
+        endpoints.auth.verifyTwoFactor,
+        {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({
+            challenge_token: challenge.challengeToken,
+            code,
+          }),
+        }
+      );
+
+      const email = challenge.email;
+      setChallenge(null);
+      finishLogin(email, data);
+    } catch (err: any) {
+      toast.error(err?.message ?? "Verification failed");
+    } finally {
+      setLoading(false);
+    }
+  }
+
+  return {
+    handleLogin,
+    handleVerify,
+    continueToDashboard,
+    challenge,
+    recoveryCodes,
+    loading,
+  };
 }
@@ -14,6 +14,10 @@ const endpoints = {
     health: full("/auth"), // GET "Auth Service Healthy"
     signUpEmail: full("/auth/sign-up-email"), // POST
     signInEmail: full("/auth/sign-in-email"), // POST
+    verifyTwoFactor: full("/auth/2fa/verify"), // POST { challenge_token, code }
+    refresh: full("/auth/refresh"), // POST { refresh_token }
+    logout: full("/auth/logout"), // POST
+    logoutAll: full("/auth/logout-all"), // POST
     getAllUsers: full("/auth/get-all-user"), // GET
     getAllRoles: full("/auth/get-all-roles"), // GET
     createRole: full("/auth/create-roles"), // POST
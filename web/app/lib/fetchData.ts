@@ -1,6 +1,7 @@
 /* eslint-disable @typescript-eslint/no-explicit-any */
 
 import axios, { AxiosError, AxiosRequestConfig, AxiosResponse } from "axios";
+import endpoints from "./endpoints";
 
 type Json = Record<string, any>;
 
@@ -9,11 +10,56 @@ type ErrorResponse = {
   error?: string;
 };
 
+// Access tokens are short-lived; one refresh is shared by every request
+// that failed with 401 while it was running.
+let refreshing: Promise<string | null> | null = null;
+
+function refreshAccessToken(): Promise<string | null> {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem("refreshToken");
+    refreshing = (
+      refreshToken
+        ? axios
+            .post(endpoints.auth.refresh, { refresh_token: refreshToken })
+            .then((res) => {
+              localStorage.setItem("authToken", res.data.token);
+              localStorage.setItem("refreshToken", res.data.refresh_token);
+              return res.data.token as string;
+            })
+            .catch(() => null)
+        : Promise.resolve(null)
+    ).finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
 axios.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
+
+    if (
+      error.response?.status === 401 &&
+      original &&
+      !original._retried &&
+      original.url !== endpoints.auth.refresh
+    ) {
+      original._retried = true;
+      const token = await refreshAccessToken();
+      if (token) {
+        original.headers = {
+          ...(original.headers || {}),
+          Authorization: `Bearer ${token}`,
+        };
+        return axios(original);
+      }
+    }
+
     if (error.response?.status === 401) {
       localStorage.removeItem("authToken");
+      localStorage.removeItem("refreshToken");
 
       if (typeof window !== "undefined") {
         window.location.href = "/";
@@ -85,6 +131,23 @@ async function fetchDataGet<T = any>(url: string): Promise<T> {
 }
 
 
+// List endpoints answer one page at a time; this follows nextCursor until
+// the last page and returns every row.
+async function fetchAllPages<T = any>(url: string): Promise<T[]> {
+  const rows: T[] = [];
+  let cursor: string | undefined;
+  do {
+    const pageUrl = cursor
+      ? `${url}${url.includes("?") ? "&" : "?"}cursor=${encodeURIComponent(cursor)}`
+      : url;
+    const res = await fetchDataGet<{ data?: T[]; nextCursor?: string }>(
+      pageUrl
+    );
+    rows.push(...(Array.isArray(res?.data) ? res.data : []));
+    cursor = res?.nextCursor;
+  } while (cursor);
+  return rows;
+}
 
 async function fetchDataPost<T, B extends Json = Json>(
   url: string,
@@ -196,6 +259,7 @@ async function fetchWithError<T = any>(
 
 export {
   fetchDataGet,
+  fetchAllPages,
   fetchDataPost,
   fetchDataPatch,
   fetchDataDelete,
@@ -75,6 +75,7 @@ export function useProjects() {
             project_id: p.project_id,
             project_name: p.project_name,
             notes: p.notes || "",
+            version: p.version,
             customer: {
               id: p.customer?.id || p.customer?._id || "",
               address: p.customer?.address || "",
@@ -105,6 +106,7 @@ export function useProjects() {
           project_name: values.projectName,
           customer_id: values.customerId,
           notes: values.deploymentNotes || "",
+          version: editing!._raw.version,
         };
 
         const id = editing!._raw.id || editing!._raw._id;
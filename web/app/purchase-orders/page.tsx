@@ -83,6 +83,7 @@ export default function SupplierPOPage() {
             supplierPOId: editing._raw.id || editing._raw._id,
             status: values.status,
             items,
+            version: editing._raw.version,
           }),
         });
 
@@ -3,6 +3,7 @@
 import { useEffect, useState } from "react";
 import endpoints from "@/app/lib/endpoints";
 import {
+  fetchAllPages,
   fetchDataGet,
   fetchDataPost,
   fetchWithError,
@@ -73,10 +74,7 @@ export function useSalesOrders() {
       }
       setError(null);
 
-      const res = await fetchDataGet<any>(endpoints.salesOrder.getAll);
-      const list = Array.isArray(res)
-        ? res
-        : res?.data || res?.items || res?.salesOrders || [];
+      const list = await fetchAllPages<any>(endpoints.salesOrder.getAll);
 
       setOrders(
         list.map((o: any) => ({
@@ -196,6 +194,7 @@ export function useSalesOrders() {
             id,
             ...payload,
             status: values.status,
+            version: editing._raw.version,
           }),
         });
         toast.success("Sales order updated");
@@ -1,7 +1,7 @@
 import { useCallback, useState } from "react";
-import { Supplier, SupplierForm, SupplierListResponse } from "../type";
+import { Supplier, SupplierForm } from "../type";
 import {
-  fetchDataGet,
+  fetchAllPages,
   fetchDataPost,
   fetchDataPut,
   fetchWithError,
@@ -26,11 +26,7 @@ export function useSupplier() {
 
       setError(null);
 
-      const res = await fetchDataGet<SupplierListResponse>(
-        endpoints.supplier.getAll
-      );
-
-      setAllSupplier(Array.isArray(res?.suppliers) ? res.suppliers : []);
+      setAllSupplier(await fetchAllPages<Supplier>(endpoints.supplier.getAll));
     } catch (err: any) {
       setError(err.message || "Failed to fetch suppliers");
       setAllSupplier([]);
@@ -54,6 +50,7 @@ export function useSupplier() {
           await fetchDataPut(endpoints.supplier.edit, {
             id: editing,
             ...form,
+            version: allSupplier.find((s) => s.id === editing)?.version,
           });
           toast.success("Supplier updated successfully");
         } else {
@@ -71,7 +68,7 @@ export function useSupplier() {
         setSaving(false);
       }
     },
-    [editing, GetSupplier]
+    [editing, allSupplier, GetSupplier]
   );
 
   const deleteSupplier = useCallback(
@@ -13,6 +13,7 @@ export type Supplier = {
   tin_number: string;
   organization: string;
   location: string;
+  version: number;
   created_at: string;
   created_by: string;
 };
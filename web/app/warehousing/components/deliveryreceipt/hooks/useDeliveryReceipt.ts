@@ -17,6 +17,7 @@ import endpoints from "@/app/lib/endpoints";
 export function useDeliveryReceipt() {
   const [mode, setMode] = useState<"list" | "create">("list");
   const [editing, setEditing] = useState<string | null>(null);
+  const [version, setVersion] = useState<number | undefined>(undefined);
   const [loading, setLoading] = useState(false);
   const [saving, setSaving] = useState(false);
   const [error, setError] = useState<string | null>(null);
@@ -124,6 +125,7 @@ export function useDeliveryReceipt() {
     );
 
     const dr = res.supplierDR;
+    setVersion(dr.version);
 
     setForm({
       supplier_id: dr.supplier_id,
@@ -196,6 +198,7 @@ export function useDeliveryReceipt() {
       reference: form.reference,
       date: form.date,
       items: mappedItems,
+      version: editing ? version : undefined,
     };
 
     if (editing) {
@@ -221,7 +224,7 @@ export function useDeliveryReceipt() {
     setEditing(null);
     setMode("list");
     GetDrReceipts(page, false);
-  }, [editing, form, items]);
+  }, [editing, version, form, items]);
 
   const deleteDr = useCallback(
     async (id: string) => {
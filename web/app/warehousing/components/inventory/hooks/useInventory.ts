@@ -1,8 +1,8 @@
 import { useCallback, useEffect, useState } from "react";
-import { InventoryItem, InventoryListResponse } from "../type";
+import { InventoryItem } from "../type";
 import {
+  fetchAllPages,
   fetchDataDelete,
-  fetchDataGet,
   fetchDataPost,
   fetchDataPut,
 } from "@/app/lib/fetchData";
@@ -50,11 +50,9 @@ export function useInventory() {
 
       setError(null);
 
-      const res = await fetchDataGet<InventoryListResponse>(
-        endpoints.inventory.getAll
+      setAllInventories(
+        await fetchAllPages<InventoryItem>(endpoints.inventory.getAll)
       );
-
-      setAllInventories(Array.isArray(res?.inventory) ? res.inventory : []);
     } catch (err: any) {
       setError(err.message || "Failed to fetch inventories");
       setAllInventories([]);
@@ -86,7 +84,10 @@ export function useInventory() {
 
     try {
       if (editing?.id) {
-        await fetchDataPut(endpoints.inventory.update(editing.id), form);
+        await fetchDataPut(endpoints.inventory.update(editing.id), {
+          ...form,
+          version: editing.version,
+        });
         toast.success("Inventory updated successfully");
       } else {
         await fetchDataPost(endpoints.inventory.add, form);
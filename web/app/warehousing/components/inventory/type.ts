@@ -9,6 +9,7 @@ export type InventoryItem = {
   type_of_aircon: string;
   indoor_outdoor_unit: string;
   quantity: number;
+  version: number;
 
   supplier_dr_id?: string;
   supplier_invoice_id?: string;
@@ -17,6 +17,7 @@ import { toast } from "react-toastify";
 export function useSalesInvoice() {
   const [mode, setMode] = useState<"list" | "create">("list");
   const [editing, setEditing] = useState<string | null>(null);
+  const [version, setVersion] = useState<number | undefined>(undefined);
   const [loading, setLoading] = useState(false);
   const [saving, setSaving] = useState(false);
   const [page, setPage] = useState(1);
@@ -125,6 +126,7 @@ export function useSalesInvoice() {
     );
 
     const inv = res.invoice;
+    setVersion(inv.version);
 
     setForm({
       supplier_id: inv.supplier_id,
@@ -217,6 +219,7 @@ export function useSalesInvoice() {
       total_sales: totalSales,
       vat: vatAmount,
       grand_total: grandTotal,
+      version: editing ? version : undefined,
     };
 
     if (editing) {
@@ -245,7 +248,7 @@ export function useSalesInvoice() {
     setEditing(null);
     setMode("list");
     GetSalesInvoice(page, false);
-  }, [editing, form, items, totalSales, vatAmount, grandTotal]);
+  }, [editing, version, form, items, totalSales, vatAmount, grandTotal]);
 
   const deleteSalesInvoice = useCallback(
     async (id: string) => {
@@ -37,6 +37,7 @@ export type SupplierInvoice = {
   total_sales: number;
   vat: number;
   grand_total: number;
+  version: number;
 
   created_at: string;
   created_by: string;